@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// auditReplicas is the number of replicas each metric should have, or 0
+// for the hash ring's replicas.
+var auditReplicas int
+
+// auditFromDir is a Whisper DB tree to read metric names from.
+var auditFromDir string
+
+// ReplicaStatus is where a metric should be stored and where it was found.
+type ReplicaStatus struct {
+	// Expected are the servers owning the metric's replicas, sorted
+	Expected []string `json:"expected"`
+
+	// Found are the servers the metric is stored on, sorted
+	Found []string `json:"found"`
+
+	// Missing are the expected servers the metric was not found on
+	Missing []string `json:"missing"`
+
+	// Stale are the servers the metric was found on that do not own it
+	Stale []string `json:"stale"`
+}
+
+// ReplicaAudit is the cluster wide replication report for a set of metrics.
+type ReplicaAudit struct {
+	// Total is the number of metrics audited
+	Total int `json:"total"`
+
+	// Replicas is the number of replicas each metric should have
+	Replicas int `json:"replicas"`
+
+	// Correct is the number of metrics found on exactly their owners
+	Correct int `json:"correct"`
+
+	// Under is the number of metrics missing from one or more owners
+	Under int `json:"under_replicated"`
+
+	// Over is the number of metrics found on servers that do not own them
+	Over int `json:"over_replicated"`
+
+	// Offenders maps each metric that is not correct to its ReplicaStatus
+	Offenders map[string]*ReplicaStatus `json:"offenders"`
+}
+
+func init() {
+	usage := "[options] <metric list>"
+	short := "Find under and over replicated metrics across the cluster."
+	long := `Check that each of the given metrics is stored on exactly the servers
+owning its replicas.  The hash ring gives the --replicas servers owning each
+metric, or as many as the ring's replicas if not given, and every server in
+the cluster is asked which of the metrics it stores.
+
+Each metric is then correctly replicated if found on exactly its owners,
+under-replicated if missing from any owner, and over-replicated if found on
+a server that does not own it, such as a stale copy left behind by a
+rebalance.  A metric moved to the wrong server is both.  As with the
+inconsistent command, carbon.agents metrics are never over-replicated.
+
+Metrics may be listed on the command line as arguments or, if the first
+argument is "-" we read the list on STDIN as a JSON array or one metric per
+line.  Use --from-dir to read the metrics of every Whisper DB found in a
+directory tree instead.
+
+The counts are written to STDOUT.  Use -j for a JSON object that also maps
+each offending metric to its expected servers, the servers it was found on,
+and the servers it is missing from or stale on.  We exit non-zero if any
+metric is under or over replicated.`
+
+	c := NewCommand(auditReplicasCommand, "audit-replicas", usage, short, long)
+	SetupCommon(c)
+	SetupHostname(c)
+	SetupJSON(c)
+	SetupRingFile(c)
+
+	c.Flag.IntVar(&auditReplicas, "replicas", 0,
+		"Replicas each metric should have, rather than the hash ring's.")
+	c.Flag.StringVar(&auditFromDir, "from-dir", "",
+		"Read metrics from the Whisper DBs found in this directory tree.")
+	c.Flag.BoolVar(&listForce, "f", false,
+		"Force the remote daemons to rebuild their caches.")
+}
+
+// subtractServers returns the servers of a not in b.
+func subtractServers(a []string, b map[string]bool) []string {
+	result := make([]string, 0)
+	for _, s := range a {
+		if !b[s] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// AuditReplicas compares the map of metric => replica nodes, as returned
+// by replicaNodes(), with the map of server host:port => metrics found
+// there, as returned by ListSliceMetrics().
+func AuditReplicas(nodes map[string][]hashing.Node, found map[string][]string, replicas int) *ReplicaAudit {
+	audit := &ReplicaAudit{
+		Total:     len(nodes),
+		Replicas:  replicas,
+		Offenders: make(map[string]*ReplicaStatus),
+	}
+
+	stored := make(map[string][]string, len(nodes))
+	for hostport, metrics := range found {
+		server, _, err := net.SplitHostPort(hostport)
+		if err != nil {
+			server = hostport
+		}
+		for _, m := range metrics {
+			if _, ok := nodes[m]; ok {
+				stored[m] = append(stored[m], server)
+			}
+		}
+	}
+
+	for m, ns := range nodes {
+		owners := make(map[string]bool, len(ns))
+		status := &ReplicaStatus{Expected: make([]string, 0, len(ns))}
+		for _, n := range ns {
+			if !owners[n.Server] {
+				owners[n.Server] = true
+				status.Expected = append(status.Expected, n.Server)
+			}
+		}
+		sort.Strings(status.Expected)
+
+		status.Found = stored[m]
+		if status.Found == nil {
+			status.Found = make([]string, 0)
+		}
+		sort.Strings(status.Found)
+		present := make(map[string]bool, len(status.Found))
+		for _, s := range status.Found {
+			present[s] = true
+		}
+
+		status.Missing = subtractServers(status.Expected, present)
+		status.Stale = subtractServers(status.Found, owners)
+		if strings.HasPrefix(m, "carbon.agents.") {
+			// These metrics are inserted into the stream after hashing
+			status.Stale = make([]string, 0)
+		}
+
+		if len(status.Missing) > 0 {
+			audit.Under++
+		}
+		if len(status.Stale) > 0 {
+			audit.Over++
+		}
+		if len(status.Missing) == 0 && len(status.Stale) == 0 {
+			audit.Correct++
+		} else {
+			audit.Offenders[m] = status
+		}
+	}
+
+	return audit
+}
+
+// auditReplicasCommand runs this subcommand.
+func auditReplicasCommand(c Command) int {
+	if auditReplicas < 0 {
+		log.Print("--replicas must not be negative.")
+		return 1
+	}
+
+	_, err := GetClusterConfig(HostPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	var metrics []string
+	if auditFromDir != "" {
+		metrics, err = walkMetrics(auditFromDir, nil, 0)
+		if err != nil {
+			log.Printf("Error reading %s: %s", auditFromDir, err)
+			return 1
+		}
+	} else if c.Flag.NArg() == 0 {
+		log.Print("At least one argument is required.")
+		return 1
+	} else if c.Flag.Arg(0) != "-" {
+		metrics = c.Flag.Args()
+	} else {
+		metrics, err = ReadMetrics(os.Stdin)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+
+	nodes, err := replicaNodes(metrics, auditReplicas)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	replicas := auditReplicas
+	if replicas == 0 {
+		replicas = ringReplicas()
+	}
+	if replicas > Cluster.Hash.Len() {
+		replicas = Cluster.Hash.Len()
+	}
+	found, err := ListSliceMetrics(Cluster.HostPorts(), metrics, listForce)
+	if err != nil {
+		log.Printf("Error listing metrics: %s", err)
+		return 1
+	}
+
+	audit := AuditReplicas(nodes, found, replicas)
+	if JSONOutput {
+		err = WriteJSON(os.Stdout, audit)
+		if err != nil {
+			log.Printf("Error encoding JSON output: %s", err)
+			return 1
+		}
+	} else {
+		fmt.Printf("Metrics: %d\n", audit.Total)
+		fmt.Printf("Replicas: %d\n", audit.Replicas)
+		fmt.Printf("Correctly replicated: %d\n", audit.Correct)
+		fmt.Printf("Under-replicated: %d\n", audit.Under)
+		fmt.Printf("Over-replicated: %d\n", audit.Over)
+	}
+
+	if len(audit.Offenders) > 0 {
+		log.Printf("%d of %d metrics are not correctly replicated", len(audit.Offenders), audit.Total)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestAuditReplicas(t *testing.T) {
+	nodes := map[string][]hashing.Node{
+		"foo.correct": {hashing.NewNode("graphite010", 2004, "a"), hashing.NewNode("graphite011", 2004, "b")},
+		"foo.under":   {hashing.NewNode("graphite010", 2004, "a"), hashing.NewNode("graphite012", 2004, "c")},
+		"foo.over":    {hashing.NewNode("graphite011", 2004, "b"), hashing.NewNode("graphite012", 2004, "c")},
+		"foo.moved":   {hashing.NewNode("graphite010", 2004, "a"), hashing.NewNode("graphite011", 2004, "b")},
+		"foo.lost":    {hashing.NewNode("graphite011", 2004, "b"), hashing.NewNode("graphite012", 2004, "c")},
+		"carbon.agents.graphite010.cpuUsage": {hashing.NewNode("graphite011", 2004, "b"),
+			hashing.NewNode("graphite012", 2004, "c")},
+	}
+	found := map[string][]string{
+		"graphite010:4242": {"foo.correct", "foo.under", "foo.over", "carbon.agents.graphite010.cpuUsage", "foo.other"},
+		"graphite011:4242": {"foo.correct", "foo.over", "foo.moved", "carbon.agents.graphite010.cpuUsage"},
+		"graphite012:4242": {"foo.over", "foo.moved", "carbon.agents.graphite010.cpuUsage"},
+	}
+
+	audit := AuditReplicas(nodes, found, 2)
+	if audit.Total != 6 || audit.Replicas != 2 || audit.Correct != 2 || audit.Under != 3 || audit.Over != 2 {
+		t.Errorf("AuditReplicas() returned %+v", audit)
+	}
+
+	expected := map[string]*ReplicaStatus{
+		"foo.under": {
+			Expected: []string{"graphite010", "graphite012"},
+			Found:    []string{"graphite010"},
+			Missing:  []string{"graphite012"},
+			Stale:    []string{},
+		},
+		"foo.over": {
+			Expected: []string{"graphite011", "graphite012"},
+			Found:    []string{"graphite010", "graphite011", "graphite012"},
+			Missing:  []string{},
+			Stale:    []string{"graphite010"},
+		},
+		"foo.moved": {
+			Expected: []string{"graphite010", "graphite011"},
+			Found:    []string{"graphite011", "graphite012"},
+			Missing:  []string{"graphite010"},
+			Stale:    []string{"graphite012"},
+		},
+		"foo.lost": {
+			Expected: []string{"graphite011", "graphite012"},
+			Found:    []string{},
+			Missing:  []string{"graphite011", "graphite012"},
+			Stale:    []string{},
+		},
+	}
+	if !reflect.DeepEqual(audit.Offenders, expected) {
+		for m, s := range audit.Offenders {
+			t.Logf("%s: %+v", m, s)
+		}
+		t.Errorf("AuditReplicas() returned the wrong offenders")
+	}
+}
@@ -41,6 +41,24 @@ This operation is idempotent.  Repeated runs will find new metrics already
 filled and not overwrite data points.  The old or source metrics are not
 modified or removed.
 
+Before writing any metrics we print how many will be written to each server
+and ask for confirmation.  Use --yes to skip the prompt.  We do not ask when
+there is no terminal to ask on.
+
+Use --host-map to give a file mapping carbon instances to the hosts to
+connect to when they differ, such as when an instance name is not the
+server's hostname.  The file is a JSON object of instance => host or has
+an instance and a host on each line separated by whitespace.  Entries may
+name a server:instance node, an instance, or a server.  Placement still
+uses the hash ring's nodes.
+
+Each Whisper DB is verified against the SHA-256 checksum its buckyd daemon
+reports when downloaded, and the receiving daemon verifies it again before
+filling from it, so truncated or corrupted transfers are caught.  Failed
+transfers are retried --retries times and metrics that still fail are
+listed and make the backfill fail.  Buckyd daemons that predate checksums
+are not verified.
+
 Set -w to change the number of worker threads used to upload the Whisper
 DBs to the remote servers.`
 
@@ -48,6 +66,9 @@ DBs to the remote servers.`
 	SetupCommon(c)
 	SetupHostname(c)
 	SetupSingle(c)
+	SetupConfirm(c)
+	SetupHostMap(c)
+	SetupRetries(c)
 
 	c.Flag.IntVar(&metricWorkers, "w", 5,
 		"Downloader threads.")
@@ -64,14 +85,14 @@ func backfillWorker(workIn chan *MigrateWork, wg *sync.WaitGroup) {
 				work.oldLocation, work.oldName,
 				work.newLocation, work.newName)
 		}
-		metric, err := GetMetricData(work.oldLocation, work.oldName)
-		if err != nil {
-			// errors already handled
-			workerErrors = true
-			continue
-		}
-		metric.Name = work.newName
-		err = PostMetric(work.newLocation, metric)
+		err := retryTransfer(work.oldName, func() error {
+			metric, err := GetMetricData(work.oldLocation, work.oldName)
+			if err != nil {
+				return err
+			}
+			metric.Name = work.newName
+			return PostMetric(work.newLocation, metric)
+		})
 		if err != nil {
 			// errors already handled
 			workerErrors = true
@@ -110,6 +131,17 @@ func BackfillMetrics(metricMap map[string]string) error {
 		}
 	}
 
+	if needConfirmation() {
+		dests := make(map[string]int)
+		for m := range backfillJob {
+			dests[Cluster.Hash.GetNode(CleanMetric(metricMap[m])).Server]++
+		}
+		if !confirmPlacement(dests) {
+			log.Printf("Backfill aborted.")
+			return fmt.Errorf("Backfill aborted.")
+		}
+	}
+
 	workIn := make(chan *MigrateWork, 25)
 	wg := new(sync.WaitGroup)
 	wg.Add(metricWorkers)
@@ -125,7 +157,7 @@ func BackfillMetrics(metricMap map[string]string) error {
 		work.oldName = m
 		work.newName = CleanMetric(metricMap[m])
 		work.oldLocation = server
-		work.newLocation = Cluster.Hash.GetNode(work.newName).Server
+		work.newLocation = connectHost(Cluster.Hash.GetNode(work.newName))
 
 		workIn <- work
 		c++
@@ -145,6 +177,9 @@ func BackfillMetrics(metricMap map[string]string) error {
 	close(workIn)
 	wg.Wait()
 	log.Printf("Backfill request complete.")
+	if err := logFailedTransfers(); err != nil {
+		return err
+	}
 	if workerErrors {
 		log.Printf("Errors are present.")
 		return fmt.Errorf("Backfill errors are present.")
@@ -174,6 +209,10 @@ func readBackfillMap(fd *os.File) (map[string]string, error) {
 
 // backfillCommand runs this subcommand.
 func backfillCommand(c Command) int {
+	if err := LoadHostMap(); err != nil {
+		log.Print(err)
+		return 1
+	}
 	if c.Flag.NArg() == 0 {
 		log.Fatal("At least one argument is required.")
 	}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// capacityTarget is the share of the metrics, in percent, that the busiest
+// server must be brought under.
+var capacityTarget float64
+
+// capacityTemplate is the fmt template naming the servers added.
+var capacityTemplate string
+
+// capacityMaxAdd is the most servers added before giving up.
+var capacityMaxAdd int
+
+// capacityFromDir is a Whisper DB tree to read metric names from.
+var capacityFromDir string
+
+// CapacityStep is the balance of the given metrics over the hash ring
+// after adding servers.
+type CapacityStep struct {
+	// Added is the number of servers added to the ring
+	Added int `json:"added"`
+
+	// Servers is the number of servers in the ring
+	Servers int `json:"servers"`
+
+	// Busiest is the server holding the most metrics
+	Busiest string `json:"busiest"`
+
+	// Count is the number of metrics the Busiest server holds
+	Count int `json:"count"`
+
+	// Percent is the share of all metrics the Busiest server holds
+	Percent float64 `json:"percent"`
+}
+
+// CapacityPlan is the result of adding servers to the hash ring until the
+// busiest server holds less than the target share of the metrics.
+type CapacityPlan struct {
+	// Target is the share, in percent, the busiest server must be under
+	Target float64 `json:"target"`
+
+	// Metrics is the number of metrics placed
+	Metrics int `json:"metrics"`
+
+	// Met is true if the target was reached
+	Met bool `json:"met"`
+
+	// Added are the names of the servers added, in order
+	Added []string `json:"added"`
+
+	// Steps is the balance before any servers are added and after each
+	Steps []CapacityStep `json:"steps"`
+}
+
+func init() {
+	usage := "[options] <metric list>"
+	short := "Find how many servers to add to bring the busiest under a target."
+	long := `Simulate adding servers to the cluster's hash ring, one at a time,
+until the busiest server holds less than --target-pct percent of the given
+metrics.  We report the balance before any servers are added and after each
+addition, and how many servers are needed.  This answers capacity planning
+questions such as how many nodes keep every host under 10% of the metrics.
+
+Added servers are named by the fmt template given by --template, such as
+"graphite%03d", numbered from 1 and skipping names already in the ring.
+Each is given the same ports and instances as the first server of the ring,
+with instances renamed <server>-<instance> to keep them unique as fnv1a
+requires, and is appended to the ring's nodes.  We give up after --max-add servers and
+exit non-zero if the target was not met.
+
+Metrics may be listed on the command line as arguments or, if the first
+argument is "-" we read the list on STDIN as a JSON array or one metric per
+line.  Use --from-dir to read the metrics of every Whisper DB found in a
+directory tree instead.
+Use -j for JSON output.  Use -s to query the hash ring only on the host
+given by -h or in the BUCKYHOST environment variable.  Use --ring-file to
+start from the hash ring in a ring file rather than the cluster.`
+
+	c := NewCommand(capacityCommand, "plan-capacity", usage, short, long)
+	SetupCommon(c)
+	SetupHostname(c)
+	SetupSingle(c)
+	SetupJSON(c)
+	SetupRingFile(c)
+
+	c.Flag.Float64Var(&capacityTarget, "target-pct", 0,
+		"Add servers until the busiest holds less than this percent of the metrics.")
+	c.Flag.StringVar(&capacityTemplate, "template", "new%03d",
+		"fmt template naming the added servers.")
+	c.Flag.IntVar(&capacityMaxAdd, "max-add", 100,
+		"Give up after adding this many servers.")
+	c.Flag.StringVar(&capacityFromDir, "from-dir", "",
+		"Read metrics from the Whisper DBs found in this directory tree.")
+}
+
+// capacityStep returns the CapacityStep of the metrics placed by the hash
+// ring built from ring.
+func capacityStep(ring *hashing.JSONRingType, metrics []string) (CapacityStep, error) {
+	hr, err := buildHashRing([]*hashing.JSONRingType{ring})
+	if err != nil {
+		return CapacityStep{}, err
+	}
+
+	counts := make(map[string]int)
+	for _, s := range hashing.NodeServers(ring.Nodes) {
+		counts[s] = 0
+	}
+	for _, m := range metrics {
+		counts[hr.GetNode(locateKey(m)).Server]++
+	}
+
+	step := CapacityStep{Servers: len(counts)}
+	for _, s := range sortedHosts(counts) {
+		if step.Busiest == "" || counts[s] > step.Count {
+			step.Busiest, step.Count = s, counts[s]
+		}
+	}
+	step.Percent = 100 * float64(step.Count) / float64(len(metrics))
+	return step, nil
+}
+
+// PlanCapacity adds servers named by template to a copy of ring until the
+// busiest server holds less than target percent of the metrics or maxAdd
+// servers have been added.
+func PlanCapacity(ring *hashing.JSONRingType, metrics []string, target float64,
+	template string, maxAdd int) (*CapacityPlan, error) {
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("No metrics to place")
+	}
+	if len(ring.Nodes) == 0 {
+		return nil, fmt.Errorf("Hash ring has no nodes")
+	}
+	if a, b := fmt.Sprintf(template, 1), fmt.Sprintf(template, 2); a == b || strings.Contains(a, "%!") {
+		return nil, fmt.Errorf("Template %q must number servers with a verb such as %%d", template)
+	}
+
+	plan := &CapacityPlan{
+		Target:  target,
+		Metrics: len(metrics),
+		Added:   make([]string, 0),
+		Steps:   make([]CapacityStep, 0),
+	}
+	r := *ring
+	r.Nodes = append([]hashing.Node{}, ring.Nodes...)
+
+	// New servers are given the ports and instances of the first server.
+	// The fnv1a algorithm places nodes by instance alone so instances are
+	// prefixed with the new server's name to keep them unique.
+	first := make([]hashing.Node, 0)
+	existing := make(map[string]bool)
+	for _, n := range ring.Nodes {
+		existing[n.Server] = true
+		if n.Server == ring.Nodes[0].Server {
+			first = append(first, n)
+		}
+	}
+
+	i := 0
+	for {
+		step, err := capacityStep(&r, metrics)
+		if err != nil {
+			return nil, err
+		}
+		step.Added = len(plan.Added)
+		plan.Steps = append(plan.Steps, step)
+		if step.Percent < target {
+			plan.Met = true
+			return plan, nil
+		}
+		if len(plan.Added) >= maxAdd {
+			return plan, nil
+		}
+
+		// Distinct numbers name distinct servers unless the template
+		// ignores the number, so this many tries finds an unused name
+		name := ""
+		for tries := len(existing) + 1; name == "" && tries > 0; tries-- {
+			i++
+			if n := fmt.Sprintf(template, i); !existing[n] {
+				name = n
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("Template %q does not name new servers", template)
+		}
+		existing[name] = true
+		for _, n := range first {
+			instance := n.Instance
+			if instance != "" {
+				instance = name + "-" + instance
+			}
+			r.Nodes = append(r.Nodes, hashing.NewNode(name, n.Port, instance))
+		}
+		plan.Added = append(plan.Added, name)
+	}
+}
+
+// capacityCommand runs this subcommand.
+func capacityCommand(c Command) int {
+	if capacityTarget <= 0 || capacityTarget > 100 {
+		log.Print("--target-pct must be a percentage greater than 0.")
+		return 1
+	}
+	if capacityMaxAdd < 0 {
+		log.Print("--max-add must not be negative.")
+		return 1
+	}
+
+	_, err := GetClusterConfig(HostPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if !Cluster.Healthy {
+		log.Printf("Warning: Cluster is not healthy!")
+	}
+
+	var metrics []string
+	if capacityFromDir != "" {
+		metrics, err = walkMetrics(capacityFromDir, nil, 0)
+		if err != nil {
+			log.Printf("Error reading %s: %s", capacityFromDir, err)
+			return 1
+		}
+	} else if c.Flag.NArg() == 0 {
+		log.Print("At least one argument is required.")
+		return 1
+	} else if c.Flag.Arg(0) != "-" {
+		metrics = c.Flag.Args()
+	} else {
+		metrics, err = ReadMetrics(os.Stdin)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+
+	plan, err := PlanCapacity(Cluster.Rings[0], metrics, capacityTarget,
+		capacityTemplate, capacityMaxAdd)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	if JSONOutput {
+		err = WriteJSON(os.Stdout, plan)
+		if err != nil {
+			log.Printf("Error encoding JSON output: %s", err)
+			return 1
+		}
+	} else {
+		for _, s := range plan.Steps {
+			fmt.Printf("+%d servers (%d total): busiest %s holds %d metrics, %.2f%%\n",
+				s.Added, s.Servers, s.Busiest, s.Count, s.Percent)
+		}
+	}
+
+	if !plan.Met {
+		log.Printf("Adding %d servers does not bring the busiest server under %.2f%%",
+			len(plan.Added), capacityTarget)
+		return 1
+	}
+	log.Printf("Add %d servers to bring the busiest server under %.2f%%: %s",
+		len(plan.Added), capacityTarget, strings.Join(plan.Added, ", "))
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPlanCapacity(t *testing.T) {
+	metrics := make([]string, 0, 5000)
+	for i := 0; i < 5000; i++ {
+		metrics = append(metrics, fmt.Sprintf("bucky.capacity.host%03d.metric%d", i%100, i))
+	}
+
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		ring := makeTestRing(algo, 4)
+		plan, err := PlanCapacity(ring, metrics, 15, "graphite%03d", 20)
+		if err != nil {
+			t.Fatalf("%s: %s", algo, err)
+		}
+		if !plan.Met || len(plan.Steps) != len(plan.Added)+1 {
+			t.Fatalf("%s: Target not met after adding %v", algo, plan.Added)
+		}
+		last := plan.Steps[len(plan.Steps)-1]
+		if last.Percent >= 15 || last.Servers != 4+len(plan.Added) {
+			t.Errorf("%s: Unexpected final step: %+v", algo, last)
+		}
+		for _, s := range plan.Steps[:len(plan.Steps)-1] {
+			if s.Percent < 15 {
+				t.Errorf("%s: Target was met at %d servers but more were added", algo, s.Servers)
+			}
+		}
+		// graphite000 through graphite003 already exist
+		if plan.Added[0] != "graphite004" {
+			t.Errorf("%s: First added server is %s, rather than graphite004", algo, plan.Added[0])
+		}
+		if len(ring.Nodes) != 8 {
+			t.Errorf("%s: PlanCapacity modified the given ring", algo)
+		}
+	}
+
+	plan, err := PlanCapacity(makeTestRing("carbon", 2), metrics, 1, "new%03d", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Met || len(plan.Added) != 3 {
+		t.Errorf("Expected to give up after 3 servers: %+v", plan)
+	}
+
+	if _, err := PlanCapacity(makeTestRing("carbon", 2), metrics, 1, "new", 3); err == nil {
+		t.Errorf("Expected an error for a template that does not number servers")
+	}
+}
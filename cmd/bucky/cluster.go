@@ -1,19 +1,27 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"sort"
+	"strings"
+	"time"
 )
 
 import "github.com/jjneely/buckytools/hashing"
 
+// ErrClusterUnhealthy is returned by the functions placing metrics with
+// the cluster's hash ring when the cluster's hash rings are inconsistent.
+var ErrClusterUnhealthy = errors.New("Cluster is inconsistent. Use the servers command to investigate.")
+
 type ClusterConfig struct {
 	// Port is the port remote buckyd daemons listen on
 	Port string
 
 	// Servers is a list of all bucky server hostnames.  This does not
-	// include port information
+	// include port information.  Each server is listed once.
 	Servers []string
 
 	// Hash is a HashRing interface that implements the hashring algorithm
@@ -23,6 +31,16 @@ type ClusterConfig struct {
 	// Healthy is true if the cluster configuration represents a Healthy
 	// cluster
 	Healthy bool
+
+	// Rings holds the hash ring reported by each buckyd daemon that we
+	// could reach.  The first is the initial daemon we contacted, or the
+	// consensus ring after UseConsensus(), and is the ring Hash is built
+	// from.
+	Rings []*hashing.JSONRingType
+
+	// Errors holds the problems found while checking the health of the
+	// cluster.  See HealthReport().
+	Errors []error
 }
 
 // Cluster is the working and cached cluster configuration
@@ -41,90 +59,498 @@ func (c *ClusterConfig) HostPorts() []string {
 
 // GetClusterConfig returns either the cached ClusterConfig object or
 // builds it if needed.  The initial HOST:PORT of the buckyd daemon
-// must be given.
+// must be given.  If a ring file has been given with --ring-file the
+// cluster is built from that file instead and no buckyd daemons are
+// contacted.  In single host mode, -s, only the initial buckyd daemon is
+// queried and the cluster is assumed healthy.  The initial daemon may be
+// given as unix:/path/to/socket to reach it over a Unix domain socket.
+// The other members of the cluster are always reached over TCP, on port
+// 4242 in that case.
+//
+// The hostport may be a comma separated list of initial buckyd daemons, as
+// split by initialHosts().  They are tried in order and the cluster is
+// discovered from the first that responds.
+//
+// With --recheck, hash rings found to be inconsistent are fetched once more
+// after --recheck-delay and the cluster is judged on the second set.  This
+// avoids reporting a cluster unhealthy when a configuration reload lands
+// between fetching the rings of two hosts.
 func GetClusterConfig(hostport string) (*ClusterConfig, error) {
 	if Cluster != nil {
 		return Cluster, nil
 	}
+	hosts := initialHosts(hostport)
+	if RingFile != "" {
+		return getRingFileConfig(hosts[0])
+	}
+	if SingleHost {
+		return getSingleConfig(hosts)
+	}
 
-	master, err := GetSingleHashRing(hostport)
+	if _, _, err := net.SplitHostPort(hosts[0]); err != nil {
+		log.Printf("Abort: Invalid host:port representation: %s", hosts[0])
+		return nil, err
+	}
+
+	rings, port, hostErr, err := fetchRings(hosts)
 	if err != nil {
-		log.Printf("Abort: Cannot communicate with initial buckyd daemon.")
 		return nil, err
 	}
+	ringErrs := healthErrors(rings[0], rings[1:])
+	if Recheck && len(ringErrs) > 0 {
+		// A config push may have landed between fetching two hosts' rings
+		log.Printf("Hash rings are inconsistent, rechecking in %s", RecheckDelay)
+		time.Sleep(RecheckDelay)
+		again, againPort, againErr, err := fetchRings(hosts)
+		if err != nil {
+			return nil, err
+		}
+		if first, second := ringSummary(rings), ringSummary(again); first != second {
+			log.Printf("First hash rings: %s", first)
+			log.Printf("Rechecked hash rings: %s", second)
+		}
+		rings, port, hostErr = again, againPort, againErr
+		ringErrs = healthErrors(rings[0], rings[1:])
+		if len(ringErrs) == 0 {
+			log.Printf("Hash rings are consistent on recheck")
+		}
+	}
 
-	_, port, err := net.SplitHostPort(hostport)
+	Cluster, err = NewClusterConfig(port, rings)
 	if err != nil {
-		log.Printf("Abort: Invalid host:port representation: %s", hostport)
 		return nil, err
 	}
+	if hostErr != nil {
+		Cluster.Errors = append(Cluster.Errors, hostErr)
+	}
+	Cluster.Errors = append(Cluster.Errors, ringErrs...)
+	Cluster.Healthy = len(Cluster.Errors) == 0
+	return Cluster, nil
+}
+
+// fetchRings returns the GetRings() of the first of the given initial
+// buckyd daemons that responds and the port it was reached on.  The
+// hostErr joins the errors of the cluster members that could not be
+// reached.  An error is returned if no initial daemon responds.
+func fetchRings(hosts []string) (rings []*hashing.JSONRingType, port string, hostErr, err error) {
+	errs := make([]error, 0)
+	for _, h := range hosts {
+		rings, hostErr = GetRings(h)
+		if rings != nil {
+			if len(hosts) > 1 {
+				log.Printf("Hash ring served by %s", h)
+			}
+			_, port, _ = net.SplitHostPort(h)
+			return rings, port, hostErr, nil
+		}
+		log.Printf("Cannot communicate with buckyd daemon %s", h)
+		errs = append(errs, hostErr)
+	}
+
+	log.Printf("Abort: Cannot communicate with initial buckyd daemon.")
+	return nil, "", nil, errors.Join(errs...)
+}
+
+// ringSummary describes the given rings as a list of each ring's name and
+// the start of its fingerprint sorted by name.
+func ringSummary(rings []*hashing.JSONRingType) string {
+	result := make([]string, 0, len(rings))
+	for _, r := range rings {
+		result = append(result, fmt.Sprintf("%s=%.12s", r.Name, r.Fingerprint()))
+	}
+	sort.Strings(result)
+	return strings.Join(result, ", ")
+}
+
+// HostError is the error returned for a buckyd daemon that could not be
+// reached.
+type HostError struct {
+	// Server is the server name as found in the hash ring
+	Server string
+
+	// HostPort is the address of the daemon we tried
+	HostPort string
+
+	Err error
+}
+
+func (e *HostError) Error() string {
+	return fmt.Sprintf("%s: %s", e.HostPort, e.Err)
+}
+
+func (e *HostError) Unwrap() error {
+	return e.Err
+}
 
-	Cluster = new(ClusterConfig)
-	Cluster.Port = port
-	Cluster.Servers = make([]string, 0)
-	switch master.Algo {
-	case "carbon":
-		Cluster.Hash = hashing.NewCarbonHashRing()
-	case "fnv1a":
-		Cluster.Hash = hashing.NewFNV1aHashRing()
-	case "jump_fnv1a":
-		Cluster.Hash = hashing.NewJumpHashRing(master.Replicas)
-	default:
-		log.Printf("Unknown consistent hash algorithm: %s", master.Algo)
-		return nil, fmt.Errorf("Unknown consistent hash algorithm: %s", master.Algo)
+// GetRings fetches the hash ring from the initial buckyd daemon at hostport
+// and then from every other server in that ring.  The rings we could fetch
+// are returned with the initial daemon's ring first.  If the initial daemon
+// cannot be reached the returned slice is nil.  The error value joins the
+// errors from every daemon that could not be reached so that a single run
+// reports all of them.
+func GetRings(hostport string) ([]*hashing.JSONRingType, error) {
+	master, err := GetSingleHashRing(hostport)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", hostport, err)
 	}
 
-	for _, v := range master.Nodes {
-		Cluster.Hash.AddNode(v)
-		Cluster.Servers = append(Cluster.Servers, v.Server)
+	_, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return nil, err
 	}
 
-	members := make([]*hashing.JSONRingType, 0)
-	for _, srv := range Cluster.Servers {
-		if srv == master.Name {
+	rings := []*hashing.JSONRingType{master}
+	errs := make([]error, 0)
+	// Each server's buckyd serves the ring for all of its instances
+	for _, server := range hashing.NodeServers(master.Nodes) {
+		if server == master.Name {
 			// Don't query the initial daemon again
 			continue
 		}
-		host := fmt.Sprintf("%s:%s", srv, Cluster.Port)
+		host := fmt.Sprintf("%s:%s", server, port)
 		member, err := GetSingleHashRing(host)
 		if err != nil {
 			log.Printf("Cluster unhealthy: %s: %s", host, err)
+			errs = append(errs, &HostError{server, host, err})
+			continue
+		}
+		rings = append(rings, member)
+	}
+
+	return rings, errors.Join(errs...)
+}
+
+// initialHosts splits the comma separated list of initial buckyd daemons
+// given by -h or BUCKYHOST.  The first may be a unix:/path/to/socket.
+// Others given without a port use the port of the first.
+func initialHosts(hostport string) []string {
+	hosts := make([]string, 0)
+	port := ""
+	for _, h := range strings.Split(hostport, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if len(hosts) == 0 {
+			h = resolveHostPort(h)
+			_, port, _ = net.SplitHostPort(h)
+		} else if _, _, err := net.SplitHostPort(h); err != nil && port != "" {
+			h = net.JoinHostPort(h, port)
+		}
+		hosts = append(hosts, h)
+	}
+	if len(hosts) == 0 {
+		return []string{hostport}
+	}
+
+	return hosts
+}
+
+// getSingleConfig builds the cached ClusterConfig from the hash ring of
+// the first of the given buckyd daemons that responds, followed by the
+// --fallback-hosts, in order.  Buckyd serves one hash ring per host which
+// all carbon instances on that host share.  No other daemons are
+// contacted so the ring is not checked for consistency.
+func getSingleConfig(initial []string) (*ClusterConfig, error) {
+	_, port, err := net.SplitHostPort(initial[0])
+	if err != nil {
+		log.Printf("Abort: Invalid host:port representation: %s", initial[0])
+		return nil, err
+	}
+
+	hosts := append([]string{}, initial...)
+	for _, h := range strings.Split(FallbackHosts, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(h); err != nil {
+			h = net.JoinHostPort(h, port)
 		}
-		members = append(members, member)
+		hosts = append(hosts, h)
+	}
+
+	errs := make([]error, 0)
+	for _, h := range hosts {
+		ring, err := GetSingleHashRing(h)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", h, err))
+			continue
+		}
+		if Verbose || len(hosts) > 1 {
+			log.Printf("Hash ring served by %s", h)
+		}
+
+		_, port, _ = net.SplitHostPort(h)
+		Cluster, err = NewClusterConfig(port, []*hashing.JSONRingType{ring})
+		if err != nil {
+			return nil, err
+		}
+		Cluster.Healthy = true
+		return Cluster, nil
+	}
+
+	log.Printf("Abort: Cannot communicate with buckyd daemon %s.", strings.Join(hosts, ", "))
+	return nil, errors.Join(errs...)
+}
+
+// getRingFileConfig builds the cached ClusterConfig from the rings stored
+// in the --ring-file.  The rings must agree with each other for the
+// cluster to be considered healthy.  The port, if any, comes from the
+// given hostport.
+func getRingFileConfig(hostport string) (*ClusterConfig, error) {
+	rings, err := ReadRingFile(RingFile)
+	if err != nil {
+		log.Printf("Abort: Cannot read ring file %s: %s", RingFile, err)
+		return nil, err
+	}
+
+	_, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		port = ""
 	}
 
-	Cluster.Healthy = isHealthy(master, members)
+	Cluster, err = NewClusterConfig(port, rings)
+	if err != nil {
+		return nil, err
+	}
+	Cluster.Errors = consistencyErrors(rings[0], rings[1:])
+	Cluster.Healthy = len(Cluster.Errors) == 0
+	return Cluster, nil
+}
+
+// ParseRingSpec builds a hash ring with the given hashing algorithm and
+// replicas from the comma separated list of nodes in spec.  Each node is
+// in the HOST[:PORT][=INSTANCE] form buckyd takes on its command line.  An
+// error is returned for an empty or malformed node or a node given twice.
+func ParseRingSpec(spec, algo string, replicas int) (*hashing.JSONRingType, error) {
+	ring := &hashing.JSONRingType{
+		Algo:     algo,
+		Replicas: replicas,
+	}
+	seen := make(map[hashing.Node]bool)
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, fmt.Errorf("Empty node in ring %q", spec)
+		}
+		n, err := hashing.NewNodeParser(s)
+		if err == nil && n.Server == "" {
+			err = fmt.Errorf("No host given")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Malformed node %q in ring, expected HOST[:PORT][=INSTANCE]: %s", s, err)
+		}
+		if seen[n] {
+			return nil, fmt.Errorf("Node %s is given twice in ring", n)
+		}
+		seen[n] = true
+		ring.Nodes = append(ring.Nodes, n)
+	}
+	return ring, nil
+}
+
+// getRingSpecConfig builds the cached ClusterConfig from the ring given on
+// the command line, as parsed by ParseRingSpec(), without contacting any
+// buckyd daemons.  A single ring is always healthy.
+func getRingSpecConfig(spec, algo string, replicas int) (*ClusterConfig, error) {
+	ring, err := ParseRingSpec(spec, algo, replicas)
+	if err != nil {
+		log.Printf("Abort: %s", err)
+		return nil, err
+	}
+
+	Cluster, err = NewClusterConfig("", []*hashing.JSONRingType{ring})
+	if err != nil {
+		return nil, err
+	}
+	Cluster.Healthy = true
 	return Cluster, nil
 }
 
+// NewClusterConfig returns a ClusterConfig built from the given hash
+// rings with the first ring being authoritative.  The Healthy field is
+// left for the caller to determine.
+func NewClusterConfig(port string, rings []*hashing.JSONRingType) (*ClusterConfig, error) {
+	hr, err := buildHashRing(rings)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(ClusterConfig)
+	c.Port = port
+	c.Hash = hr
+	c.Rings = rings
+	c.Servers = hashing.Servers(hr)
+
+	return c, nil
+}
+
+// buildHashRing constructs a HashRing from the first of the given rings
+// using its hashing algorithm and node list.  Algorithms are looked up in
+// the hashing package registry so embedders may add their own with
+// hashing.RegisterHashRing().
+func buildHashRing(rings []*hashing.JSONRingType) (hashing.HashRing, error) {
+	if len(rings) == 0 {
+		log.Printf("No hash ring data to build a hash ring from.")
+		return nil, fmt.Errorf("No hash ring data")
+	}
+
+	master := rings[0]
+	hr, err := hashing.NewHashRing(master.Algo, master.Replicas)
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+
+	hr.AddNodes(master.Nodes)
+	return hr, nil
+}
+
 // isHealthy will return true if the cluster ring data represents
 // a healthy cluster.  The master is the initial buckyd daemon we
 // built the list from.  The ring is a slice of ring objects from each
 // server in the cluster except the initial buckyd daemon.
 func isHealthy(master *hashing.JSONRingType, ring []*hashing.JSONRingType) bool {
+	return len(healthErrors(master, ring)) == 0
+}
+
+// healthErrors returns an error for each problem that makes the cluster
+// ring data unhealthy.  The arguments are the same as isHealthy().
+func healthErrors(master *hashing.JSONRingType, ring []*hashing.JSONRingType) []error {
 	// XXX: Take replicas into account
 	// The initial buckyd daemon isn't in the ring, so we need to add 1
-	// to the length.
-	if len(master.Nodes) != len(ring)+1 {
-		return false
+	// to the length.  Each server reports one ring however many
+	// instances it runs.
+	errs := consistencyErrors(master, ring)
+	servers := len(hashing.NodeServers(master.Nodes))
+	if servers != len(ring)+1 {
+		errs = append(errs, fmt.Errorf("Expected %d hash rings from the cluster, found %d",
+			servers, len(ring)+1))
 	}
 
+	return errs
+}
+
+// consistencyErrors returns an error naming each ring in the given slice
+// that does not use the same algorithm and nodes as the master ring.
+func consistencyErrors(master *hashing.JSONRingType, ring []*hashing.JSONRingType) []error {
+	errs := make([]error, 0)
+
 	// We compare each ring to the first one
 	for _, v := range ring {
-		// Order, host:instance pair, must be the same.  You configured
+		// The host:instance pairs must be the same.  You configured
 		// your cluster with a CM tool, right?
 		if master.Algo != v.Algo {
-			return false
+			errs = append(errs, fmt.Errorf("%s: Hashing algorithm %s does not match %s on %s",
+				v.Name, v.Algo, master.Algo, master.Name))
+			continue
 		}
-		if len(v.Nodes) != len(master.Nodes) {
-			return false
+		// Jump hash assigns metrics to buckets by position so only there
+		// does the order of the nodes matter.
+		if !nodesEqual(master.Nodes, v.Nodes, master.Algo == "jump_fnv1a") {
+			errs = append(errs, fmt.Errorf("%s: Hash ring nodes do not match %s",
+				v.Name, master.Name))
 		}
-		for i, v := range v.Nodes {
-			if !hashing.NodeCmp(master.Nodes[i], v) {
-				return false
-			}
+	}
+
+	return errs
+}
+
+// nodesEqual returns true if both slices hold the same Nodes.  If ordered
+// is true the Nodes must also be in the same order.
+func nodesEqual(a, b []hashing.Node, ordered bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if !ordered {
+		a = append([]hashing.Node{}, a...)
+		b = append([]hashing.Node{}, b...)
+		hashing.SortNodes(a)
+		hashing.SortNodes(b)
+	}
+	for i := range a {
+		if !hashing.NodeCmp(a[i], b[i]) {
+			return false
 		}
 	}
 
 	return true
 }
+
+// consensusRings splits the given rings into those that agree with the
+// largest group of rings sharing the same hashing algorithm, replicas, and
+// nodes and those that dissent.  An error is returned if no single group
+// is larger than every other.
+func consensusRings(rings []*hashing.JSONRingType) (agree, dissent []*hashing.JSONRingType, err error) {
+	groups := make(map[string][]*hashing.JSONRingType)
+	order := make([]string, 0)
+	for _, r := range rings {
+		fp := r.Fingerprint()
+		if _, ok := groups[fp]; !ok {
+			order = append(order, fp)
+		}
+		groups[fp] = append(groups[fp], r)
+	}
+
+	best, tied := "", false
+	for _, fp := range order {
+		switch {
+		case best == "" || len(groups[fp]) > len(groups[best]):
+			best, tied = fp, false
+		case len(groups[fp]) == len(groups[best]):
+			tied = true
+		}
+	}
+	if best == "" || tied {
+		return nil, nil, fmt.Errorf("No hash ring is reported by more hosts than any other")
+	}
+
+	for _, fp := range order {
+		if fp == best {
+			agree = groups[fp]
+		} else {
+			dissent = append(dissent, groups[fp]...)
+		}
+	}
+	return agree, dissent, nil
+}
+
+// UseConsensus rebuilds the cluster's hash ring from the ring that the
+// most reachable buckyd daemons agree on and marks the cluster healthy.  A
+// warning names the dissenting daemons.  The Errors found while checking
+// the health of the cluster are kept for HealthReport().
+func (c *ClusterConfig) UseConsensus() error {
+	agree, dissent, err := consensusRings(c.Rings)
+	if err != nil {
+		return err
+	}
+
+	hr, err := buildHashRing(agree)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(dissent))
+	for _, r := range dissent {
+		names = append(names, r.Name)
+	}
+	log.Printf("Warning: Using the hash ring %d of %d reachable hosts agree on.",
+		len(agree), len(c.Rings))
+	if len(names) > 0 {
+		log.Printf("Warning: Dissenting hosts: %s", strings.Join(names, ", "))
+	}
+
+	c.Hash = hr
+	c.Servers = hashing.Servers(hr)
+	c.Rings = append(agree, dissent...)
+	c.Healthy = true
+	return nil
+}
+
+// HealthReport returns nil if the cluster is healthy.  Otherwise the
+// returned error joins every problem found: each buckyd daemon that could
+// not be reached and each daemon whose hash ring does not match.
+func (c *ClusterConfig) HealthReport() error {
+	return errors.Join(c.Errors...)
+}
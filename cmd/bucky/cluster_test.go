@@ -0,0 +1,268 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// makeTestRing returns a JSONRingType with the given number of servers
+// each with two instances.
+func makeTestRing(algo string, servers int) *hashing.JSONRingType {
+	ring := &hashing.JSONRingType{
+		Name:     "graphite000",
+		Algo:     algo,
+		Replicas: 1,
+	}
+	for i := 0; i < servers; i++ {
+		server := fmt.Sprintf("graphite%03d", i)
+		ring.Nodes = append(ring.Nodes,
+			hashing.NewNode(server, 2003, "a"),
+			hashing.NewNode(server, 2004, "b"))
+	}
+
+	return ring
+}
+
+func BenchmarkBuildHashRing(b *testing.B) {
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		rings := []*hashing.JSONRingType{makeTestRing(algo, 1000)}
+		b.Run(algo, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := buildHashRing(rings); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestConsistencyNodeOrder(t *testing.T) {
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		master := makeTestRing(algo, 4)
+		other := makeTestRing(algo, 4)
+		other.Name = "graphite001"
+		for i, j := 0, len(other.Nodes)-1; i < j; i, j = i+1, j-1 {
+			other.Nodes[i], other.Nodes[j] = other.Nodes[j], other.Nodes[i]
+		}
+
+		errs := consistencyErrors(master, []*hashing.JSONRingType{other})
+		if algo == "jump_fnv1a" {
+			if len(errs) == 0 {
+				t.Errorf("%s: Reordered nodes judged consistent", algo)
+			}
+		} else if len(errs) != 0 {
+			t.Errorf("%s: Reordered nodes judged inconsistent: %v", algo, errs)
+		}
+
+		other.Nodes[0].Instance = "z"
+		if len(consistencyErrors(master, []*hashing.JSONRingType{other})) == 0 {
+			t.Errorf("%s: Differing nodes judged consistent", algo)
+		}
+	}
+}
+
+func TestConsensusRings(t *testing.T) {
+	rings := make([]*hashing.JSONRingType, 0)
+	for i := 0; i < 3; i++ {
+		r := makeTestRing("fnv1a", 3)
+		r.Name = fmt.Sprintf("graphite%03d", i)
+		rings = append(rings, r)
+	}
+	rings[0].Nodes = rings[0].Nodes[1:]
+
+	agree, dissent, err := consensusRings(rings)
+	if err != nil {
+		t.Fatalf("consensusRings returned error: %s", err)
+	}
+	if len(agree) != 2 || agree[0].Name != "graphite001" || agree[1].Name != "graphite002" {
+		t.Errorf("consensusRings agreed on the wrong rings: %v", agree)
+	}
+	if len(dissent) != 1 || dissent[0].Name != "graphite000" {
+		t.Errorf("consensusRings dissent is wrong: %v", dissent)
+	}
+
+	if _, _, err := consensusRings(rings[:2]); err == nil {
+		t.Errorf("consensusRings found a consensus between two differing rings")
+	}
+}
+
+// TestHealthErrorsInstances checks that a server running several instances
+// is expected to report a single hash ring.
+func TestHealthErrorsInstances(t *testing.T) {
+	master := makeTestRing("carbon", 3)
+	rings := make([]*hashing.JSONRingType, 0)
+	for i := 1; i < 3; i++ {
+		r := makeTestRing("carbon", 3)
+		r.Name = fmt.Sprintf("graphite%03d", i)
+		rings = append(rings, r)
+	}
+
+	if errs := healthErrors(master, rings); len(errs) != 0 {
+		t.Errorf("healthErrors reported a healthy cluster as unhealthy: %v", errs)
+	}
+	if errs := healthErrors(master, rings[:1]); len(errs) != 1 {
+		t.Errorf("healthErrors did not report a missing ring: %v", errs)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bucky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "buckyd.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := makeTestRing("carbon", 2)
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ring)
+	}))
+	defer l.Close()
+
+	SingleHost = true
+	defer func() { Cluster, SingleHost, UnixSocket = nil, false, "" }()
+	c, err := GetClusterConfig("unix:" + sock)
+	if err != nil {
+		t.Fatalf("GetClusterConfig over a Unix socket returned error: %s", err)
+	}
+	if !nodesEqual(c.Rings[0].Nodes, ring.Nodes, true) || c.Port != "4242" {
+		t.Errorf("GetClusterConfig over a Unix socket built %v on port %s", c.Rings[0], c.Port)
+	}
+}
+
+func TestGzipHashRing(t *testing.T) {
+	ring := makeTestRing("carbon", 100)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("Client did not accept gzip: %q", r.Header.Get("Accept-Encoding"))
+			json.NewEncoder(w).Encode(ring)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		json.NewEncoder(gz).Encode(ring)
+		gz.Close()
+	}))
+	defer ts.Close()
+
+	result, err := GetSingleHashRing(strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nodesEqual(result.Nodes, ring.Nodes, true) {
+		t.Errorf("GetSingleHashRing() decoded a different gzip compressed ring")
+	}
+}
+
+func TestInitialHosts(t *testing.T) {
+	data := map[string][]string{
+		"graphite010:4242":                  {"graphite010:4242"},
+		"graphite010:4242, graphite011,":    {"graphite010:4242", "graphite011:4242"},
+		"graphite010:4242,graphite011:4343": {"graphite010:4242", "graphite011:4343"},
+		"graphite010, graphite011":          {"graphite010", "graphite011"},
+		"":                                  {""},
+	}
+	for hostport, expected := range data {
+		if hosts := initialHosts(hostport); !reflect.DeepEqual(hosts, expected) {
+			t.Errorf("initialHosts(%q) returned %v, rather than %v", hostport, hosts, expected)
+		}
+	}
+}
+
+// TestRecheck checks that --recheck fetches the hash rings again and judges
+// the cluster on the second set, as when a config push lands between
+// fetching the rings of two hosts.
+func TestRecheck(t *testing.T) {
+	var lock sync.Mutex
+	pushed := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.Host)
+		ring := &hashing.JSONRingType{Name: host, Algo: "carbon", Replicas: 1}
+		ring.Nodes = []hashing.Node{
+			hashing.NewNode("127.0.0.1", 2003, ""),
+			hashing.NewNode("localhost", 2003, ""),
+		}
+
+		// localhost has yet to see the config push on its first fetch
+		lock.Lock()
+		if host == "localhost" && !pushed {
+			pushed = true
+			ring.Algo = "fnv1a"
+		}
+		lock.Unlock()
+		json.NewEncoder(w).Encode(ring)
+	}))
+	defer ts.Close()
+	hostport := strings.TrimPrefix(ts.URL, "http://")
+
+	delay := RecheckDelay
+	defer func() { Cluster, Recheck, RecheckDelay = nil, false, delay }()
+	c, err := GetClusterConfig(hostport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Healthy {
+		t.Errorf("Inconsistent hash rings were reported healthy without --recheck")
+	}
+
+	Cluster, Recheck, RecheckDelay, pushed = nil, true, 0, false
+	c, err = GetClusterConfig(hostport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Healthy || len(c.Rings) != 2 {
+		t.Errorf("Hash rings consistent on recheck were reported unhealthy: %v", c.Errors)
+	}
+}
+
+func TestParseRingSpec(t *testing.T) {
+	ring, err := ParseRingSpec("server1=a, server2:2004=b,server3", "fnv1a", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []hashing.Node{
+		hashing.NewNode("server1", 0, "a"),
+		hashing.NewNode("server2", 2004, "b"),
+		hashing.NewNode("server3", 0, ""),
+	}
+	if ring.Algo != "fnv1a" || ring.Replicas != 2 || !reflect.DeepEqual(ring.Nodes, expected) {
+		t.Errorf("ParseRingSpec() returned %+v", ring)
+	}
+
+	bad := []string{"", "server1,,server2", "server1:a", "=a", "server1,server1", "server1=a=b"}
+	for _, spec := range bad {
+		if _, err := ParseRingSpec(spec, "carbon", 1); err == nil {
+			t.Errorf("ParseRingSpec(%q) did not return an error", spec)
+		}
+	}
+
+	defer func() { Cluster = nil }()
+	c, err := getRingSpecConfig("server1=a,server2=b", "carbon", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Healthy || c.Hash.Len() != 2 || len(c.Servers) != 2 {
+		t.Errorf("getRingSpecConfig() returned %+v", c)
+	}
+	Cluster = nil
+	if _, err := getRingSpecConfig("server1", "bogus", 1); err == nil {
+		t.Errorf("getRingSpecConfig() accepted an unknown hashing algorithm")
+	}
+}
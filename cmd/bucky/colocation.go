@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// ringReplicas returns the number of replicas of each metric the cluster
+// is configured for, as buckyd advertises in its hash ring.  This is not
+// Cluster.Hash.Replicas(), which the carbon and fnv1a rings use for the
+// number of points of each node on the ring.
+func ringReplicas() int {
+	if len(Cluster.Rings) == 0 || Cluster.Rings[0].Replicas < 1 {
+		return 1
+	}
+	return Cluster.Rings[0].Replicas
+}
+
+// replicaNodes returns the given number of replica nodes of each metric,
+// or the hash ring's replicas if n is 0.  We warn if the ring has fewer
+// nodes than that and return every node.  ErrClusterUnhealthy is returned
+// if the cluster is not healthy.
+func replicaNodes(metrics []string, n int) (map[string][]hashing.Node, error) {
+	if !Cluster.Healthy {
+		return nil, ErrClusterUnhealthy
+	}
+	if n == 0 {
+		n = ringReplicas()
+	}
+	if nodes := Cluster.Hash.Len(); n > nodes {
+		log.Printf("Warning: %d replicas requested but the hash ring has only %d nodes, reporting %d",
+			n, nodes, nodes)
+		n = nodes
+	}
+
+	result := make(map[string][]hashing.Node, len(metrics))
+	for _, m := range metrics {
+		result[m] = Cluster.Hash.GetNodes(locateKey(m), n)
+	}
+	return result, nil
+}
+
+// ColocatedMetrics returns a map of metric => replica nodes for each of
+// the given metrics whose n replicas, as for replicaNodes(), are not each
+// on a distinct server.
+func ColocatedMetrics(metrics []string, n int) (map[string][]string, error) {
+	replicas, err := replicaNodes(metrics, n)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]string)
+	for m, nodes := range replicas {
+		servers := make(map[string]bool, len(nodes))
+		names := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			servers[node.Server] = true
+			names = append(names, node.String())
+		}
+		if len(servers) < len(nodes) {
+			result[m] = names
+		}
+	}
+
+	log.Printf("%d of %d metrics have replicas sharing a server", len(result), len(metrics))
+	return result, nil
+}
+
+// writeColocated writes the map of metric => replica nodes to w sorted by
+// metric in the form "metric => node1, node2".  JSON is written if
+// JSONOutput is set.
+func writeColocated(w io.Writer, list map[string][]string) error {
+	if JSONOutput {
+		return WriteJSON(w, list)
+	}
+
+	keys := make([]string, 0, len(list))
+	for m := range list {
+		keys = append(keys, m)
+	}
+	sort.Strings(keys)
+	for _, m := range keys {
+		if _, err := fmt.Fprintf(w, "%s => %s\n", m, strings.Join(list[m], ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplicaHosts returns a map of metric => the distinct hosts, as named by
+// nodeName(), of the metric's replica nodes as found by replicaNodes().
+// The hosts are in ring order so the first is the metric's primary.
+func ReplicaHosts(metrics []string, n int) (map[string][]string, error) {
+	replicas, err := replicaNodes(metrics, n)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]string, len(metrics))
+	for m, nodes := range replicas {
+		hosts := make([]string, 0, len(nodes))
+		seen := make(map[string]bool, len(nodes))
+		for _, node := range nodes {
+			if host := nodeName(node); !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, host)
+			}
+		}
+		result[m] = hosts
+	}
+	return result, nil
+}
+
+// writeReplicaHosts writes the map of metric => replica hosts to w sorted
+// by metric in the form "metric => host1,host2".  JSON is written if
+// JSONOutput is set.
+func writeReplicaHosts(w io.Writer, list map[string][]string) error {
+	if JSONOutput {
+		return WriteJSON(w, list)
+	}
+
+	keys := make([]string, 0, len(list))
+	for m := range list {
+		keys = append(keys, m)
+	}
+	sort.Strings(keys)
+	for _, m := range keys {
+		if _, err := fmt.Fprintf(w, "%s => %s\n", m, strings.Join(list[m], ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
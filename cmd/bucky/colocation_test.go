@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestColocatedMetrics(t *testing.T) {
+	ring := makeTestRing("carbon", 3)
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{ring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	defer func() { Cluster = nil }()
+
+	metrics := make([]string, 0)
+	for i := 0; i < 200; i++ {
+		metrics = append(metrics, fmt.Sprintf("foo.bar.metric%d", i))
+	}
+
+	// A single replica is never colocated
+	if list, err := ColocatedMetrics(metrics, 1); err != nil || len(list) != 0 {
+		t.Errorf("ColocatedMetrics() with 1 replica returned %v", list)
+	}
+
+	// Each server runs 2 instances so 4 replicas cannot land on 4 servers
+	list, err := ColocatedMetrics(metrics, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != len(metrics) {
+		t.Errorf("ColocatedMetrics() with 4 replicas returned %d of %d metrics",
+			len(list), len(metrics))
+	}
+
+	list, err = ColocatedMetrics(metrics, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range metrics {
+		nodes := Cluster.Hash.GetNodes(m, 2)
+		if _, ok := list[m]; ok != (nodes[0].Server == nodes[1].Server) {
+			t.Errorf("%s on %v reported colocated %v", m, nodes, ok)
+		}
+	}
+	if len(list) == 0 || len(list) == len(metrics) {
+		t.Errorf("ColocatedMetrics() with 2 replicas returned %d of %d metrics",
+			len(list), len(metrics))
+	}
+}
+
+func TestReplicaHosts(t *testing.T) {
+	ring := makeTestRing("carbon", 3)
+	ring.Replicas = 2
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{ring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	defer func() { Cluster = nil }()
+
+	metrics := []string{"foo.bar.metric1", "foo.bar.metric2", "foo.bar.metric3"}
+	for _, m := range metrics {
+		list, err := ReplicaHosts([]string{m}, 1)
+		if hosts := list[m]; err != nil || len(hosts) != 1 || hosts[0] != Cluster.Hash.GetNode(m).Server {
+			t.Errorf("ReplicaHosts() of 1 replica of %s returned %v, %v", m, hosts, err)
+		}
+	}
+
+	list, err := ReplicaHosts(metrics, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range metrics {
+		nodes := Cluster.Hash.GetNodes(m, 2)
+		hosts := list[m]
+		if hosts[0] != nodes[0].Server {
+			t.Errorf("ReplicaHosts() of %s returned %v, primary is %s", m, hosts, nodes[0].Server)
+		}
+		if nodes[0].Server == nodes[1].Server && len(hosts) != 1 {
+			t.Errorf("ReplicaHosts() of %s on %v repeated a host: %v", m, nodes, hosts)
+		} else if nodes[0].Server != nodes[1].Server && len(hosts) != 2 {
+			t.Errorf("ReplicaHosts() of %s on %v returned %v", m, nodes, hosts)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	list = map[string][]string{
+		"foo.b": {"graphite001", "graphite000"},
+		"foo.a": {"graphite002"},
+	}
+	if err := writeReplicaHosts(buf, list); err != nil {
+		t.Fatal(err)
+	}
+	expected := "foo.a => graphite002\nfoo.b => graphite001,graphite000\n"
+	if buf.String() != expected {
+		t.Errorf("writeReplicaHosts() wrote %q rather than %q", buf, expected)
+	}
+}
+
+func TestConsistentServers(t *testing.T) {
+	ring := makeTestRing("carbon", 4)
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{ring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	defer func() { Cluster = nil }()
+
+	for i := 0; i < 100; i++ {
+		m := fmt.Sprintf("foo.bar.metric%d", i)
+		primary := Cluster.Hash.GetNode(m).Server
+
+		// The ring's single replica is only the primary
+		if servers := consistentServers(m, 0); len(servers) != 1 || servers[0] != primary {
+			t.Errorf("consistentServers(%s, 0) returned %v rather than %s", m, servers, primary)
+		}
+
+		servers := consistentServers(m, 3)
+		if servers[0] != primary {
+			t.Errorf("consistentServers(%s, 3) returned %v, primary is %s", m, servers, primary)
+		}
+		for _, n := range Cluster.Hash.GetNodes(m, 3) {
+			if !containsString(servers, n.Server) {
+				t.Errorf("consistentServers(%s, 3) returned %v without %s", m, servers, n.Server)
+			}
+		}
+		if len(consistentServers(m, 100)) > 4 {
+			t.Errorf("consistentServers(%s, 100) returned more than every server", m)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
@@ -11,6 +13,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 )
 
 import "github.com/golang/snappy"
@@ -29,17 +32,67 @@ var NoEncoding bool
 // Verbose is a flag to indicate verbose logging
 var Verbose bool
 
+// MaxIdleConnsPerHost is the number of idle keep-alive connections we
+// hold open to each buckyd daemon.  This should be at least the number of
+// concurrent workers talking to a single host.
+var MaxIdleConnsPerHost int
+
+// IdleConnTimeout is how long an idle keep-alive connection is held open
+// before it is closed.
+var IdleConnTimeout time.Duration
+
+// NoKeepAlive disables HTTP keep-alives so that each request uses a new
+// connection.
+var NoKeepAlive bool
+
+// unixSocketHost is the HOST:PORT that stands in for a buckyd daemon given
+// as -h unix:/path/to/socket.  Connections to it are dialed to UnixSocket.
+const unixSocketHost = "unix.socket:4242"
+
+// UnixSocket is the path of the Unix domain socket of the initial buckyd
+// daemon if one was given with -h unix:/path/to/socket.
+var UnixSocket string
+
+// resolveHostPort returns the HOST:PORT used to reach the given buckyd
+// daemon.  A daemon given as unix:/path/to/socket is recorded in
+// UnixSocket and reached through unixSocketHost.
+func resolveHostPort(hostport string) string {
+	if !strings.HasPrefix(hostport, "unix:") {
+		return hostport
+	}
+	UnixSocket = strings.TrimPrefix(hostport, "unix:")
+	return unixSocketHost
+}
+
 // httpClient is a cached http.Client. Use GetHTTP() to setup and return.
 var httpClient *http.Client
 
 // GetHTTP returns a *http.Client that can be used to interact with remote
-// buckyd daemons.
+// buckyd daemons.  All requests share a single http.Transport so that
+// connections to each daemon are reused across requests.
 func GetHTTP() *http.Client {
 	if httpClient != nil {
 		return httpClient
 	}
 
-	httpClient = new(http.Client)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if UnixSocket != "" && addr == unixSocketHost {
+			return dialer.DialContext(ctx, "unix", UnixSocket)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	// Ask for gzip compressed responses, which the transport decompresses,
+	// unless --no-encoding is given.  HTTP/2 is negotiated over TLS.
+	transport.DisableCompression = NoEncoding
+	transport.ForceAttemptHTTP2 = true
+	transport.DisableKeepAlives = NoKeepAlive
+	transport.MaxIdleConnsPerHost = MaxIdleConnsPerHost
+	transport.MaxIdleConns = 0
+	transport.IdleConnTimeout = IdleConnTimeout
+
+	httpClient = &http.Client{Transport: transport}
 
 	// Set a 30 second timeout on all operations
 	//httpClient.Timeout = 30 * time.Second
@@ -220,6 +273,10 @@ func GetMetricData(server, name string) (*MetricData, error) {
 		log.Printf("Error reading response body: %s", err)
 		return nil, err
 	}
+	if err := verifyChecksum(data); err != nil {
+		log.Printf("Error: Fetching [%s]:%s: %s", server, name, err)
+		return nil, err
+	}
 
 	return data, nil
 }
@@ -323,8 +380,9 @@ func PostMetric(server string, metric *MetricData) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		msg := fmt.Sprintf("Error reported by server: %s for metric %s",
-			resp.Status, metric.Name)
+		body, _ := ioutil.ReadAll(resp.Body)
+		msg := fmt.Sprintf("Error reported by server: %s for metric %s: %s",
+			resp.Status, metric.Name, strings.TrimSpace(string(body)))
 		log.Printf("%s", msg)
 		return fmt.Errorf("%s", msg)
 	}
@@ -384,6 +442,13 @@ func SetupCommon(c Command) {
 		"Verbose log output.")
 	c.Flag.BoolVar(&NoEncoding, "no-encoding", false,
 		"Disable Content-Encoding methods for HTTP API calls.")
+	c.Flag.IntVar(&MaxIdleConnsPerHost, "max-idle-conns", 16,
+		"Idle keep-alive connections to hold open to each buckyd daemon.")
+	c.Flag.DurationVar(&IdleConnTimeout, "idle-timeout", 90*time.Second,
+		"Close idle keep-alive connections after this long.")
+	c.Flag.BoolVar(&NoKeepAlive, "no-keepalive", false,
+		"Disable HTTP keep-alives and use a new connection per request.")
+	SetupConfig(c)
 }
 
 // SetupHostname sets up a generic find the host to connect to flag
@@ -396,19 +461,37 @@ func SetupHostname(c Command) {
 	}
 
 	c.Flag.StringVar(&HostPort, "h", host,
-		"HOST:PORT to find a remote buckyd daemon. Port is optional.")
+		"HOST:PORT or unix:/path/to/socket to find a buckyd daemon, or a comma separated list to try in order. Port is optional.")
 	c.Flag.StringVar(&HostPort, "host", host,
-		"HOST:PORT to find a remote buckyd daemon. Port is optional.")
+		"HOST:PORT or unix:/path/to/socket to find a buckyd daemon, or a comma separated list to try in order. Port is optional.")
+	c.Flag.BoolVar(&Recheck, "recheck", false,
+		"Fetch inconsistent hash rings again before reporting the cluster unhealthy.")
+	c.Flag.DurationVar(&RecheckDelay, "recheck-delay", 2*time.Second,
+		"How long --recheck waits before fetching the hash rings again.")
 }
 
+// Recheck is set by --recheck, installed by SetupHostname(), and has
+// GetClusterConfig() fetch inconsistent hash rings a second time.
+var Recheck bool
+
+// RecheckDelay is how long --recheck waits before fetching again.
+var RecheckDelay time.Duration
+
 // SingleHost is a convenience variable for sub-commands.  A sub-command
 // must call SetupSingle() from their init() to enable.  This is true if
 // -s or --single is present and restricts the operation to the original
 // host and not the entire cluster.
 var SingleHost bool
 
-// SetupSingle sets up the -s|--single command flag
+// FallbackHosts is a comma separated list of HOST[:PORT] buckyd daemons
+// that single host mode tries in order if the initial host cannot be
+// reached.  Set by SetupSingle().
+var FallbackHosts string
+
+// SetupSingle sets up the -s|--single and --fallback-hosts command flags
 func SetupSingle(c Command) {
+	c.Flag.StringVar(&FallbackHosts, "fallback-hosts", "",
+		"With -s, comma separated HOST:PORT list to try if the host is down.")
 	c.Flag.BoolVar(&SingleHost, "s", false,
 		"Operate on the given hostname only, do not discover the cluster members.")
 	c.Flag.BoolVar(&SingleHost, "single", false,
@@ -420,12 +503,30 @@ func SetupSingle(c Command) {
 // --json flags are present and the command should dump out JSON encoded data.
 var JSONOutput bool
 
-// SetupJSON installs the -j and --json flags in the given Command
+// JSONIndent is set by the --json-indent flag installed by SetupJSON() and
+// makes JSON output human readable rather than compact.
+var JSONIndent bool
+
+// SetupJSON installs the -j, --json, and --json-indent flags in the given
+// Command
 func SetupJSON(c Command) {
 	c.Flag.BoolVar(&JSONOutput, "j", false,
 		"Instead of text ouput JSON encoded data.")
 	c.Flag.BoolVar(&JSONOutput, "json", false,
 		"Instead of text ouput JSON encoded data.")
+	c.Flag.BoolVar(&JSONIndent, "json-indent", false,
+		"Indent JSON output with two spaces for readability.")
+}
+
+// WriteJSON writes the JSON encoding of v followed by a newline to w.  The
+// output is compact unless --json-indent is set.  Nothing is written if v
+// cannot be encoded.
+func WriteJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	if JSONIndent {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
 }
 
 // CleanMetric sanitizes the given metric key by removing adjacent "."
@@ -447,3 +548,15 @@ func CleanMetric(m string) string {
 
 	return m
 }
+
+// StringList is a flag.Value that collects each use of a repeatable flag.
+type StringList []string
+
+func (s *StringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *StringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
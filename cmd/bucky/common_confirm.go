@@ -44,6 +44,45 @@ func askForConfirmation(prompt string) bool {
 	}
 }
 
+// assumeYes skips placement confirmation prompts.  Set by SetupConfirm().
+var assumeYes bool
+
+// SetupConfirm installs the --yes flag for commands that confirm where
+// they will write metrics before doing so.
+func SetupConfirm(c Command) {
+	c.Flag.BoolVar(&assumeYes, "yes", false,
+		"Do not ask to confirm where metrics will be written.")
+}
+
+// haveTTY returns true if there is a terminal to ask for confirmation on.
+func haveTTY() bool {
+	console, err := os.Open("/dev/tty")
+	if err != nil {
+		return false
+	}
+	console.Close()
+	return true
+}
+
+// needConfirmation returns true if we should ask the user to confirm
+// where metrics will be written: --yes was not given and we have a TTY.
+func needConfirmation() bool {
+	return !assumeYes && haveTTY()
+}
+
+// confirmPlacement prints the number of metrics that will be written to
+// each destination server in the map of server => count and asks the user
+// to confirm.  It returns true if the user agrees.
+func confirmPlacement(dests map[string]int) bool {
+	total := 0
+	for _, server := range sortedHosts(dests) {
+		fmt.Printf("%d metrics => %s\n", dests[server], server)
+		total += dests[server]
+	}
+	msg := fmt.Sprintf("Writing %d metrics to %d servers: Please Confirm:", total, len(dests))
+	return askForConfirmation(msg)
+}
+
 // You might want to put the following two functions in a separate utility package.
 
 // posString returns the first index of element in slice.
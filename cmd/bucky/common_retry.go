@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+import . "github.com/jjneely/buckytools/metrics"
+
+// transferRetries is the number of times a failed metric transfer is
+// retried.  Set by SetupRetries().
+var transferRetries int
+
+var failedLock sync.Mutex
+var failedTransfers []string
+
+// SetupRetries installs the --retries flag for commands that transfer
+// Whisper DBs to buckyd daemons.
+func SetupRetries(c Command) {
+	c.Flag.IntVar(&transferRetries, "retries", 2,
+		"Retry a metric transfer that fails or does not verify this many times.")
+}
+
+// verifyChecksum returns an error if the metric carries a checksum that
+// its decoded data does not match, as when the data is truncated or
+// corrupted in transit.
+func verifyChecksum(metric *MetricData) error {
+	if metric.Checksum == "" {
+		return nil
+	}
+	data, err := MetricDecode(metric)
+	if err != nil {
+		return err
+	}
+	if sum := Checksum(data); sum != metric.Checksum {
+		return fmt.Errorf("Checksum of %s data received %s does not match %s",
+			metric.Name, sum, metric.Checksum)
+	}
+	return nil
+}
+
+// retryTransfer calls transfer until it succeeds or has been retried
+// --retries times.  A metric that still fails is recorded for
+// logFailedTransfers() and the last error is returned.
+func retryTransfer(metric string, transfer func() error) error {
+	var err error
+	for i := 0; i <= transferRetries; i++ {
+		if i > 0 {
+			log.Printf("Retrying %s, attempt %d of %d", metric, i+1, transferRetries+1)
+		}
+		if err = transfer(); err == nil {
+			return nil
+		}
+	}
+
+	failedLock.Lock()
+	defer failedLock.Unlock()
+	failedTransfers = append(failedTransfers, metric)
+	return err
+}
+
+// logFailedTransfers logs the metrics that failed every attempt of
+// retryTransfer() and returns an error if there are any.
+func logFailedTransfers() error {
+	failedLock.Lock()
+	defer failedLock.Unlock()
+	if len(failedTransfers) == 0 {
+		return nil
+	}
+
+	sort.Strings(failedTransfers)
+	log.Printf("Error: %d metrics failed to transfer after %d attempts: %s",
+		len(failedTransfers), transferRetries+1, strings.Join(failedTransfers, ", "))
+	return fmt.Errorf("%d metrics failed to transfer", len(failedTransfers))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+import . "github.com/jjneely/buckytools/metrics"
+
+func TestVerifyChecksum(t *testing.T) {
+	data := []byte("whisper header and archives")
+	metric := &MetricData{Name: "foo.bar", Size: int64(len(data)), Data: data}
+	if err := verifyChecksum(metric); err != nil {
+		t.Errorf("verifyChecksum rejected data without a checksum: %s", err)
+	}
+
+	metric.Checksum = Checksum(data)
+	if err := MetricEncode(metric, EncSnappy); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyChecksum(metric); err != nil {
+		t.Errorf("verifyChecksum rejected matching snappy encoded data: %s", err)
+	}
+
+	metric = &MetricData{Name: "foo.bar", Size: int64(len(data)), Data: data,
+		Checksum: Checksum(data[1:])}
+	if err := verifyChecksum(metric); err == nil {
+		t.Errorf("verifyChecksum accepted data not matching its checksum")
+	}
+}
+
+func TestRetryTransfer(t *testing.T) {
+	defer func(r int) { transferRetries, failedTransfers = r, nil }(transferRetries)
+	transferRetries = 2
+
+	calls := 0
+	err := retryTransfer("foo.bar", func() error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("Checksum mismatch")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("retryTransfer returned %v after %d calls", err, calls)
+	}
+	if err := logFailedTransfers(); err != nil {
+		t.Errorf("logFailedTransfers reported a transfer that succeeded: %s", err)
+	}
+
+	calls = 0
+	err = retryTransfer("foo.baz", func() error {
+		calls++
+		return fmt.Errorf("Checksum mismatch")
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("retryTransfer returned %v after %d calls", err, calls)
+	}
+	if err := logFailedTransfers(); err == nil {
+		t.Errorf("logFailedTransfers did not report foo.baz")
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// MovedMetric records a metric whose location differs between two hash
+// rings.
+type MovedMetric struct {
+	Metric string `json:"metric"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// RingDiff is the result of running a set of metrics through two hash
+// rings.
+type RingDiff struct {
+	// Total is the number of metrics compared
+	Total int `json:"total"`
+
+	// Changed is the number of metrics that moved
+	Changed int `json:"changed"`
+
+	// Churn is the percentage of metrics that moved
+	Churn float64 `json:"churn"`
+
+	// Moved lists each metric that changed location sorted by metric
+	Moved []MovedMetric `json:"moved"`
+
+	// Estimate is the cost of the moves if --estimate-bytes is given
+	Estimate *TransferEstimate `json:"estimate,omitempty"`
+}
+
+// CompareRings locates each metric with the old and new hash rings and
+// returns the metrics that would move going from old to new.
+func CompareRings(metrics []string, old, new hashing.HashRing) *RingDiff {
+	diff := &RingDiff{Moved: make([]MovedMetric, 0)}
+	seen := make(map[string]bool)
+	for _, m := range metrics {
+		if seen[m] {
+			continue
+		}
+		seen[m] = true
+		diff.Total++
+
+		from := nodeName(old.GetNode(locateKey(m)))
+		to := nodeName(new.GetNode(locateKey(m)))
+		if from != to {
+			diff.Moved = append(diff.Moved, MovedMetric{m, from, to})
+		}
+	}
+
+	sort.Slice(diff.Moved, func(i, j int) bool {
+		return diff.Moved[i].Metric < diff.Moved[j].Metric
+	})
+	diff.Changed = len(diff.Moved)
+	if diff.Total > 0 {
+		diff.Churn = 100 * float64(len(diff.Moved)) / float64(diff.Total)
+	}
+
+	return diff
+}
+
+// CheckChurn returns an error if more than limit percent of the compared
+// metrics moved.
+func (d *RingDiff) CheckChurn(limit float64) error {
+	if d.Churn > limit {
+		return fmt.Errorf("Churn of %.2f%% exceeds the limit of %.2f%%", d.Churn, limit)
+	}
+	return nil
+}
+
+// writeRingDiff writes the RingDiff to w as text or, if JSONOutput is
+// set, as JSON.  With onlyChanged we write just the moved metrics and with
+// summaryOnly just the churn count and percentage.
+func writeRingDiff(w io.Writer, diff *RingDiff, onlyChanged, summaryOnly bool) error {
+	if JSONOutput {
+		var v interface{} = diff
+		switch {
+		case onlyChanged:
+			v = diff.Moved
+		case summaryOnly:
+			v = struct {
+				Total    int               `json:"total"`
+				Changed  int               `json:"changed"`
+				Churn    float64           `json:"churn"`
+				Estimate *TransferEstimate `json:"estimate,omitempty"`
+			}{diff.Total, diff.Changed, diff.Churn, diff.Estimate}
+		}
+		return WriteJSON(w, v)
+	}
+
+	if !summaryOnly {
+		for _, m := range diff.Moved {
+			fmt.Fprintf(w, "%s: %s => %s\n", m.Metric, m.From, m.To)
+		}
+	}
+	if !onlyChanged {
+		fmt.Fprintf(w, "Moved %d of %d metrics (%.2f%%)\n",
+			diff.Changed, diff.Total, diff.Churn)
+		if diff.Estimate != nil {
+			fmt.Fprintln(w, diff.Estimate)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestCheckChurn(t *testing.T) {
+	old, err := buildHashRing([]*hashing.JSONRingType{makeTestRing("carbon", 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := buildHashRing([]*hashing.JSONRingType{makeTestRing("fnv1a", 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := make([]string, 1000)
+	for i := range metrics {
+		metrics[i] = fmt.Sprintf("foo.bar%d", i)
+	}
+
+	diff := CompareRings(metrics, old, new)
+	if diff.Churn == 0 {
+		t.Fatalf("Changing the algorithm moved no metrics")
+	}
+	if err := diff.CheckChurn(diff.Churn); err != nil {
+		t.Errorf("CheckChurn rejected churn equal to its limit: %s", err)
+	}
+	if err := diff.CheckChurn(diff.Churn - 0.1); err == nil {
+		t.Errorf("CheckChurn accepted churn of %.2f%% over a limit of %.2f%%",
+			diff.Churn, diff.Churn-0.1)
+	}
+	if err := CompareRings(metrics, old, old).CheckChurn(0); err != nil {
+		t.Errorf("CheckChurn rejected a ring compared to itself: %s", err)
+	}
+}
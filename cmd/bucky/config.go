@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigFile is the path given by --config to read flag defaults from.
+// Without it ~/.buckytools.yaml is read if it exists.
+var ConfigFile string
+
+// configEnv maps the flags that can also be set from an environment
+// variable to that variable.  The environment takes precedence over the
+// config file.
+var configEnv = map[string]string{
+	"host": "BUCKYHOST",
+	"h":    "BUCKYHOST",
+}
+
+// SetupConfig installs the --config flag.  It is part of SetupCommon().
+func SetupConfig(c Command) {
+	c.Flag.StringVar(&ConfigFile, "config", "",
+		"Read flag defaults from this file rather than ~/.buckytools.yaml.")
+}
+
+// defaultConfigFile returns the path of ~/.buckytools.yaml or "" if the
+// home directory is unknown.
+func defaultConfigFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".buckytools.yaml")
+}
+
+// ReadConfig parses a config file of "flag: value" lines, a flat YAML map
+// of long flag names to values.  Blank lines and "#" comments are ignored
+// and values may be quoted.
+func ReadConfig(fd io.Reader) (map[string]string, error) {
+	config := make(map[string]string)
+	scanner := bufio.NewScanner(fd)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || text == "---" {
+			continue
+		}
+		i := strings.Index(text, ":")
+		if i < 1 {
+			return nil, fmt.Errorf("line %d: expected \"flag: value\"", line)
+		}
+		key, value := strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:])
+		if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") {
+			unquoted, err := unquoteConfig(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			value = unquoted
+		} else if j := strings.Index(value, " #"); j >= 0 {
+			value = strings.TrimSpace(value[:j])
+		}
+		config[key] = value
+	}
+
+	return config, scanner.Err()
+}
+
+// unquoteConfig removes the YAML single or double quotes around value.
+func unquoteConfig(value string) (string, error) {
+	if value[0] == '"' {
+		return strconv.Unquote(value)
+	}
+	if len(value) < 2 || value[len(value)-1] != '\'' {
+		return "", fmt.Errorf("unterminated quoted value %s", value)
+	}
+	return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+}
+
+// flagTarget returns the address of the variable a flag sets.  Flags
+// that alias each other, such as -h and --host, share a target.
+func flagTarget(f *flag.Flag) uintptr {
+	v := reflect.ValueOf(f.Value)
+	if v.Kind() != reflect.Ptr {
+		return 0
+	}
+	return v.Pointer()
+}
+
+// ApplyConfig sets the flags of the parsed Command from the config file.
+// Precedence is flags given on the command line, then the environment,
+// then the config file, then the built in defaults.  Config file entries
+// naming flags the Command does not have are ignored so that one file
+// serves every sub-command.
+func ApplyConfig(c Command) error {
+	if c.Flag.Lookup("config") == nil {
+		// Commands without SetupCommon() take no config
+		return nil
+	}
+	path := ConfigFile
+	if path == "" {
+		path = defaultConfigFile()
+		if _, err := os.Stat(path); path == "" || err != nil {
+			return nil
+		}
+	}
+
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	config, err := ReadConfig(fd)
+	if err != nil {
+		return fmt.Errorf("Error reading config file %s: %s", path, err)
+	}
+
+	return applyConfig(c.Flag, config)
+}
+
+// applyConfig sets each flag in fs named in config unless it, or a flag
+// aliasing it, was given on the command line or its environment variable
+// is set.  A config file that sets a flag under more than one of its
+// aliases is rejected rather than letting either value win.
+func applyConfig(fs *flag.FlagSet, config map[string]string) error {
+	given := make(map[uintptr]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[flagTarget(f)] = true
+	})
+
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	aliases := make(map[uintptr]string)
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil || flagTarget(f) == 0 {
+			continue
+		}
+		if alias, ok := aliases[flagTarget(f)]; ok {
+			return fmt.Errorf("Config file sets both %s and %s, which are the same flag", alias, name)
+		}
+		aliases[flagTarget(f)] = name
+	}
+
+	for _, name := range names {
+		value := config[name]
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			if Verbose {
+				log.Printf("Config file entry %s is not a flag of this command", name)
+			}
+			continue
+		}
+		if given[flagTarget(f)] || os.Getenv(configEnv[name]) != "" {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("Invalid config file value for %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadConfig(t *testing.T) {
+	text := `---
+# Connection settings
+host: graphite010:4242
+idle-timeout: 30s   # shorter
+json: true
+
+comment: "a # quoted: value"
+name: 'it''s'
+`
+	config, err := ReadConfig(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"host":         "graphite010:4242",
+		"idle-timeout": "30s",
+		"json":         "true",
+		"comment":      "a # quoted: value",
+		"name":         "it's",
+	}
+	if len(config) != len(expected) {
+		t.Errorf("ReadConfig() returned %v", config)
+	}
+	for k, v := range expected {
+		if config[k] != v {
+			t.Errorf("ReadConfig() set %s to %q, rather than %q", k, config[k], v)
+		}
+	}
+
+	if _, err := ReadConfig(strings.NewReader("no value here\n")); err == nil {
+		t.Errorf("ReadConfig() accepted a line without a value")
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	var host, format string
+	var timeout time.Duration
+	var verbose bool
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&host, "h", "localhost:4242", "")
+	fs.StringVar(&host, "host", "localhost:4242", "")
+	fs.StringVar(&format, "format", "text", "")
+	fs.DurationVar(&timeout, "idle-timeout", time.Minute, "")
+	fs.BoolVar(&verbose, "v", false, "")
+
+	config := map[string]string{
+		"host":         "graphite010:4242",
+		"format":       "graphite",
+		"idle-timeout": "30s",
+		"unknown":      "ignored",
+	}
+
+	// Flags given on the command line, including by alias, win
+	if err := fs.Parse([]string{"-h", "graphite011:4242", "-format", "csv"}); err != nil {
+		t.Fatal(err)
+	}
+	os.Unsetenv("BUCKYHOST")
+	if err := applyConfig(fs, config); err != nil {
+		t.Fatal(err)
+	}
+	if host != "graphite011:4242" || format != "csv" || timeout != 30*time.Second {
+		t.Errorf("applyConfig() set host %s, format %s, idle-timeout %s", host, format, timeout)
+	}
+
+	// The environment wins over the config file
+	fs.Set("h", "localhost:4242")
+	given := flag.NewFlagSet("test", flag.ContinueOnError)
+	given.StringVar(&host, "host", "localhost:4242", "")
+	os.Setenv("BUCKYHOST", "graphite012:4242")
+	defer os.Unsetenv("BUCKYHOST")
+	if err := applyConfig(given, config); err != nil {
+		t.Fatal(err)
+	}
+	if host != "localhost:4242" {
+		t.Errorf("applyConfig() overrode BUCKYHOST with %s", host)
+	}
+
+	if err := applyConfig(fs, map[string]string{"v": "maybe"}); err == nil {
+		t.Errorf("applyConfig() accepted an invalid boolean")
+	}
+}
+
+func TestApplyConfigAliases(t *testing.T) {
+	var host string
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&host, "h", "localhost:4242", "")
+	fs.StringVar(&host, "host", "localhost:4242", "")
+	os.Unsetenv("BUCKYHOST")
+
+	config := map[string]string{"h": "graphite010:4242", "host": "graphite011:4242"}
+	for i := 0; i < 10; i++ {
+		err := applyConfig(fs, config)
+		if err == nil || !strings.Contains(err.Error(), "both h and host") {
+			t.Fatalf("applyConfig() accepted a file setting both h and host: %v", err)
+		}
+	}
+	if host != "localhost:4242" {
+		t.Errorf("applyConfig() set host to %s after rejecting the file", host)
+	}
+
+	if err := applyConfig(fs, map[string]string{"h": "graphite010:4242"}); err != nil {
+		t.Fatal(err)
+	}
+	if host != "graphite010:4242" {
+		t.Errorf("applyConfig() set host %s from its alias h", host)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// CountHosts returns a map of host => number of metrics located on that
+// host from a map of metric => host.
+func CountHosts(list map[string]string) map[string]int {
+	counts := make(map[string]int)
+	for _, host := range list {
+		counts[host]++
+	}
+
+	return counts
+}
+
+// addEmptyHosts adds each host of the hash ring that is missing from the
+// map of host => number of metrics to it with a count of 0, and logs a
+// warning naming them.  Hosts are named as nodeName() names them.
+func addEmptyHosts(counts map[string]int, hr hashing.HashRing) []string {
+	empty := make([]string, 0)
+	for _, n := range hr.Nodes() {
+		host := nodeName(n)
+		if _, ok := counts[host]; !ok {
+			counts[host] = 0
+			empty = append(empty, host)
+		}
+	}
+	if len(empty) > 0 {
+		log.Printf("Warning: %d hosts of the ring hold none of the metrics: %s",
+			len(empty), strings.Join(empty, ", "))
+	}
+
+	return empty
+}
+
+// HostCount is the number of metrics located on a host and the fraction of
+// all located metrics that is.
+type HostCount struct {
+	Count    int     `json:"count"`
+	Fraction float64 `json:"fraction"`
+}
+
+// CountSummary is the JSON representation of per host metric counts.
+type CountSummary struct {
+	// Total is the number of metrics counted
+	Total int `json:"total"`
+
+	// Hosts maps each host to its count
+	Hosts map[string]HostCount `json:"hosts"`
+}
+
+// NewCountSummary returns the CountSummary of the map of host => number of
+// metrics returned by CountHosts().
+func NewCountSummary(counts map[string]int) *CountSummary {
+	s := &CountSummary{Hosts: make(map[string]HostCount, len(counts))}
+	for _, c := range counts {
+		s.Total += c
+	}
+	for h, c := range counts {
+		hc := HostCount{Count: c}
+		if s.Total > 0 {
+			hc.Fraction = float64(c) / float64(s.Total)
+		}
+		s.Hosts[h] = hc
+	}
+
+	return s
+}
+
+// imbalancedHosts returns the hosts in counts that hold more than pct
+// percent above the mean number of metrics per host in sorted order.  Each
+// host with a reported count is included in the mean.
+func imbalancedHosts(counts map[string]int, pct float64) []string {
+	result := make([]string, 0)
+	if len(counts) == 0 {
+		return result
+	}
+
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	mean := float64(total) / float64(len(counts))
+	limit := mean * (1 + pct/100)
+	for _, h := range sortedHosts(counts) {
+		if float64(counts[h]) > limit {
+			log.Printf("Imbalance: %s holds %d metrics, %.2f%% above the mean of %.2f",
+				h, counts[h], 100*(float64(counts[h])-mean)/mean, mean)
+			result = append(result, h)
+		}
+	}
+
+	return result
+}
+
+// sortedHosts returns the hosts in counts in sorted order.
+func sortedHosts(counts map[string]int) []string {
+	hosts := make([]string, 0, len(counts))
+	for h := range counts {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// graphiteSegment sanitizes s into a valid Graphite metric path segment.
+// Dots would split a host name into multiple segments so they, and any
+// other characters not generally safe in a metric name, become "_".
+func graphiteSegment(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-' || r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// writeCounts writes the per host metric counts to w.  The format is one
+// of "text", or "graphite" for carbon plaintext protocol lines of the form
+// bucky.locate.host.<host>.metrics <count> <timestamp>.  The JSON encoded
+// CountSummary is written if JSONOutput is set.
+func writeCounts(w io.Writer, counts map[string]int, format string) error {
+	if JSONOutput {
+		return WriteJSON(w, NewCountSummary(counts))
+	}
+
+	now := time.Now().Unix()
+	for _, h := range sortedHosts(counts) {
+		switch format {
+		case "graphite":
+			fmt.Fprintf(w, "bucky.locate.host.%s.metrics %d %d\n",
+				graphiteSegment(h), counts[h], now)
+		default:
+			fmt.Fprintf(w, "%s\t%d\n", h, counts[h])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestImbalancedHosts(t *testing.T) {
+	counts := map[string]int{
+		"graphite010": 100,
+		"graphite011": 100,
+		"graphite012": 100,
+		"graphite013": 140,
+	}
+
+	// The mean is 110 so graphite013 is 27% above it
+	if hosts := imbalancedHosts(counts, 25); len(hosts) != 1 || hosts[0] != "graphite013" {
+		t.Errorf("imbalancedHosts(25) returned %v", hosts)
+	}
+	if hosts := imbalancedHosts(counts, 30); len(hosts) != 0 {
+		t.Errorf("imbalancedHosts(30) returned %v", hosts)
+	}
+	if hosts := imbalancedHosts(map[string]int{}, 0); len(hosts) != 0 {
+		t.Errorf("imbalancedHosts() of no hosts returned %v", hosts)
+	}
+}
+
+// TestCountHostsCollapse checks that instances collapse to their server
+// and that counts aggregate per server.
+func TestCountHostsCollapse(t *testing.T) {
+	ring := &hashing.JSONRingType{
+		Name:     "graphite010",
+		Algo:     "carbon",
+		Replicas: 1,
+		Nodes: []hashing.Node{
+			hashing.NewNode("graphite010", 2003, "a"),
+			hashing.NewNode("graphite010", 2004, "b"),
+			hashing.NewNode("graphite011", 2003, "a"),
+		},
+	}
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{ring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	defer func() { Cluster, locateCollapse = nil, true }()
+
+	if len(c.Servers) != 2 {
+		t.Errorf("Cluster servers are %v, rather than each server once", c.Servers)
+	}
+
+	metrics := make([]string, 0)
+	for i := 0; i < 1000; i++ {
+		metrics = append(metrics, fmt.Sprintf("foo.bar.metric%d", i))
+	}
+
+	locateCollapse = false
+	byInstance := CountHosts(mustLocate(t, metrics))
+	locateCollapse = true
+	list := mustLocate(t, metrics)
+	byServer := CountHosts(list)
+
+	if len(byInstance) != 3 || len(byServer) != 2 {
+		t.Fatalf("Counted %v by instance and %v by server", byInstance, byServer)
+	}
+	if byServer["graphite010"] != byInstance["graphite010:a"]+byInstance["graphite010:b"] ||
+		byServer["graphite011"] != byInstance["graphite011:a"] {
+		t.Errorf("Server counts %v do not aggregate instance counts %v", byServer, byInstance)
+	}
+	for _, m := range metrics {
+		if list[m] != Cluster.Hash.GetNode(m).Server {
+			t.Errorf("%s collapsed to %s, rather than its node's server", m, list[m])
+		}
+	}
+}
+
+func TestWriteCountsJSON(t *testing.T) {
+	JSONOutput = true
+	defer func() { JSONOutput = false }()
+
+	buf := new(bytes.Buffer)
+	writeCounts(buf, map[string]int{"graphite010": 3, "graphite011": 1}, "text")
+	expected := `{"total":4,"hosts":{"graphite010":{"count":3,"fraction":0.75},` +
+		`"graphite011":{"count":1,"fraction":0.25}}}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("writeCounts wrote %q, rather than %q", buf.String(), expected)
+	}
+}
+
+func TestAddEmptyHosts(t *testing.T) {
+	hr := hashing.NewCarbonHashRing()
+	hr.AddNode(hashing.NewNode("graphite010", 2004, "a"))
+	hr.AddNode(hashing.NewNode("graphite010", 2004, "b"))
+	hr.AddNode(hashing.NewNode("graphite011", 2004, "a"))
+	hr.AddNode(hashing.NewNode("graphite012", 2004, "a"))
+	defer func() { locateCollapse = true }()
+
+	locateCollapse = true
+	counts := map[string]int{"graphite011": 5}
+	empty := addEmptyHosts(counts, hr)
+	if len(empty) != 2 || empty[0] != "graphite010" || empty[1] != "graphite012" {
+		t.Errorf("addEmptyHosts() returned %v", empty)
+	}
+	if len(counts) != 3 || counts["graphite010"] != 0 || counts["graphite011"] != 5 {
+		t.Errorf("addEmptyHosts() left counts %v", counts)
+	}
+
+	locateCollapse = false
+	counts = map[string]int{"graphite010:a": 1, "graphite011:a": 1, "graphite012:a": 1}
+	if empty := addEmptyHosts(counts, hr); len(empty) != 1 || empty[0] != "graphite010:b" {
+		t.Errorf("addEmptyHosts() by instance returned %v", empty)
+	}
+}
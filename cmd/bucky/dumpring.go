@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// RingFile is a convenience variable for sub-commands.  If setup by calling
+// SetupRingFile() from a sub-command's init() this holds the path given to
+// --ring-file and the hash ring is read from that file rather than from the
+// buckyd daemons in the cluster.
+var RingFile string
+
+// dumpRingComment is the free form comment stored in the dumped ring file.
+var dumpRingComment string
+
+// dumpRingNoTimestamp leaves the generated_at time out of the ring file.
+var dumpRingNoTimestamp bool
+
+// RingFileType is the annotated ring file format.  Ring files may also be
+// a bare JSON array of rings which is equivalent to this structure with
+// only the Rings field set.
+type RingFileType struct {
+	// GeneratedAt is the RFC3339 time the ring file was created
+	GeneratedAt string `json:"generated_at,omitempty"`
+
+	// Comment is any free form text describing the ring file
+	Comment string `json:"comment,omitempty"`
+
+	// Fingerprint identifies the placement of the first ring
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// Rings are the hash rings reported by each buckyd daemon
+	Rings []*hashing.JSONRingType `json:"rings"`
+}
+
+func init() {
+	usage := "[options]"
+	short := "Dump the cluster's hash rings to a ring file."
+	long := `Write to STDOUT a JSON ring file containing the hash ring reported
+by each buckyd daemon in the cluster.  The ring file is an object of the form:
+
+    {"generated_at": "...", "comment": "...", "fingerprint": "...", "rings": [...]}
+
+Use -c to store a comment describing the ring file.  The fingerprint is a
+hash of the hashing algorithm, replicas, and nodes of the ring.  Ring files
+that place metrics identically share a fingerprint.
+
+The output is canonical so that ring files can be committed and diffed.
+Rings are sorted by name and, except for jump_fnv1a where the order of
+nodes determines placement, each ring's nodes are sorted.  Dumping the same
+cluster twice produces identical output other than the generated_at time.
+Use --no-timestamp to leave out the time for byte for byte reproducibility.
+
+Commands that accept --ring-file will build the hash ring from a ring file
+rather than the live cluster.  They accept this annotated form or a bare JSON
+array of rings.  The --ring-file may also be a directory of dumped ring files
+kept over time.  Each snapshot's date comes from a YYYY-MM-DD in its file
+name or else its generated_at time.  Use --as-of DATE to build the hash ring
+from the snapshot in effect on that date, otherwise the latest is used.`
+
+	c := NewCommand(dumpRingCommand, "dump-ring", usage, short, long)
+	SetupCommon(c)
+	SetupHostname(c)
+
+	c.Flag.StringVar(&dumpRingComment, "c", "",
+		"Comment to store in the ring file.")
+	c.Flag.StringVar(&dumpRingComment, "comment", "",
+		"Comment to store in the ring file.")
+	c.Flag.BoolVar(&dumpRingNoTimestamp, "no-timestamp", false,
+		"Leave the generation time out of the ring file.")
+}
+
+// SetupRingFile installs the --ring-file flag in the given Command
+func SetupRingFile(c Command) {
+	c.Flag.StringVar(&RingFile, "ring-file", "",
+		"Build the hash ring from this ring file, or directory of dated ring files, rather than the cluster.")
+	c.Flag.StringVar(&RingAsOf, "as-of", "",
+		"With a --ring-file directory, use the snapshot in effect on this YYYY-MM-DD date.")
+}
+
+// ReadRingFile reads the ring file at path and returns the rings it
+// contains.  Both the annotated object form and a bare JSON array of rings
+// are accepted.  If path is a directory of dated ring file snapshots the
+// one in effect at --as-of is read.  --as-of is an error with a single
+// ring file.
+func ReadRingFile(path string) ([]*hashing.JSONRingType, error) {
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		path, err = SelectRingSnapshot(path, RingAsOf)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Using ring snapshot %s", path)
+	} else if RingAsOf != "" {
+		return nil, fmt.Errorf("--as-of requires a --ring-file directory of snapshots, %s is not a directory", path)
+	}
+
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rf := new(RingFileType)
+	blob = bytes.TrimSpace(blob)
+	if len(blob) > 0 && blob[0] == '[' {
+		err = json.Unmarshal(blob, &rf.Rings)
+	} else {
+		err = json.Unmarshal(blob, rf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rf.Rings) == 0 {
+		return nil, fmt.Errorf("No hash rings found in %s", path)
+	}
+
+	return rf.Rings, nil
+}
+
+// canonicalRings returns copies of the given rings in a canonical order.
+// Rings are sorted by name and the nodes of each ring are sorted unless
+// the hashing algorithm depends on their order.
+func canonicalRings(rings []*hashing.JSONRingType) []*hashing.JSONRingType {
+	result := make([]*hashing.JSONRingType, 0, len(rings))
+	for _, r := range rings {
+		c := *r
+		c.Nodes = append([]hashing.Node{}, r.Nodes...)
+		if c.Algo != "jump_fnv1a" {
+			hashing.SortNodes(c.Nodes)
+		}
+		result = append(result, &c)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// MarshalRingFile returns the canonical, indented JSON encoding of the
+// ring file.
+func MarshalRingFile(rf *RingFileType) ([]byte, error) {
+	c := *rf
+	c.Rings = canonicalRings(rf.Rings)
+	blob, err := json.MarshalIndent(&c, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(blob, '\n'), nil
+}
+
+// dumpRingCommand runs this subcommand.
+func dumpRingCommand(c Command) int {
+	_, err := GetClusterConfig(HostPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if !Cluster.Healthy {
+		log.Printf("Warning: Cluster is not healthy!")
+	}
+
+	rf := &RingFileType{
+		Comment:     dumpRingComment,
+		Fingerprint: Cluster.Rings[0].Fingerprint(),
+		Rings:       Cluster.Rings,
+	}
+	if !dumpRingNoTimestamp {
+		rf.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	blob, err := MarshalRingFile(rf)
+	if err != nil {
+		log.Printf("Error marshalling ring file: %s", err)
+		return 1
+	}
+	os.Stdout.Write(blob)
+
+	return 0
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestMarshalRingFile(t *testing.T) {
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		a := makeTestRing(algo, 4)
+		b := makeTestRing(algo, 4)
+		b.Name = "graphite001"
+
+		rf := &RingFileType{Rings: []*hashing.JSONRingType{a, b}}
+		first, err := MarshalRingFile(rf)
+		if err != nil {
+			t.Fatalf("%s: MarshalRingFile returned an error: %s", algo, err)
+		}
+		second, _ := MarshalRingFile(rf)
+		if !bytes.Equal(first, second) {
+			t.Errorf("%s: Marshaling the same ring file twice differs", algo)
+		}
+
+		// Reorder the rings and nodes
+		c := makeTestRing(algo, 4)
+		c.Name = "graphite001"
+		c.Nodes[0], c.Nodes[1] = c.Nodes[1], c.Nodes[0]
+		reordered, _ := MarshalRingFile(&RingFileType{Rings: []*hashing.JSONRingType{c, a}})
+		if algo == "jump_fnv1a" {
+			if bytes.Equal(first, reordered) {
+				t.Errorf("%s: Node order was not preserved", algo)
+			}
+		} else if !bytes.Equal(first, reordered) {
+			t.Errorf("%s: Reordered ring file is not canonical:\n%s\n%s",
+				algo, first, reordered)
+		}
+		if a.Nodes[0].Instance != "a" || c.Nodes[0].Instance != "b" {
+			t.Errorf("%s: MarshalRingFile modified the given rings", algo)
+		}
+	}
+}
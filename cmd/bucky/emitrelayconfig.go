@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// emitRelayCluster is the name of the emitted carbon-c-relay cluster.
+var emitRelayCluster string
+
+// emitRelayPort is the port given to nodes without one.
+var emitRelayPort int
+
+func init() {
+	usage := "[options]"
+	short := "Write the hash ring as a carbon-c-relay cluster statement."
+	long := `Write the cluster's hash ring to STDOUT as a carbon-c-relay cluster
+statement, the reverse of locate --relay-config, so that the relay's
+configuration can be regenerated from the cluster's membership:
+
+    cluster <name> fnv1a_ch
+        host:port=instance
+        ...
+        ;
+
+The cluster is named by --cluster, which is required.  The cluster type is
+carbon_ch, fnv1a_ch, or jump_fnv1a_ch to match the ring's hashing algorithm
+and a "replication N" clause is added when the ring has more than one
+replica.  Each node is written as HOST[:PORT][=INSTANCE] in the ring's node
+order, which is the order jump_fnv1a places by.  The port and instance are
+left out when the ring's node has none.  Use --port to give the port of
+nodes that have none, rather than leaving it to the relay's default.
+
+Use -s to use the hash ring only of the host given by -h or in the
+BUCKYHOST environment variable.  Use --ring-file to write the hash ring in
+a ring file rather than the cluster's.`
+
+	c := NewCommand(emitRelayConfigCommand, "emit-relay-config", usage, short, long)
+	SetupCommon(c)
+	SetupHostname(c)
+	SetupSingle(c)
+	SetupRingFile(c)
+
+	c.Flag.StringVar(&emitRelayCluster, "cluster", "",
+		"Name of the carbon-c-relay cluster.")
+	c.Flag.IntVar(&emitRelayPort, "port", 0,
+		"Port of the nodes that have none in the hash ring.")
+}
+
+// relayClusterType returns the carbon-c-relay cluster type placing metrics
+// with the hashing algorithm.
+func relayClusterType(algo string) (string, error) {
+	for t, a := range relayAlgos {
+		if a == algo {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("Hashing algorithm %s has no carbon-c-relay cluster type", algo)
+}
+
+// relayNode returns the node in the HOST[:PORT][=INSTANCE] form of a
+// carbon-c-relay cluster statement.  A node without a port is given port,
+// if that is not 0.
+func relayNode(n hashing.Node, port int) string {
+	s := n.Server
+	if n.Port != 0 {
+		port = n.Port
+	}
+	if port != 0 {
+		s += ":" + strconv.Itoa(port)
+	}
+	if n.Instance != "" {
+		s += "=" + n.Instance
+	}
+	return s
+}
+
+// WriteRelayCluster writes the hash ring to w as a carbon-c-relay cluster
+// statement named name.
+func WriteRelayCluster(w io.Writer, ring *hashing.JSONRingType, name string, port int) error {
+	if len(ring.Nodes) == 0 {
+		return fmt.Errorf("Hash ring has no nodes")
+	}
+	t, err := relayClusterType(ring.Algo)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "cluster %s %s", name, t)
+	if ring.Replicas > 1 {
+		fmt.Fprintf(w, " replication %d", ring.Replicas)
+	}
+	fmt.Fprintln(w)
+	for _, n := range ring.Nodes {
+		fmt.Fprintf(w, "    %s\n", relayNode(n, port))
+	}
+	_, err = fmt.Fprintln(w, "    ;")
+	return err
+}
+
+// emitRelayConfigCommand runs this subcommand.
+func emitRelayConfigCommand(c Command) int {
+	if emitRelayCluster == "" {
+		log.Print("--cluster is required.")
+		return 1
+	}
+	if strings.ContainsAny(emitRelayCluster, " \t\n;#") {
+		log.Printf("--cluster %q is not a valid carbon-c-relay cluster name.", emitRelayCluster)
+		return 1
+	}
+	if emitRelayPort < 0 || emitRelayPort > 65535 {
+		log.Print("--port must be a port number.")
+		return 1
+	}
+
+	_, err := GetClusterConfig(HostPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if !Cluster.Healthy {
+		log.Printf("Warning: Cluster is not healthy!")
+	}
+
+	err = WriteRelayCluster(os.Stdout, Cluster.Rings[0], emitRelayCluster, emitRelayPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
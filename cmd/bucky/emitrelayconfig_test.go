@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestWriteRelayCluster(t *testing.T) {
+	ring := &hashing.JSONRingType{
+		Name:     "graphite010",
+		Algo:     "fnv1a",
+		Replicas: 2,
+		Nodes: []hashing.Node{
+			hashing.NewNode("graphite010", 2004, "a"),
+			hashing.NewNode("graphite011", 0, "b"),
+			hashing.NewNode("graphite012", 2104, ""),
+			hashing.NewNode("graphite013", 0, ""),
+		},
+	}
+	expected := `cluster graphite fnv1a_ch replication 2
+    graphite010:2004=a
+    graphite011:2003=b
+    graphite012:2104
+    graphite013:2003
+    ;
+`
+	buf := new(bytes.Buffer)
+	if err := WriteRelayCluster(buf, ring, "graphite", 2003); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("WriteRelayCluster() wrote:\n%s\nrather than:\n%s", buf, expected)
+	}
+
+	// The statement parses back into the same placement
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		ring.Algo = algo
+		ring.Replicas = 1
+		buf.Reset()
+		if err := WriteRelayCluster(buf, ring, "graphite", 0); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(buf.String(), "replication") {
+			t.Errorf("%s: WriteRelayCluster() wrote replication 1:\n%s", algo, buf)
+		}
+		rc, err := parseRelayConfig(strings.NewReader(buf.String() + "match * send to graphite;"))
+		if err != nil {
+			t.Fatalf("%s: %s", algo, err)
+		}
+		hr, err := buildHashRing([]*hashing.JSONRingType{ring})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			m := fmt.Sprintf("foo.bar%d", i)
+			if a, b := hr.GetNode(m), rc.Clusters["graphite"].GetNode(m); !hashing.NodeCmp(a, b) {
+				t.Errorf("%s: %s is placed on %s by the ring and %s by the relay", algo, m, a, b)
+			}
+		}
+	}
+
+	// Replicas are written as replication and located on as many hosts
+	defer func() { locateCollapse = true }()
+	locateCollapse = false
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		ring.Algo = algo
+		ring.Replicas = 3
+		buf.Reset()
+		if err := WriteRelayCluster(buf, ring, "graphite", 0); err != nil {
+			t.Fatal(err)
+		}
+		rc, err := parseRelayConfig(strings.NewReader(buf.String() + "match * send to graphite;"))
+		if err != nil {
+			t.Fatalf("%s: %s", algo, err)
+		}
+		if r := rc.Clusters["graphite"].Replication; r != 3 {
+			t.Errorf("%s: replication 3 parsed back as %d", algo, r)
+		}
+		hr, err := buildHashRing([]*hashing.JSONRingType{ring})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			m := fmt.Sprintf("foo.bar%d", i)
+			expected := make([]string, 0, 3)
+			for _, n := range hr.GetNodes(m, 3) {
+				expected = append(expected, "graphite/"+nodeName(n))
+			}
+			if located := rc.Locate(m); strings.Join(located, " ") != strings.Join(expected, " ") {
+				t.Errorf("%s: %s is placed on %v by the ring and %v by the relay", algo, m, expected, located)
+			}
+		}
+	}
+
+	ring.Algo = "bogus"
+	if err := WriteRelayCluster(buf, ring, "graphite", 0); err == nil {
+		t.Errorf("WriteRelayCluster() accepted an unknown algorithm")
+	}
+}
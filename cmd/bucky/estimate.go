@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+import . "github.com/jjneely/buckytools/metrics"
+
+// estimateBytes stats the source of each moving metric to estimate the
+// bytes a move transfers.
+var estimateBytes bool
+
+// estimateBWLimit is the transfer rate, in KiB per second, used to
+// estimate how long a move takes.  Zero leaves out the time estimate.
+var estimateBWLimit int
+
+// TransferEstimate is the estimated cost of moving a set of metrics.
+type TransferEstimate struct {
+	// Metrics is the number of moving metrics
+	Metrics int `json:"metrics"`
+
+	// Missing is the number of moving metrics that could not be stat'd
+	// on their source server and are not counted in Bytes
+	Missing int `json:"missing"`
+
+	// Bytes is the total size of the moving Whisper DBs
+	Bytes int64 `json:"bytes"`
+
+	// Seconds is the time transferring Bytes takes at --bwlimit, or 0 if
+	// no limit is given
+	Seconds float64 `json:"seconds,omitempty"`
+}
+
+// SetupEstimate installs the --estimate-bytes and --bwlimit flags in the
+// given Command.
+func SetupEstimate(c Command) {
+	c.Flag.BoolVar(&estimateBytes, "estimate-bytes", false,
+		"Stat the moving metrics to estimate the bytes transferred.")
+	c.Flag.IntVar(&estimateBWLimit, "bwlimit", 0,
+		"Estimate the transfer time at this rate in KiB per second.")
+}
+
+// EstimateMoves stats each moving metric on the server it moves from and
+// returns the TransferEstimate of the moves.  Servers are reached on the
+// cluster's port.
+func EstimateMoves(moves []MovedMetric) *TransferEstimate {
+	metricMap := make(map[string][]string)
+	for _, m := range moves {
+		metricMap[m.From] = append(metricMap[m.From], m.Metric)
+	}
+
+	e := &TransferEstimate{Metrics: len(moves)}
+	found := 0
+	statEach(metricMap, func(server, metric string, stat *MetricData) {
+		e.Bytes += stat.Size
+		found++
+	})
+	e.Missing = e.Metrics - found
+	if estimateBWLimit > 0 {
+		e.Seconds = float64(e.Bytes) / float64(estimateBWLimit*1024)
+	}
+
+	return e
+}
+
+// String returns a one line summary of the estimate.
+func (e *TransferEstimate) String() string {
+	s := fmt.Sprintf("Estimated transfer of %d metrics: %d bytes (%.2f GiB)",
+		e.Metrics, e.Bytes, float64(e.Bytes)/float64(1024*1024*1024))
+	if e.Missing > 0 {
+		s += fmt.Sprintf(", %d metrics could not be stat'd", e.Missing)
+	}
+	if e.Seconds > 0 {
+		d := time.Duration(e.Seconds * float64(time.Second)).Round(time.Second)
+		s += fmt.Sprintf(", taking %s at %d KiB/s", d, estimateBWLimit)
+	}
+	return s
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEstimateMoves(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/metrics/")
+		if name == "missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Metric-Stat",
+			fmt.Sprintf(`{"Name": %q, "Size": 1048576, "ModTime": 0}`, name))
+	}))
+	defer ts.Close()
+
+	host := strings.TrimPrefix(ts.URL, "http://")
+	moves := []MovedMetric{
+		{"foo.bar", host, "graphite001"},
+		{"foo.baz", host, "graphite002"},
+		{"missing", host, "graphite002"},
+	}
+	defer func() { estimateBWLimit = 0 }()
+	estimateBWLimit = 512
+
+	e := EstimateMoves(moves)
+	if e.Metrics != 3 || e.Missing != 1 || e.Bytes != 2*1048576 {
+		t.Errorf("Unexpected estimate: %+v", e)
+	}
+	if e.Seconds != 4 {
+		t.Errorf("2 MiB at 512 KiB/s estimated at %.2f seconds, rather than 4", e.Seconds)
+	}
+	s := e.String()
+	if !strings.Contains(s, "2097152 bytes") || !strings.Contains(s, "taking 4s at 512 KiB/s") ||
+		!strings.Contains(s, "1 metrics could not be stat'd") {
+		t.Errorf("Unexpected estimate summary: %s", s)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// execPlaceholder matches the {name} placeholders of an --exec template.
+var execPlaceholder = regexp.MustCompile(`\{([a-z]*)\}`)
+
+// execFields are the placeholders an --exec template may use.
+var execFields = map[string]bool{
+	"host":     true,
+	"path":     true,
+	"metric":   true,
+	"instance": true,
+}
+
+// execSafe matches the values we substitute into a command.  The command is
+// run by the shell so values holding shell syntax are refused rather than
+// risk running something other than what the template says.
+var execSafe = regexp.MustCompile(`^[A-Za-z0-9_.,:/=@+%-]*$`)
+
+// ExecCommand is a command expanded from an --exec template for a metric.
+type ExecCommand struct {
+	Metric  string
+	Command string
+}
+
+// checkExecTemplate returns an error if the template uses an unknown
+// placeholder or holds a brace that is not part of a placeholder.
+func checkExecTemplate(tmpl string) error {
+	if strings.TrimSpace(tmpl) == "" {
+		return fmt.Errorf("Empty --exec template")
+	}
+	for _, m := range execPlaceholder.FindAllStringSubmatch(tmpl, -1) {
+		if !execFields[m[1]] {
+			return fmt.Errorf("Unknown placeholder %s in --exec template, use {host}, {path}, {metric}, or {instance}", m[0])
+		}
+	}
+	if strings.ContainsAny(execPlaceholder.ReplaceAllString(tmpl, ""), "{}") {
+		return fmt.Errorf("Unbalanced brace in --exec template: %s", tmpl)
+	}
+	return nil
+}
+
+// expandExec returns the template with each placeholder replaced by its
+// value in fields.  An error is returned if a value is not safe to give to
+// the shell.
+func expandExec(tmpl string, fields map[string]string) (string, error) {
+	var err error
+	result := execPlaceholder.ReplaceAllStringFunc(tmpl, func(p string) string {
+		v := fields[p[1:len(p)-1]]
+		if !execSafe.MatchString(v) && err == nil {
+			err = fmt.Errorf("Refusing to substitute %q for %s into a shell command", v, p)
+		}
+		return v
+	})
+	return result, err
+}
+
+// ExecCommands expands the template for each metric of the map of
+// metric => host returned by LocateSliceMetrics(), sorted by metric.
+// Metrics whose values cannot be substituted safely are logged and
+// skipped, and their number returned.
+func ExecCommands(tmpl string, list map[string]string, root string) ([]ExecCommand, int) {
+	metrics := make([]string, 0, len(list))
+	for m := range list {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+
+	commands := make([]ExecCommand, 0, len(metrics))
+	skipped := 0
+	for _, m := range metrics {
+		n := Cluster.Hash.GetNode(locateKey(m))
+		cmd, err := expandExec(tmpl, map[string]string{
+			"host":     connectHost(n),
+			"path":     metricPath(root, m),
+			"metric":   m,
+			"instance": n.Instance,
+		})
+		if err != nil {
+			log.Printf("Skipping %s: %s", m, err)
+			skipped++
+			continue
+		}
+		commands = append(commands, ExecCommand{m, cmd})
+	}
+	return commands, skipped
+}
+
+// RunExec runs each command with the shell using a pool of workers.  The
+// output of each command is written to w once it finishes, each line
+// prefixed with its metric, so the output of concurrent commands is never
+// interleaved.  Unless keepGoing is set no more commands are started after
+// one fails.  At least one worker is used.  The number of commands that
+// failed is returned.
+func RunExec(w io.Writer, commands []ExecCommand, workers int, keepGoing bool) int {
+	var lock sync.Mutex
+	failed := 0
+	stop := false
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	work := make(chan ExecCommand)
+	wg := new(sync.WaitGroup)
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				out, err := exec.Command("/bin/sh", "-c", c.Command).CombinedOutput()
+
+				lock.Lock()
+				scanner := bufio.NewScanner(bytes.NewReader(out))
+				for scanner.Scan() {
+					fmt.Fprintf(w, "%s: %s\n", c.Metric, scanner.Text())
+				}
+				if err != nil {
+					log.Printf("Error running %s for %s: %s", c.Command, c.Metric, err)
+					failed++
+					stop = stop || !keepGoing
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+	for _, c := range commands {
+		lock.Lock()
+		done := stop
+		lock.Unlock()
+		if done {
+			log.Printf("Not running the remaining commands after a failure")
+			break
+		}
+		work <- c
+	}
+	close(work)
+	wg.Wait()
+
+	return failed
+}
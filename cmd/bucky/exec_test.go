@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckExecTemplate(t *testing.T) {
+	good := []string{
+		"ssh {host} ls -l {path}",
+		"echo {metric} {instance}",
+		"true",
+	}
+	bad := []string{
+		"",
+		"  ",
+		"ssh {hostname} ls",
+		"echo {Metric}",
+		"echo {path",
+		"echo path}",
+		"awk '{print}' {path}",
+	}
+
+	for _, tmpl := range good {
+		if err := checkExecTemplate(tmpl); err != nil {
+			t.Errorf("checkExecTemplate(%q) returned %s", tmpl, err)
+		}
+	}
+	for _, tmpl := range bad {
+		if err := checkExecTemplate(tmpl); err == nil {
+			t.Errorf("checkExecTemplate(%q) accepted a bad template", tmpl)
+		}
+	}
+}
+
+func TestExpandExec(t *testing.T) {
+	fields := map[string]string{
+		"host":     "graphite010",
+		"path":     "/opt/graphite/storage/whisper/foo/bar.wsp",
+		"metric":   "foo.bar",
+		"instance": "a",
+	}
+	cmd, err := expandExec("ssh {host} ls {path} # {metric} {instance} {metric}", fields)
+	if err != nil {
+		t.Fatalf("expandExec() returned %s", err)
+	}
+	expected := "ssh graphite010 ls /opt/graphite/storage/whisper/foo/bar.wsp # foo.bar a foo.bar"
+	if cmd != expected {
+		t.Errorf("expandExec() returned %q, rather than %q", cmd, expected)
+	}
+
+	for _, m := range []string{"foo;rm -rf /", "foo$(id)", "foo bar", "foo`id`", "foo'bar"} {
+		fields["metric"] = m
+		if _, err := expandExec("echo {metric}", fields); err == nil {
+			t.Errorf("expandExec() substituted unsafe metric %q", m)
+		}
+		if _, err := expandExec("echo {host}", fields); err != nil {
+			t.Errorf("expandExec() refused a template not using unsafe metric %q", m)
+		}
+	}
+}
+
+func TestRunExec(t *testing.T) {
+	commands := []ExecCommand{
+		{"foo.a", "echo one; echo two"},
+		{"foo.b", "echo three"},
+		{"foo.c", "exit 1"},
+	}
+
+	buf := new(bytes.Buffer)
+	if failed := RunExec(buf, commands, 2, true); failed != 1 {
+		t.Errorf("RunExec() returned %d failures, rather than 1", failed)
+	}
+	for _, line := range []string{"foo.a: one\nfoo.a: two\n", "foo.b: three\n"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("RunExec() output %q lacks %q", buf.String(), line)
+		}
+	}
+
+	// With one worker and fail-fast nothing runs after the failure
+	commands = append([]ExecCommand{{"foo.0", "exit 1"}}, commands...)
+	buf.Reset()
+	if failed := RunExec(buf, commands, 1, false); failed != 1 {
+		t.Errorf("RunExec() returned %d failures, rather than 1", failed)
+	}
+	if strings.Contains(buf.String(), "foo.b") {
+		t.Errorf("RunExec() kept running after a failure: %q", buf.String())
+	}
+}
+
+func TestRunExecNoWorkers(t *testing.T) {
+	commands := []ExecCommand{{"foo.a", "echo one"}}
+	buf := new(bytes.Buffer)
+	done := make(chan int)
+	go func() { done <- RunExec(buf, commands, 0, true) }()
+
+	select {
+	case failed := <-done:
+		if failed != 0 || buf.String() != "foo.a: one\n" {
+			t.Errorf("RunExec() with 0 workers returned %d failures and %q", failed, buf.String())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("RunExec() with 0 workers never finished")
+	}
+}
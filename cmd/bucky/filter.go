@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// sampleSize is the number of offending metric names we log as an
+// example when filtering metrics out of an input list.
+const sampleSize = 10
+
+// ValidateMetric returns an error if the metric name contains characters
+// Graphite will not accept.  We allow the character set carbon-c-relay
+// passes through unmodified by default: letters, digits, and "-_:#", with
+// "." separating non-empty path segments.  With --tagged a Graphite tagged
+// series name;tag=value;... is accepted, the name part checked as above
+// and each tag as Graphite checks them.
+func ValidateMetric(m string) error {
+	name := m
+	if i := strings.IndexByte(m, ';'); locateTagged && i >= 0 {
+		name = m[:i]
+		for _, tag := range strings.Split(m[i+1:], ";") {
+			if err := validateTag(tag, m); err != nil {
+				return err
+			}
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("Empty metric name")
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("-_:#.", r):
+		default:
+			return fmt.Errorf("Invalid character %q in metric name %q", r, m)
+		}
+	}
+	for _, s := range strings.Split(name, ".") {
+		if s == "" {
+			return fmt.Errorf("Empty path segment in metric name %q", m)
+		}
+	}
+
+	return nil
+}
+
+// validateTag returns an error if the tag=value pair of the tagged series
+// m is not one Graphite accepts: a non-empty tag without any of "!^=" and
+// a non-empty value without "~", neither with whitespace.
+func validateTag(tag, m string) error {
+	i := strings.IndexByte(tag, '=')
+	if i < 1 || i == len(tag)-1 {
+		return fmt.Errorf("Tag %q is not tag=value in metric name %q", tag, m)
+	}
+	if strings.ContainsAny(tag[:i], "!^") || strings.ContainsRune(tag[i+1:], '~') {
+		return fmt.Errorf("Invalid character in tag %q in metric name %q", tag, m)
+	}
+	for _, r := range tag {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return fmt.Errorf("Invalid character %q in tag %q in metric name %q", r, tag, m)
+		}
+	}
+
+	return nil
+}
+
+// ValidateMetrics returns the metrics that pass ValidateMetric() and the
+// names of those that do not.
+func ValidateMetrics(metrics []string) ([]string, []string) {
+	valid := make([]string, 0, len(metrics))
+	invalid := make([]string, 0)
+	for _, m := range metrics {
+		if ValidateMetric(m) != nil {
+			invalid = append(invalid, m)
+		} else {
+			valid = append(valid, m)
+		}
+	}
+
+	return valid, invalid
+}
+
+// SuspiciousMetric returns a reason the metric name looks like it belongs
+// to a different naming scheme, or "" if it looks like a Graphite metric.
+// Names containing "/" or whitespace, or no "." at all, are suspicious.
+func SuspiciousMetric(m string) string {
+	switch {
+	case strings.ContainsRune(m, '/'):
+		return "contains /"
+	case strings.IndexFunc(m, unicode.IsSpace) >= 0:
+		return "contains whitespace"
+	case !strings.ContainsRune(m, '.'):
+		return "has no dots"
+	}
+	return ""
+}
+
+// SuspiciousMetrics returns the given metrics for which SuspiciousMetric()
+// returns a reason.
+func SuspiciousMetrics(metrics []string) []string {
+	result := make([]string, 0)
+	for _, m := range metrics {
+		if SuspiciousMetric(m) != "" {
+			result = append(result, m)
+		}
+	}
+
+	return result
+}
+
+// sampleMetrics returns pct percent of the metrics, rounded to the nearest
+// metric but at least one, chosen uniformly by a random source seeded with
+// seed.  The same seed and metrics in the same order give the same sample.
+// The sample keeps the order of the metrics.
+func sampleMetrics(metrics []string, pct float64, seed int64) []string {
+	n := int(math.Round(pct / 100 * float64(len(metrics))))
+	if n < 1 && len(metrics) > 0 {
+		n = 1
+	}
+	if n >= len(metrics) {
+		return metrics
+	}
+
+	chosen := rand.New(rand.NewSource(seed)).Perm(len(metrics))[:n]
+	sort.Ints(chosen)
+	result := make([]string, 0, n)
+	for _, i := range chosen {
+		result = append(result, metrics[i])
+	}
+	return result
+}
+
+// excludePrefixes returns the metrics that are not under any of the given
+// prefixes and the number left out.  A metric is under a prefix if it is
+// the prefix or starts with the prefix and a ".".  A trailing ".*" on a
+// prefix is ignored.
+func excludePrefixes(metrics, prefixes []string) ([]string, int) {
+	trimmed := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		trimmed = append(trimmed, strings.TrimSuffix(strings.TrimSuffix(p, ".*"), "."))
+	}
+
+	result := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		excluded := false
+		for _, p := range trimmed {
+			if m == p || strings.HasPrefix(m, p+".") {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			result = append(result, m)
+		}
+	}
+
+	return result, len(metrics) - len(result)
+}
+
+// skipInvalidMetrics returns the metrics that pass ValidateMetric() and a
+// map of each metric that does not to the reason it was skipped.
+func skipInvalidMetrics(metrics []string) ([]string, map[string]string) {
+	valid := make([]string, 0, len(metrics))
+	skipped := make(map[string]string)
+	for _, m := range metrics {
+		if err := ValidateMetric(m); err != nil {
+			skipped[m] = err.Error()
+		} else {
+			valid = append(valid, m)
+		}
+	}
+
+	return valid, skipped
+}
+
+// logSkipped logs the count of the skipped metrics in the map of metric =>
+// reason and up to sampleSize of the reasons in sorted order.
+func logSkipped(skipped map[string]string) {
+	metrics := make([]string, 0, len(skipped))
+	for m := range skipped {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+
+	log.Printf("%d metrics skipped:", len(metrics))
+	for i, m := range metrics {
+		if i == sampleSize {
+			log.Printf("\t...")
+			break
+		}
+		log.Printf("\t%s", skipped[m])
+	}
+}
+
+// logSample logs the count of the given metrics with the message msg and
+// up to sampleSize of the metric names.
+func logSample(msg string, metrics []string) {
+	log.Printf("%d %s", len(metrics), msg)
+	for i, m := range metrics {
+		if i == sampleSize {
+			log.Printf("\t...")
+			break
+		}
+		log.Printf("\t%q", m)
+	}
+}
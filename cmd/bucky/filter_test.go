@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestValidateMetric(t *testing.T) {
+	data := map[string]bool{
+		"carbon.agents.graphite010-g5.cpuUsage": true,
+		"1min.app_server:8080.requests#total":   true,
+		"":                                      false,
+		"foo bar.baz":                           false,
+		"foo\tbar":                              false,
+		"foo..bar":                              false,
+		".foo.bar":                              false,
+		"foo.bar.":                              false,
+		"foo/bar":                               false,
+	}
+
+	for m, ok := range data {
+		err := ValidateMetric(m)
+		if ok && err != nil {
+			t.Errorf("ValidateMetric(%q) rejected a valid name: %s", m, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("ValidateMetric(%q) accepted an invalid name", m)
+		}
+	}
+}
+
+func TestValidateMetricTagged(t *testing.T) {
+	data := map[string]bool{
+		"disk.used;datacenter=dc1;server=web01": true,
+		"disk.used;rack=a=b":                    true,
+		"disk.used":                             true,
+		"disk..used;datacenter=dc1":             false,
+		"disk used;datacenter=dc1":              false,
+		"disk.used;datacenter":                  false,
+		"disk.used;=dc1":                        false,
+		"disk.used;datacenter=":                 false,
+		"disk.used;":                            false,
+		"disk.used;data!center=dc1":             false,
+		"disk.used;datacenter=dc~1":             false,
+		"disk.used;datacenter=dc 1":             false,
+		";datacenter=dc1":                       false,
+	}
+
+	defer func() { locateTagged = false }()
+	locateTagged = false
+	if ValidateMetric("disk.used;datacenter=dc1") == nil {
+		t.Errorf("ValidateMetric() accepted a tagged series without --tagged")
+	}
+
+	locateTagged = true
+	for m, ok := range data {
+		err := ValidateMetric(m)
+		if ok && err != nil {
+			t.Errorf("ValidateMetric(%q) rejected a valid tagged series: %s", m, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("ValidateMetric(%q) accepted an invalid tagged series", m)
+		}
+	}
+}
+
+func TestSkipInvalidMetrics(t *testing.T) {
+	valid, skipped := skipInvalidMetrics([]string{"foo.bar", "", "foo..bar", "foo.baz"})
+	if len(valid) != 2 || valid[0] != "foo.bar" || valid[1] != "foo.baz" {
+		t.Errorf("skipInvalidMetrics kept %v", valid)
+	}
+	if len(skipped) != 2 || skipped[""] == "" || skipped["foo..bar"] == "" {
+		t.Errorf("skipInvalidMetrics skipped %v", skipped)
+	}
+}
+
+func TestSuspiciousMetric(t *testing.T) {
+	data := map[string]bool{
+		"carbon.agents.graphite010-g5.cpuUsage": false,
+		"carbon/agents/graphite010-g5/cpuUsage": true,
+		"carbon.agents.cpu usage":               true,
+		"carbon.agents.cpu\tusage":              true,
+		"cpuUsage":                              true,
+	}
+
+	for m, suspicious := range data {
+		if r := SuspiciousMetric(m); (r != "") != suspicious {
+			t.Errorf("SuspiciousMetric(%q) returned %q", m, r)
+		}
+	}
+}
+
+func TestExcludePrefixes(t *testing.T) {
+	metrics := []string{
+		"carbon.agents.graphite010.cpuUsage",
+		"carbon",
+		"carbonara.recipes",
+		"app.foo.requests",
+		"app.bar.requests",
+	}
+
+	kept, excluded := excludePrefixes(metrics, []string{"carbon", "app.foo.*"})
+	if excluded != 3 || len(kept) != 2 || kept[0] != "carbonara.recipes" || kept[1] != "app.bar.requests" {
+		t.Errorf("excludePrefixes excluded %d and kept %v", excluded, kept)
+	}
+}
+
+func TestSampleMetrics(t *testing.T) {
+	metrics := make([]string, 1000)
+	for i := range metrics {
+		metrics[i] = fmt.Sprintf("foo.bar%04d", i)
+	}
+
+	sample := sampleMetrics(metrics, 2.5, 1)
+	if len(sample) != 25 {
+		t.Fatalf("sampleMetrics() of 2.5%% returned %d of 1000 metrics", len(sample))
+	}
+	for i := 1; i < len(sample); i++ {
+		if sample[i-1] >= sample[i] {
+			t.Errorf("sampleMetrics() did not keep the input order: %v", sample)
+			break
+		}
+	}
+	if again := sampleMetrics(metrics, 2.5, 1); !reflect.DeepEqual(sample, again) {
+		t.Errorf("sampleMetrics() with the same seed returned %v, then %v", sample, again)
+	}
+	if other := sampleMetrics(metrics, 2.5, 2); reflect.DeepEqual(sample, other) {
+		t.Errorf("sampleMetrics() with another seed returned the same sample")
+	}
+
+	if n := len(sampleMetrics(metrics, 0.01, 1)); n != 1 {
+		t.Errorf("sampleMetrics() of 0.01%% returned %d metrics, rather than 1", n)
+	}
+	if n := len(sampleMetrics(metrics, 100, 1)); n != 1000 {
+		t.Errorf("sampleMetrics() of 100%% returned %d metrics, rather than 1000", n)
+	}
+	if n := len(sampleMetrics([]string{}, 50, 1)); n != 0 {
+		t.Errorf("sampleMetrics() of no metrics returned %d metrics", n)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OutputFormatFunc writes the map of metric => host returned by
+// LocateSliceMetrics() to w in an output format.
+type OutputFormatFunc func(w io.Writer, results map[string]string) error
+
+var formatsLock sync.RWMutex
+var outputFormats = make(map[string]OutputFormatFunc)
+
+func init() {
+	RegisterOutputFormat("text", func(w io.Writer, results map[string]string) error {
+		writeTextLocations(w, results, locateSortBy)
+		return nil
+	})
+	RegisterOutputFormat("json", func(w io.Writer, results map[string]string) error {
+		return WriteJSON(w, results)
+	})
+	RegisterOutputFormat("csv", writeCSVLocations)
+}
+
+// RegisterOutputFormat makes the output format fn available to locate as
+// --format=name.  It is meant to be called from an init() function so that
+// builds may add their own formats.  It panics if name is empty, holds
+// whitespace, is already registered, or if fn is nil.
+func RegisterOutputFormat(name string, fn func(w io.Writer, results map[string]string) error) {
+	formatsLock.Lock()
+	defer formatsLock.Unlock()
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		panic(fmt.Sprintf("RegisterOutputFormat: invalid format name %q", name))
+	}
+	if fn == nil {
+		panic("RegisterOutputFormat: nil writer for format " + name)
+	}
+	if _, ok := outputFormats[name]; ok {
+		panic("RegisterOutputFormat: format registered twice: " + name)
+	}
+	outputFormats[name] = fn
+}
+
+// LookupOutputFormat returns the output format registered as name.
+func LookupOutputFormat(name string) (OutputFormatFunc, bool) {
+	formatsLock.RLock()
+	defer formatsLock.RUnlock()
+	fn, ok := outputFormats[name]
+	return fn, ok
+}
+
+// OutputFormats returns the sorted names of the registered output formats.
+func OutputFormats() []string {
+	formatsLock.RLock()
+	defer formatsLock.RUnlock()
+	names := make([]string, 0, len(outputFormats))
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeCSVLocations writes the map of metric => host as CSV with a
+// "metric,host" header, ordered as sortedLocations() orders them by
+// --sort-by.
+func writeCSVLocations(w io.Writer, results map[string]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"metric", "host"}); err != nil {
+		return err
+	}
+	for _, m := range sortedLocations(results, locateSortBy) {
+		if err := cw.Write([]string{m, results[m]}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestOutputFormats(t *testing.T) {
+	for _, name := range []string{"text", "json", "csv"} {
+		if _, ok := LookupOutputFormat(name); !ok {
+			t.Errorf("Built-in output format %s is not registered", name)
+		}
+	}
+	if _, ok := LookupOutputFormat("bogus"); ok {
+		t.Errorf("LookupOutputFormat() found an unregistered format")
+	}
+
+	RegisterOutputFormat("test-count", func(w io.Writer, results map[string]string) error {
+		_, err := fmt.Fprintf(w, "%d\n", len(results))
+		return err
+	})
+	defer func() {
+		formatsLock.Lock()
+		delete(outputFormats, "test-count")
+		formatsLock.Unlock()
+	}()
+	if names := OutputFormats(); !reflect.DeepEqual(names, []string{"csv", "json", "test-count", "text"}) {
+		t.Errorf("OutputFormats() returned %v", names)
+	}
+	buf := new(bytes.Buffer)
+	fn, _ := LookupOutputFormat("test-count")
+	if err := fn(buf, map[string]string{"a": "b", "c": "d"}); err != nil || buf.String() != "2\n" {
+		t.Errorf("Registered format wrote %q, %v", buf.String(), err)
+	}
+
+	for _, name := range []string{"text", "", "a b"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterOutputFormat(%q) did not panic", name)
+				}
+			}()
+			RegisterOutputFormat(name, writeCSVLocations)
+		}()
+	}
+}
+
+func TestWriteCSVLocations(t *testing.T) {
+	list := map[string]string{
+		"foo.bar":      "graphite010",
+		"abc,def":      "graphite011",
+		"carbon.agent": "graphite010",
+	}
+	expected := "metric,host\n\"abc,def\",graphite011\ncarbon.agent,graphite010\nfoo.bar,graphite010\n"
+
+	buf := new(bytes.Buffer)
+	if err := writeCSVLocations(buf, list); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("writeCSVLocations() wrote %q, rather than %q", buf.String(), expected)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// graphiteNode is an entry in the JSON response of graphite-web's
+// /metrics/find API.  Leaf is 1 for metrics and 0 for branches.
+type graphiteNode struct {
+	ID   string `json:"id"`
+	Leaf int    `json:"leaf"`
+}
+
+// graphiteURL returns the graphite-web API URL for the metric index at the
+// given base URL.  An empty query asks for the full /metrics/index.json,
+// otherwise /metrics/find is asked for the metrics matching the query.
+func graphiteURL(base, query string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimRight(base, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("Graphite URL must be of the form http://host[:port]: %s", base)
+	}
+
+	if query == "" {
+		u.Path += "/metrics/index.json"
+	} else {
+		u.Path += "/metrics/find"
+		u.RawQuery = url.Values{"query": []string{query}}.Encode()
+	}
+	return u, nil
+}
+
+// FetchGraphiteMetrics returns the metric names known to the graphite-web
+// instance at the given base URL.  The full metric index is fetched unless
+// a find query is given.  The response is decoded as it streams in and the
+// same maxCount and maxBytes limits as readJSONMetrics() apply.  Requests
+// use the shared HTTP client and credentials may be given in the URL.
+func FetchGraphiteMetrics(base, query string, maxCount int, maxBytes int64) ([]string, error) {
+	u, err := graphiteURL(base, query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := GetHTTP().Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Error fetching %s: %s", u.Redacted(), resp.Status)
+	}
+
+	if query == "" {
+		return readJSONMetrics(resp.Body, maxCount, maxBytes)
+	}
+	return readGraphiteFind(resp.Body, maxCount, maxBytes)
+}
+
+// readGraphiteFind decodes the JSON array of a /metrics/find response from
+// fd and returns the metric names of its leaf nodes.  Limits are as for
+// readJSONMetrics().
+func readGraphiteFind(fd io.Reader, maxCount int, maxBytes int64) ([]string, error) {
+	dec := json.NewDecoder(&limitReader{r: fd, max: maxBytes})
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := t.(json.Delim); !ok || d != '[' {
+		return nil, fmt.Errorf("Expected a JSON array of graphite nodes")
+	}
+
+	metrics := make([]string, 0)
+	for dec.More() {
+		var n graphiteNode
+		if err := dec.Decode(&n); err != nil {
+			return nil, err
+		}
+		if n.Leaf != 1 {
+			continue
+		}
+		metrics = append(metrics, n.ID)
+		if err := checkMaxInput(len(metrics), maxCount); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchGraphiteMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/graphite/metrics/index.json":
+			fmt.Fprint(w, `["carbon.agents.a.cpuUsage", "foo.bar"]`)
+		case "/graphite/metrics/find":
+			if r.URL.Query().Get("query") != "carbon.agents.*" {
+				http.Error(w, "bad query", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `[{"id": "carbon.agents.a", "leaf": 0, "text": "a"},
+				{"id": "carbon.agents.cpuUsage", "leaf": 1, "text": "cpuUsage"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	metrics, err := FetchGraphiteMetrics(ts.URL+"/graphite/", "", 0, 0)
+	if err != nil {
+		t.Fatalf("FetchGraphiteMetrics returned error: %s", err)
+	}
+	if len(metrics) != 2 || metrics[0] != "carbon.agents.a.cpuUsage" || metrics[1] != "foo.bar" {
+		t.Errorf("FetchGraphiteMetrics returned %v from the index", metrics)
+	}
+
+	metrics, err = FetchGraphiteMetrics(ts.URL+"/graphite", "carbon.agents.*", 0, 0)
+	if err != nil {
+		t.Fatalf("FetchGraphiteMetrics returned error: %s", err)
+	}
+	if len(metrics) != 1 || metrics[0] != "carbon.agents.cpuUsage" {
+		t.Errorf("FetchGraphiteMetrics returned %v from find", metrics)
+	}
+
+	if _, err := FetchGraphiteMetrics(ts.URL+"/graphite", "", 1, 0); err == nil {
+		t.Errorf("FetchGraphiteMetrics ignored the metric limit")
+	}
+	if _, err := FetchGraphiteMetrics(ts.URL+"/missing", "", 0, 0); err == nil {
+		t.Errorf("FetchGraphiteMetrics did not return an error for a 404")
+	}
+}
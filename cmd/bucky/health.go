@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// HostHealth is the health of a single server of the cluster.
+type HostHealth struct {
+	// Status is "ok", "unreachable", or "mismatch" if the server's hash
+	// ring does not match the ring of the initial buckyd daemon
+	Status string `json:"status"`
+
+	// Error describes why the server is unhealthy
+	Error string `json:"error,omitempty"`
+}
+
+// HealthStatus describes the health of the cluster.
+type HealthStatus struct {
+	// Healthy is the overall verdict
+	Healthy bool `json:"healthy"`
+
+	// Hosts maps each server in the hash ring to its health
+	Hosts map[string]HostHealth `json:"hosts"`
+
+	// Errors lists every problem found, as HealthReport() does
+	Errors []string `json:"errors"`
+}
+
+func init() {
+	usage := "[options]"
+	short := "Check the health of the Graphite cluster."
+	long := `Fetch the hash ring from every buckyd daemon in the cluster and report
+the health of each server and of the cluster as a whole.  A server is "ok"
+if its hash ring matches that of the initial buckyd daemon, "unreachable" if
+its daemon could not be contacted, or "mismatch" if its hash ring differs.
+We exit non-zero unless the cluster is healthy.  No metrics are needed.
+
+Use -j for a JSON object holding the "healthy" verdict, a "hosts" map of
+server to its status, and the list of all "errors" found.`
+
+	c := NewCommand(healthCommand, "health", usage, short, long)
+	SetupCommon(c)
+	SetupHostname(c)
+	SetupJSON(c)
+}
+
+// NewHealthStatus returns the HealthStatus of the given cluster.
+func NewHealthStatus(c *ClusterConfig) *HealthStatus {
+	h := &HealthStatus{
+		Healthy: c.Healthy,
+		Hosts:   make(map[string]HostHealth),
+		Errors:  make([]string, 0),
+	}
+
+	for _, s := range c.Servers {
+		h.Hosts[s] = HostHealth{Status: "ok"}
+	}
+	for i, r := range c.Rings {
+		if i == 0 {
+			continue
+		}
+		for _, err := range consistencyErrors(c.Rings[0], c.Rings[i:i+1]) {
+			h.Hosts[r.Name] = HostHealth{Status: "mismatch", Error: err.Error()}
+		}
+	}
+
+	for _, err := range c.Errors {
+		errs := []error{err}
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			errs = joined.Unwrap()
+		}
+		for _, e := range errs {
+			h.Errors = append(h.Errors, e.Error())
+			var hostErr *HostError
+			if errors.As(e, &hostErr) {
+				h.Hosts[hostErr.Server] = HostHealth{Status: "unreachable", Error: hostErr.Err.Error()}
+			}
+		}
+	}
+
+	return h
+}
+
+// healthCommand runs this subcommand.
+func healthCommand(c Command) int {
+	_, err := GetClusterConfig(HostPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	h := NewHealthStatus(Cluster)
+	if JSONOutput {
+		err = WriteJSON(os.Stdout, h)
+		if err != nil {
+			log.Printf("Error encoding JSON output: %s", err)
+			return 1
+		}
+	} else {
+		servers := make([]string, 0, len(h.Hosts))
+		for s := range h.Hosts {
+			servers = append(servers, s)
+		}
+		sort.Strings(servers)
+		for _, s := range servers {
+			fmt.Printf("%s: %s\n", s, h.Hosts[s].Status)
+		}
+		fmt.Printf("Is cluster healthy: %v\n", h.Healthy)
+		for _, e := range h.Errors {
+			log.Print(e)
+		}
+	}
+
+	if !h.Healthy {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestNewHealthStatus(t *testing.T) {
+	nodes := []hashing.Node{
+		hashing.NewNode("graphite010", 2004, ""),
+		hashing.NewNode("graphite011", 2004, ""),
+		hashing.NewNode("graphite012", 2004, ""),
+	}
+	master := &hashing.JSONRingType{Name: "graphite010", Algo: "carbon", Replicas: 100, Nodes: nodes}
+	other := &hashing.JSONRingType{Name: "graphite011", Algo: "fnv1a", Replicas: 100, Nodes: nodes}
+
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{master, other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Errors = append(c.Errors, errors.Join(&HostError{"graphite012", "graphite012:4242", errors.New("connection refused")}))
+	c.Errors = append(c.Errors, healthErrors(master, []*hashing.JSONRingType{other})...)
+
+	h := NewHealthStatus(c)
+	if h.Healthy {
+		t.Errorf("Unhealthy cluster reported as healthy")
+	}
+	expected := map[string]string{
+		"graphite010": "ok",
+		"graphite011": "mismatch",
+		"graphite012": "unreachable",
+	}
+	if len(h.Hosts) != len(expected) {
+		t.Errorf("NewHealthStatus() returned hosts %v", h.Hosts)
+	}
+	for s, status := range expected {
+		if h.Hosts[s].Status != status {
+			t.Errorf("Host %s is %s, expected %s", s, h.Hosts[s].Status, status)
+		}
+	}
+	if len(h.Errors) != 3 {
+		t.Errorf("NewHealthStatus() returned errors %q", h.Errors)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// HostMapFile is the file given by --host-map mapping carbon instances
+// to the hosts we connect to.
+var HostMapFile string
+
+// hostMap is the mapping read from HostMapFile by LoadHostMap().
+var hostMap map[string]string
+
+// SetupHostMap installs the --host-map flag.  Commands must call
+// LoadHostMap() before connecting to hosts found in the hash ring.
+func SetupHostMap(c Command) {
+	c.Flag.StringVar(&HostMapFile, "host-map", "",
+		"File mapping carbon instances to the hosts to connect to.")
+}
+
+// LoadHostMap reads the --host-map file, if one was given.
+func LoadHostMap() error {
+	if HostMapFile == "" {
+		return nil
+	}
+	fd, err := os.Open(HostMapFile)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	hostMap, err = readHostMap(fd)
+	if err != nil {
+		return fmt.Errorf("Error reading host map %s: %s", HostMapFile, err)
+	}
+	log.Printf("Read %d host mappings from %s", len(hostMap), HostMapFile)
+	return nil
+}
+
+// readHostMap parses a host map.  This is either a JSON object of
+// instance => host or text with an instance and a host on each line
+// separated by whitespace.  Blank lines and "#" comments are ignored.
+func readHostMap(fd io.Reader) (map[string]string, error) {
+	blob, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	if bytes.HasPrefix(bytes.TrimSpace(blob), []byte("{")) {
+		err = json.Unmarshal(blob, &result)
+		return result, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(blob))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected an instance and a host", line)
+		}
+		result[fields[0]] = fields[1]
+	}
+	return result, scanner.Err()
+}
+
+// connectHost returns the host to connect to for the given Node of the
+// hash ring.  The host map is searched for the Node as server:instance,
+// then its instance, then its server.  Without a mapping this is the
+// Node's server.  Placement always uses the Node itself.
+func connectHost(n hashing.Node) string {
+	keys := []string{n.Server}
+	if n.Instance != "" {
+		keys = []string{n.Server + ":" + n.Instance, n.Instance, n.Server}
+	}
+	for _, k := range keys {
+		if host, ok := hostMap[k]; ok {
+			return host
+		}
+	}
+	return n.Server
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestReadHostMap(t *testing.T) {
+	text := `# carbon instance to ssh host
+a     graphite010.example.com
+graphite011:b graphite011-b.example.com
+
+graphite012 10.0.0.12
+`
+	expected := map[string]string{
+		"a":             "graphite010.example.com",
+		"graphite011:b": "graphite011-b.example.com",
+		"graphite012":   "10.0.0.12",
+	}
+	for _, data := range []string{text, `{"a": "graphite010.example.com",
+		"graphite011:b": "graphite011-b.example.com", "graphite012": "10.0.0.12"}`} {
+		m, err := readHostMap(strings.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m) != len(expected) {
+			t.Errorf("readHostMap() returned %v", m)
+		}
+		for k, v := range expected {
+			if m[k] != v {
+				t.Errorf("readHostMap() mapped %s to %s, rather than %s", k, m[k], v)
+			}
+		}
+	}
+
+	if _, err := readHostMap(strings.NewReader("a b c\n")); err == nil {
+		t.Errorf("readHostMap() accepted a line of 3 fields")
+	}
+}
+
+func TestConnectHost(t *testing.T) {
+	hostMap = map[string]string{
+		"a":             "graphite010.example.com",
+		"graphite011:b": "graphite011-b.example.com",
+		"graphite012":   "10.0.0.12",
+	}
+	defer func() { hostMap = nil }()
+
+	data := map[hashing.Node]string{
+		hashing.NewNode("graphite010", 2004, "a"): "graphite010.example.com",
+		hashing.NewNode("graphite011", 2004, "b"): "graphite011-b.example.com",
+		hashing.NewNode("graphite011", 2004, "c"): "graphite011",
+		hashing.NewNode("graphite012", 2004, "c"): "10.0.0.12",
+		hashing.NewNode("graphite013", 2004, ""):  "graphite013",
+	}
+	for n, host := range data {
+		if h := connectHost(n); h != host {
+			t.Errorf("connectHost(%s) returned %s, rather than %s", n, h, host)
+		}
+	}
+}
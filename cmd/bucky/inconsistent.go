@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"net"
@@ -13,6 +12,10 @@ import (
 
 // import "github.com/jjneely/buckytools/hashing"
 
+// consistentReplicas is the number of replicas of each metric a metric may
+// be stored on and be consistent, or 0 for the hash ring's replicas.
+var consistentReplicas int
+
 func init() {
 	usage := "[options]"
 	short := "Find metrics not in correct locations."
@@ -24,6 +27,11 @@ ring matches the location where the metric is found.  Print to STDOUT
 server:metric for each metric that is in the wrong location.  The server
 is the server the metric is presently found on.
 
+When the cluster replicates metrics a metric is consistent if it is found on
+any of the servers owning its replicas.  That is as many as the hash ring's
+replicas, as advertised by buckyd, or as given by --replicas.  Use
+audit-replicas to find metrics missing from some of their replicas.
+
 Use bucky rebalance to correct.`
 
 	c := NewCommand(inconsistentCommand, "inconsistent", usage, short, long)
@@ -34,8 +42,35 @@ Use bucky rebalance to correct.`
 
 	c.Flag.BoolVar(&listForce, "f", false,
 		"Force the remote daemons to rebuild their cache.")
+	c.Flag.IntVar(&consistentReplicas, "replicas", 0,
+		"Replicas of each metric, 0 for the hash ring's replicas.")
 }
 
+// consistentServers returns the distinct servers owning the n replicas of
+// the metric, or of the hash ring's replicas if n is 0.
+func consistentServers(metric string, n int) []string {
+	if n == 0 {
+		n = ringReplicas()
+	}
+	if l := Cluster.Hash.Len(); n > l {
+		n = l
+	}
+	if n <= 1 {
+		return []string{Cluster.Hash.GetNode(metric).Server}
+	}
+
+	servers := make([]string, 0, n)
+	for _, node := range Cluster.Hash.GetNodes(metric, n) {
+		if !containsString(servers, node.Server) {
+			servers = append(servers, node.Server)
+		}
+	}
+	return servers
+}
+
+// InconsistentMetrics returns a map of server host:port => the metrics
+// found there that the server does not own a replica of, as given by
+// consistentServers() and --replicas.
 func InconsistentMetrics(hostports []string) (map[string][]string, error) {
 	var list map[string][]string
 	var err error
@@ -61,7 +96,7 @@ func InconsistentMetrics(hostports []string) (map[string][]string, error) {
 				// is done.  They will never be consistent and shouldn't be.
 				continue
 			}
-			if Cluster.Hash.GetNode(m).Server != host {
+			if !containsString(consistentServers(m, consistentReplicas), host) {
 				results[server] = append(results[server], m)
 			}
 		}
@@ -82,6 +117,11 @@ func InconsistentMetrics(hostports []string) (map[string][]string, error) {
 
 // inconsistentCommand runs this subcommand.
 func inconsistentCommand(c Command) int {
+	if consistentReplicas < 0 {
+		log.Print("--replicas must not be negative.")
+		return 1
+	}
+
 	_, err := GetClusterConfig(HostPort)
 	if err != nil {
 		log.Print(err)
@@ -93,12 +133,9 @@ func inconsistentCommand(c Command) int {
 	}
 	results, err := InconsistentMetrics(Cluster.HostPorts())
 	if JSONOutput {
-		blob, err := json.Marshal(results)
+		err = WriteJSON(os.Stdout, results)
 		if err != nil {
 			log.Printf("%s", err)
-		} else {
-			os.Stdout.Write(blob)
-			os.Stdout.Write([]byte("\n"))
 		}
 	} else {
 		for server, metrics := range results {
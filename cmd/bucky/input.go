@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// defaultMaxInput is the default limit on the number of input metrics
+	defaultMaxInput = 10000000
+
+	// defaultMaxInputBytes is the default limit on the size of input read
+	// from STDIN
+	defaultMaxInputBytes = 1 << 30
+)
+
+// limitReader is an io.Reader that returns an error rather than any data
+// beyond the first max bytes read from r.  A max of 0 means no limit.
+type limitReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.max > 0 && l.n > l.max {
+		return 0, fmt.Errorf("Input exceeds the limit of %d bytes", l.max)
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.max > 0 && l.n > l.max {
+		return n - int(l.n-l.max), fmt.Errorf("Input exceeds the limit of %d bytes", l.max)
+	}
+	return n, err
+}
+
+// checkMaxInput returns an error if count exceeds max.  A max of 0 means
+// no limit.
+func checkMaxInput(count, max int) error {
+	if max > 0 && count > max {
+		return fmt.Errorf("Input exceeds the limit of %d metrics", max)
+	}
+	return nil
+}
+
+// readJSONMetrics decodes a JSON array of metric names from fd.  Metrics
+// are counted as they are decoded and an error is returned as soon as more
+// than maxCount metrics or maxBytes bytes are read.  Zero values mean no
+// limit.
+func readJSONMetrics(fd io.Reader, maxCount int, maxBytes int64) ([]string, error) {
+	metrics := make([]string, 0)
+	err := streamJSONMetrics(fd, maxCount, maxBytes, func(m string) error {
+		metrics = append(metrics, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+// streamJSONMetrics is like readJSONMetrics but calls fn with each metric
+// as it is decoded rather than returning them.  An error from fn stops
+// the decoding and is returned.
+func streamJSONMetrics(fd io.Reader, maxCount int, maxBytes int64, fn func(string) error) error {
+	dec := json.NewDecoder(&limitReader{r: fd, max: maxBytes})
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := t.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("Expected a JSON array of metric names")
+	}
+
+	count := 0
+	for dec.More() {
+		var m string
+		if err := dec.Decode(&m); err != nil {
+			return err
+		}
+		count++
+		if err := checkMaxInput(count, maxCount); err != nil {
+			return err
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// readMetrics reads a list of metric names from fd that is either a JSON
+// array or newline separated, as produced by whisper-find and carbonate.
+// The input is sniffed as streamMetrics() does, so empty input is an empty
+// list.  Only the metric names are held in memory.  Limits are as for
+// readJSONMetrics().
+func readMetrics(fd io.Reader, maxCount int, maxBytes int64) ([]string, error) {
+	metrics := make([]string, 0)
+	err := streamMetrics(fd, maxCount, maxBytes, func(m string) error {
+		metrics = append(metrics, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+// streamMetrics is like readMetrics but calls fn with each metric as it is
+// read rather than returning them.  If the first byte that is not
+// whitespace is "[" the input is decoded as by streamJSONMetrics(),
+// otherwise each line is a metric name with surrounding whitespace trimmed
+// and blank lines skipped.  An error from fn stops the reading and is
+// returned.
+func streamMetrics(fd io.Reader, maxCount int, maxBytes int64, fn func(string) error) error {
+	r := bufio.NewReader(&limitReader{r: fd, max: maxBytes})
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !unicode.IsSpace(rune(b)) {
+			r.UnreadByte()
+			if b == '[' {
+				return streamJSONMetrics(r, maxCount, 0, fn)
+			}
+			break
+		}
+	}
+
+	count := 0
+	return readLines(r, func(line string) error {
+		m := strings.TrimSpace(line)
+		if m == "" {
+			return nil
+		}
+		count++
+		if err := checkMaxInput(count, maxCount); err != nil {
+			return err
+		}
+		return fn(m)
+	})
+}
+
+// readLines calls fn with each line read from r without its line ending,
+// as a bufio.Scanner splits lines.  ReadString() is used rather than a
+// Scanner so that the length of a line is only limited by the reader.  An
+// error from fn stops the reading and is returned.
+func readLines(r *bufio.Reader, fn func(string) error) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == io.EOF && line == "" {
+			return nil
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if err := fn(line); err != nil {
+			return err
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// isComment returns true if the line of text input is blank or a comment
+// starting with "#".
+func isComment(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "#")
+}
+
+// readTextLines reads the newline separated lines of text from fd.  An
+// error is returned as soon as more than maxCount lines that are not
+// comments or maxBytes bytes are read.  Zero values mean no limit.
+func readTextLines(fd io.Reader, maxCount int, maxBytes int64) ([]string, error) {
+	lines := make([]string, 0)
+	count := 0
+	err := readLines(bufio.NewReader(&limitReader{r: fd, max: maxBytes}), func(line string) error {
+		lines = append(lines, line)
+		if !isComment(line) {
+			count++
+			return checkMaxInput(count, maxCount)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+// textMetrics returns the metric names in the lines of text input,
+// skipping comments and blank lines.
+func textMetrics(lines []string) []string {
+	metrics := make([]string, 0, len(lines))
+	for _, l := range lines {
+		if !isComment(l) {
+			metrics = append(metrics, strings.TrimSpace(l))
+		}
+	}
+
+	return metrics
+}
+
+// weightedMetrics returns the metric names in the lines of text input and
+// a map of metric => weight.  Each line is a metric optionally followed by
+// whitespace and a non-negative weight, such as its recent datapoint count.
+// Metrics without a weight are left out of the map and a metric given more
+// than once keeps its greatest weight.  Comments and blank lines are
+// skipped.
+func weightedMetrics(lines []string) ([]string, map[string]float64, error) {
+	metrics := make([]string, 0, len(lines))
+	weights := make(map[string]float64)
+	for i, l := range lines {
+		if isComment(l) {
+			continue
+		}
+		fields := strings.Fields(l)
+		if len(fields) > 2 {
+			return nil, nil, fmt.Errorf("Line %d: expected a metric and an optional weight: %s", i+1, l)
+		}
+		metrics = append(metrics, fields[0])
+		if len(fields) == 1 {
+			continue
+		}
+		w, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || w < 0 {
+			return nil, nil, fmt.Errorf("Line %d: invalid weight %q for %s", i+1, fields[1], fields[0])
+		}
+		if old, ok := weights[fields[0]]; !ok || w > old {
+			weights[fields[0]] = w
+		}
+	}
+
+	return metrics, weights, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadJSONMetrics(t *testing.T) {
+	input := `["foo.bar", "foo.baz", "foo.qux"]`
+
+	metrics, err := readJSONMetrics(strings.NewReader(input), 0, 0)
+	if err != nil {
+		t.Fatalf("readJSONMetrics returned an error: %s", err)
+	}
+	if len(metrics) != 3 || metrics[2] != "foo.qux" {
+		t.Errorf("readJSONMetrics returned %v", metrics)
+	}
+
+	if _, err := readJSONMetrics(strings.NewReader(input), 3, 0); err != nil {
+		t.Errorf("readJSONMetrics failed at exactly the count limit: %s", err)
+	}
+	if _, err := readJSONMetrics(strings.NewReader(input), 2, 0); err == nil {
+		t.Errorf("readJSONMetrics did not enforce the count limit")
+	}
+	if _, err := readJSONMetrics(strings.NewReader(input), 0, 10); err == nil {
+		t.Errorf("readJSONMetrics did not enforce the byte limit")
+	}
+	if _, err := readJSONMetrics(strings.NewReader(`{"foo": 1}`), 0, 0); err == nil {
+		t.Errorf("readJSONMetrics accepted a JSON object")
+	}
+}
+
+func TestReadMetrics(t *testing.T) {
+	inputs := []string{
+		`["foo.bar", "foo.baz", "foo.qux"]`,
+		"\n  \t[\"foo.bar\",\n\"foo.baz\", \"foo.qux\"]\n",
+		"foo.bar\nfoo.baz\nfoo.qux\n",
+		"\n  foo.bar\r\n\n\tfoo.baz  \nfoo.qux",
+	}
+	for _, input := range inputs {
+		metrics, err := readMetrics(strings.NewReader(input), 0, 0)
+		if err != nil {
+			t.Errorf("readMetrics(%q) returned an error: %s", input, err)
+			continue
+		}
+		if strings.Join(metrics, " ") != "foo.bar foo.baz foo.qux" {
+			t.Errorf("readMetrics(%q) returned %q", input, metrics)
+		}
+		if _, err := readMetrics(strings.NewReader(input), 2, 0); err == nil {
+			t.Errorf("readMetrics(%q) did not enforce the count limit", input)
+		}
+		if _, err := readMetrics(strings.NewReader(input), 0, 10); err == nil {
+			t.Errorf("readMetrics(%q) did not enforce the byte limit", input)
+		}
+	}
+
+	if metrics, err := readMetrics(strings.NewReader(" \n\n"), 0, 0); err != nil || len(metrics) != 0 {
+		t.Errorf("readMetrics() of blank input returned %v, %v", metrics, err)
+	}
+	if _, err := readMetrics(strings.NewReader(`["foo.bar", 1]`), 0, 0); err == nil {
+		t.Errorf("readMetrics() accepted malformed JSON")
+	}
+}
+
+func TestReadMetricsLongLine(t *testing.T) {
+	long := "foo." + strings.Repeat("x", 128*1024)
+	input := "foo.bar\n" + long + "\nfoo.baz\n"
+
+	metrics, err := readMetrics(strings.NewReader(input), 0, 0)
+	if err != nil {
+		t.Fatalf("readMetrics() of a %d byte line returned an error: %s", len(long), err)
+	}
+	if len(metrics) != 3 || metrics[1] != long || metrics[2] != "foo.baz" {
+		t.Errorf("readMetrics() returned %d metrics from a long line", len(metrics))
+	}
+	if _, err := readMetrics(strings.NewReader(input), 0, int64(len(input))); err != nil {
+		t.Errorf("readMetrics() of a long line within the byte limit returned an error: %s", err)
+	}
+	if _, err := readMetrics(strings.NewReader(input), 0, 64*1024); err == nil {
+		t.Errorf("readMetrics() did not enforce the byte limit on a long line")
+	}
+
+	// --passthrough-comments and --weighted-sort read text lines
+	text := "# long\r\n" + long + " 2.5\n\nfoo.baz"
+	lines, err := readTextLines(strings.NewReader(text), 0, 0)
+	if err != nil {
+		t.Fatalf("readTextLines() of a %d byte line returned an error: %s", len(long), err)
+	}
+	if len(lines) != 4 || lines[0] != "# long" || lines[2] != "" || lines[3] != "foo.baz" {
+		t.Errorf("readTextLines() returned %d lines from a long line", len(lines))
+	}
+	if metrics := textMetrics(lines); len(metrics) != 2 || metrics[0] != long+" 2.5" {
+		t.Errorf("textMetrics() returned %d metrics from a long line", len(metrics))
+	}
+	metrics, weights, err := weightedMetrics(lines)
+	if err != nil || len(metrics) != 2 || metrics[0] != long || weights[long] != 2.5 {
+		t.Errorf("weightedMetrics() of a long line returned %d metrics, weight %v, %v",
+			len(metrics), weights[long], err)
+	}
+	if _, err := readTextLines(strings.NewReader(text), 0, 64*1024); err == nil {
+		t.Errorf("readTextLines() did not enforce the byte limit on a long line")
+	}
+}
+
+func TestReadTextLines(t *testing.T) {
+	input := "# web tier\nfoo.bar\n\n  # db\n foo.baz \n"
+
+	lines, err := readTextLines(strings.NewReader(input), 0, 0)
+	if err != nil {
+		t.Fatalf("readTextLines returned an error: %s", err)
+	}
+	if len(lines) != 5 || lines[3] != "  # db" {
+		t.Errorf("readTextLines returned %q", lines)
+	}
+	metrics := textMetrics(lines)
+	if len(metrics) != 2 || metrics[0] != "foo.bar" || metrics[1] != "foo.baz" {
+		t.Errorf("textMetrics returned %q", metrics)
+	}
+
+	if _, err := readTextLines(strings.NewReader(input), 2, 0); err != nil {
+		t.Errorf("readTextLines counted comments against the limit: %s", err)
+	}
+	if _, err := readTextLines(strings.NewReader(input), 1, 0); err == nil {
+		t.Errorf("readTextLines did not enforce the count limit")
+	}
+}
+
+func TestWeightedMetrics(t *testing.T) {
+	lines := []string{
+		"# metric weight",
+		"foo.bar 5400",
+		"  foo.baz\t1.5  ",
+		"",
+		"foo.qux",
+		"foo.bar 12",
+	}
+	metrics, weights, err := weightedMetrics(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(metrics, ",") != "foo.bar,foo.baz,foo.qux,foo.bar" {
+		t.Errorf("weightedMetrics() returned metrics %v", metrics)
+	}
+	if len(weights) != 2 || weights["foo.bar"] != 5400 || weights["foo.baz"] != 1.5 {
+		t.Errorf("weightedMetrics() returned weights %v", weights)
+	}
+
+	for _, l := range []string{"foo.bar lots", "foo.bar -1", "foo.bar 1 2"} {
+		if _, _, err := weightedMetrics([]string{l}); err == nil {
+			t.Errorf("weightedMetrics() accepted %q", l)
+		}
+	}
+}
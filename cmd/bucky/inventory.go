@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+)
+
+// inventoryHost is the server whose expected metrics we list.
+var inventoryHost string
+
+// inventoryFromDir is a Whisper DB tree to read metric names from.
+var inventoryFromDir string
+
+func init() {
+	usage := "[options] <metric list>"
+	short := "List the metrics the hash ring places on a server."
+	long := `Locate each given metric with the hash ring and output to STDOUT,
+sorted, only those that belong on the server given by --server.  This is the
+expected set of metrics for that server which can be reconciled against the
+metrics actually found there to find orphans and missing metrics.
+
+Metrics may be listed on the command line as arguments or, if the first
+argument is "-" we read the list on STDIN as a JSON array or one metric per
+line.  Use --from-dir to read the metrics of every Whisper DB found in a
+directory tree instead.
+Use -j to output a JSON array.
+
+Use --since to only list metrics modified on the server within the given
+duration, such as 24h.  Metrics that do not exist on the server yet are left
+out unless --include-missing is given.  Set -w to change the number of worker
+threads used to stat metrics.
+
+Use -s to query the hash ring only on the host given by -h or in the
+BUCKYHOST environment variable.  Without -s, we verify the health of the
+cluster first.  Use --ring-file to build the hash ring from a ring file
+rather than the cluster.`
+
+	c := NewCommand(inventoryCommand, "inventory", usage, short, long)
+	SetupCommon(c)
+	SetupHostname(c)
+	SetupSingle(c)
+	SetupJSON(c)
+	SetupRingFile(c)
+
+	c.Flag.StringVar(&inventoryHost, "server", "",
+		"List the metrics that belong on this server.")
+	c.Flag.StringVar(&inventoryFromDir, "from-dir", "",
+		"Read metrics from the Whisper DBs found in this directory tree.")
+	SetupSince(c)
+	c.Flag.IntVar(&metricWorkers, "w", 5,
+		"Worker threads.")
+}
+
+// InventoryMetrics returns the sorted metrics that the hash ring places on
+// the given server.  An error is returned if the metrics cannot be located.
+func InventoryMetrics(server string, metrics []string) ([]string, error) {
+	list, err := LocateSliceMetrics(metrics)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0)
+	for m, host := range list {
+		if host == server {
+			result = append(result, m)
+		}
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// inventoryCommand runs this subcommand.
+func inventoryCommand(c Command) int {
+	if inventoryHost == "" {
+		log.Print("A server must be given with --server.")
+		return 1
+	}
+
+	_, err := GetClusterConfig(HostPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	var metrics []string
+	if inventoryFromDir != "" {
+		metrics, err = walkMetrics(inventoryFromDir, nil, 0)
+		if err != nil {
+			log.Printf("Error reading %s: %s", inventoryFromDir, err)
+			return 1
+		}
+	} else if c.Flag.NArg() == 0 {
+		log.Print("At least one argument is required.")
+		return 1
+	} else if c.Flag.Arg(0) != "-" {
+		metrics = c.Flag.Args()
+	} else {
+		metrics, err = ReadMetrics(os.Stdin)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+
+	// Locate by server, not server:instance
+	locateCollapse = true
+	result, err := InventoryMetrics(inventoryHost, metrics)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	log.Printf("%d of %d metrics belong on %s", len(result), len(metrics), inventoryHost)
+	if sinceWindow > 0 {
+		hostport := net.JoinHostPort(inventoryHost, Cluster.Port)
+		keep := FilterSince(map[string][]string{hostport: result})
+		recent := make([]string, 0, len(keep))
+		for _, m := range result {
+			if keep[m] {
+				recent = append(recent, m)
+			}
+		}
+		result = recent
+	}
+
+	if JSONOutput {
+		err = WriteJSON(os.Stdout, result)
+		if err != nil {
+			log.Printf("Error encoding JSON output: %s", err)
+			return 1
+		}
+	} else {
+		for _, m := range result {
+			fmt.Println(m)
+		}
+	}
+
+	return 0
+}
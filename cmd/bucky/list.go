@@ -54,7 +54,8 @@ arguments / options this will list every metric in the cluster.
 The default mode is to work with lists.  The arguments are a series of
 one or more metric key names and the results will contain these key names
 if they are present on the cluster/host.  If the first argument is a "-"
-then read a JSON array from STDIN as our list of metrics.
+then read a JSON array or a newline separated list from STDIN as our list
+of metrics.
 
 Use -r to enable regular expression mode.  The first argument is a
 regular expression.  If metrics names match they will be included in the
@@ -287,17 +288,11 @@ func ListSliceMetrics(servers []string, metrics []string, force bool) (map[strin
 // ListJSONMetrics queries buckyd daemons specified in servers for all
 // metrics known to that buckyd daemon and that are present in the
 // io.Reader interface which points to a data source containing a JSON
-// array.  Results are returned in a map of server => metrics.
+// array or newline separated list.  Results are returned in a map of server => metrics.
 func ListJSONMetrics(servers []string, fd io.Reader, force bool) (map[string][]string, error) {
-	// Read the JSON from the file-like object
-	blob, err := ioutil.ReadAll(fd)
-	metrics := make([]string, 0)
-
-	err = json.Unmarshal(blob, &metrics)
-	// We could just package this up and query the server, but lets check the
-	// JSON is valid first.
+	metrics, err := readMetrics(fd, 0, 0)
 	if err != nil {
-		log.Printf("Error unmarshalling JSON data: %s", err)
+		log.Printf("Error reading metrics: %s", err)
 		return nil, err
 	}
 
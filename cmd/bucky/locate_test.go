@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// mustLocate returns LocateSliceMetrics() of the metrics and fails the
+// test on an error.
+func mustLocate(t testing.TB, metrics []string) map[string]string {
+	list, err := LocateSliceMetrics(metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+// mustLocateN returns LocateSliceMetricsN() of the metrics and fails the
+// test on an error.
+func mustLocateN(t testing.TB, metrics []string, n int) map[string][]string {
+	list, err := LocateSliceMetricsN(metrics, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestLocateUnhealthy(t *testing.T) {
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{makeTestRing("carbon", 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Cluster = c
+	defer func() { Cluster = nil }()
+
+	metrics := []string{"foo.bar"}
+	if _, err := LocateSliceMetrics(metrics); err != ErrClusterUnhealthy {
+		t.Errorf("LocateSliceMetrics() returned %v on an unhealthy cluster", err)
+	}
+	if _, err := LocateSliceMetricsN(metrics, 2); err != ErrClusterUnhealthy {
+		t.Errorf("LocateSliceMetricsN() returned %v on an unhealthy cluster", err)
+	}
+	if _, err := LocateJSONMetrics(strings.NewReader("foo.bar\n")); err != ErrClusterUnhealthy {
+		t.Errorf("LocateJSONMetrics() returned %v on an unhealthy cluster", err)
+	}
+	if _, err := ReplicaHosts(metrics, 1); err != ErrClusterUnhealthy {
+		t.Errorf("ReplicaHosts() returned %v on an unhealthy cluster", err)
+	}
+
+	c.Healthy = true
+	if list, err := LocateJSONMetrics(strings.NewReader(`["foo.bar"]`)); err != nil || len(list) != 1 {
+		t.Errorf("LocateJSONMetrics() returned %v, %v", list, err)
+	}
+	if _, err := LocateJSONMetrics(strings.NewReader(`["foo.bar"`)); err == nil {
+		t.Errorf("LocateJSONMetrics() accepted malformed JSON")
+	}
+}
+
+func TestMetricPath(t *testing.T) {
+	data := map[string]string{
+		"bobby.sue.foo.bar": "/var/lib/graphite/whisper/bobby/sue/foo/bar.wsp",
+		"foo":               "/var/lib/graphite/whisper/foo.wsp",
+	}
+
+	for m, p := range data {
+		if r := metricPath("/var/lib/graphite/whisper/", m); r != p {
+			t.Errorf("metricPath(%q) returned %s, rather than %s", m, r, p)
+		}
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	data := []struct {
+		metric string
+		depth  int
+		key    string
+	}{
+		{"carbon.agents.graphite010.cpuUsage", 1, "carbon"},
+		{"carbon.agents.graphite010.cpuUsage", 2, "carbon.agents"},
+		{"carbon.agents.graphite010.cpuUsage", 0, "carbon.agents.graphite010.cpuUsage"},
+		{"carbon.agents.graphite010.cpuUsage", 4, "carbon.agents.graphite010.cpuUsage"},
+		{"carbon.agents.graphite010.cpuUsage", 9, "carbon.agents.graphite010.cpuUsage"},
+		{"carbon", 1, "carbon"},
+	}
+
+	for _, d := range data {
+		if k := hashKey(d.metric, d.depth); k != d.key {
+			t.Errorf("hashKey(%q, %d) returned %q, rather than %q",
+				d.metric, d.depth, k, d.key)
+		}
+	}
+}
+
+func TestLocateKeyFoldCase(t *testing.T) {
+	defer func() { locateFoldCase, locateKeyDepth = false, 0 }()
+
+	if k := locateKey("Carbon.Agents.cpuUsage"); k != "Carbon.Agents.cpuUsage" {
+		t.Errorf("locateKey folded case without --fold-case: %q", k)
+	}
+	locateFoldCase, locateKeyDepth = true, 2
+	if k := locateKey("Carbon.Agents.cpuUsage"); k != "carbon.agents" {
+		t.Errorf("locateKey with --fold-case returned %q, rather than %q", k, "carbon.agents")
+	}
+}
+
+func TestWriteNeighbors(t *testing.T) {
+	list := map[string][]string{
+		"foo.bar": {"graphite010", "graphite011", "graphite012"},
+	}
+
+	buf := new(bytes.Buffer)
+	writeNeighbors(buf, list)
+	expected := "foo.bar => graphite010 (neighbors: graphite011, graphite012)\n"
+	if buf.String() != expected {
+		t.Errorf("writeNeighbors wrote %q, rather than %q", buf.String(), expected)
+	}
+
+	// Text output is sorted by metric
+	sorted := map[string][]string{
+		"foo.c": {"graphite010"},
+		"foo.a": {"graphite011", "graphite010"},
+		"foo.b": {"graphite012"},
+	}
+	buf.Reset()
+	writeNeighbors(buf, sorted)
+	expected = "foo.a => graphite011 (neighbors: graphite010)\n" +
+		"foo.b => graphite012 (neighbors: none)\n" +
+		"foo.c => graphite010 (neighbors: none)\n"
+	if buf.String() != expected {
+		t.Errorf("writeNeighbors wrote %q, rather than %q", buf.String(), expected)
+	}
+
+	JSONOutput = true
+	defer func() { JSONOutput = false }()
+	buf.Reset()
+	writeNeighbors(buf, list)
+	expected = `{"foo.bar":{"host":"graphite010","neighbors":["graphite011","graphite012"]}}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("writeNeighbors wrote %q, rather than %q", buf.String(), expected)
+	}
+}
+
+func TestCanonicalTags(t *testing.T) {
+	data := map[string]string{
+		"cpu.usage":                           "cpu.usage",
+		"cpu.usage;host=a":                    "cpu.usage;host=a",
+		"cpu.usage;host=a;dc=b":               "cpu.usage;dc=b;host=a",
+		"cpu.usage;host=a;dc=b;type=idle":     "cpu.usage;dc=b;host=a;type=idle",
+		"cpu.usage;type=idle;dc=b;host=a":     "cpu.usage;dc=b;host=a;type=idle",
+		"cpu.usage;type=idle;dc=b;host=a=b=c": "cpu.usage;dc=b;host=a=b=c;type=idle",
+	}
+
+	for m, c := range data {
+		if r := canonicalTags(m); r != c {
+			t.Errorf("canonicalTags(%q) returned %q, rather than %q", m, r, c)
+		}
+	}
+}
+
+func TestLocateKeyTagged(t *testing.T) {
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{makeTestRing("carbon", 8)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	locateTagged = true
+	defer func() { Cluster, locateTagged = nil, false }()
+
+	list := mustLocate(t, []string{
+		"cpu.usage;dc=east;host=graphite010;type=idle",
+		"cpu.usage;type=idle;host=graphite010;dc=east",
+		"cpu.usage;host=graphite010;dc=east;type=idle",
+	})
+	host := ""
+	for m, h := range list {
+		if host == "" {
+			host = h
+		} else if h != host {
+			t.Errorf("Tagged series %s located on %s, rather than %s", m, h, host)
+		}
+	}
+}
+
+func TestLocateSliceMetricsNCapped(t *testing.T) {
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{makeTestRing("carbon", 3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	defer func() { Cluster, locateCollapse, locateReplicaDomain = nil, true, "server" }()
+
+	// 3 servers with 2 instances each
+	locateReplicaDomain = "instance"
+	for _, collapse := range []bool{true, false} {
+		locateCollapse = collapse
+		hosts := distinctHosts(c.Hash)
+		if (collapse && hosts != 3) || (!collapse && hosts != 6) {
+			t.Errorf("distinctHosts() returned %d with collapse %v", hosts, collapse)
+		}
+
+		list := mustLocateN(t, []string{"foo.bar", "foo.baz"}, hosts+5)
+		for m, l := range list {
+			if len(l) != hosts {
+				t.Errorf("%s placed on %d hosts, rather than the %d in the ring", m, len(l), hosts)
+			}
+		}
+	}
+}
+
+func TestNeighborHosts(t *testing.T) {
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{makeTestRing("carbon", 3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	defer func() { Cluster, locateCollapse = nil, true }()
+
+	locateCollapse = true
+	for neighbors, hosts := range map[int]int{1: 2, 2: 3, 3: 3, 5: 3} {
+		if n := neighborHosts(neighbors); n != hosts {
+			t.Errorf("neighborHosts(%d) returned %d on a 3 host ring, rather than %d", neighbors, n, hosts)
+		}
+	}
+}
+
+func TestLocateSliceMetricsNReplicaDomain(t *testing.T) {
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{makeTestRing("carbon", 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	defer func() { Cluster, locateCollapse, locateReplicaDomain = nil, true, "server" }()
+
+	metrics := make([]string, 0, 200)
+	for i := 0; i < 200; i++ {
+		metrics = append(metrics, fmt.Sprintf("bucky.replica.metric%d", i))
+	}
+
+	// 4 servers with 2 instances each, reported as server:instance
+	locateCollapse = false
+	locateReplicaDomain = "server"
+	for m, hosts := range mustLocateN(t, metrics, 3) {
+		servers := make(map[string]bool)
+		for _, h := range hosts {
+			servers[strings.SplitN(h, ":", 2)[0]] = true
+		}
+		if len(hosts) != 3 || len(servers) != 3 {
+			t.Errorf("%s replicas %v are not on 3 distinct servers", m, hosts)
+		}
+		if hosts[0] != nodeName(c.Hash.GetNode(m)) {
+			t.Errorf("%s first replica %s is not its host %s", m, hosts[0], nodeName(c.Hash.GetNode(m)))
+		}
+	}
+
+	// Instances of the same server are distinct in the instance domain
+	locateReplicaDomain = "instance"
+	shared := 0
+	for _, hosts := range mustLocateN(t, metrics, 3) {
+		servers := make(map[string]bool)
+		for _, h := range hosts {
+			servers[strings.SplitN(h, ":", 2)[0]] = true
+		}
+		if len(servers) < len(hosts) {
+			shared++
+		}
+	}
+	if shared == 0 {
+		t.Errorf("No replicas share a server in the instance domain")
+	}
+}
+
+func TestLocateSliceMetricsNSpreadByDC(t *testing.T) {
+	// Two datacenters of two servers each and one server without a tag
+	ring := makeTestRing("carbon", 5)
+	for i := range ring.Nodes[:8] {
+		ring.Nodes[i].DC = []string{"us-east", "us-west"}[i/4]
+	}
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{ring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	defer func() { Cluster, locateSpreadBy = nil, "" }()
+	dcs := map[string]string{
+		"graphite000": "us-east", "graphite001": "us-east",
+		"graphite002": "us-west", "graphite003": "us-west",
+		"graphite004": "graphite004",
+	}
+
+	metrics := make([]string, 0, 200)
+	for i := 0; i < 200; i++ {
+		metrics = append(metrics, fmt.Sprintf("bucky.replica.metric%d", i))
+	}
+
+	locateSpreadBy = "dc"
+	for n, distinct := range map[int]int{3: 3, 4: 3} {
+		for m, hosts := range mustLocateN(t, metrics, n) {
+			seen := make(map[string]bool)
+			for _, h := range hosts {
+				seen[dcs[h]] = true
+			}
+			if len(hosts) != n || len(seen) != distinct {
+				t.Errorf("%s replicas %v do not span %d datacenters", m, hosts, distinct)
+			}
+			if hosts[0] != nodeName(c.Hash.GetNode(m)) {
+				t.Errorf("%s first replica %s is not its host %s", m, hosts[0], nodeName(c.Hash.GetNode(m)))
+			}
+		}
+	}
+}
+
+func TestSingleNodeRing(t *testing.T) {
+	ring := &hashing.JSONRingType{
+		Name:     "graphite000",
+		Algo:     "carbon",
+		Replicas: 2,
+		Nodes:    []hashing.Node{hashing.NewNode("graphite000", 2003, "a")},
+	}
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{ring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	defer func() { Cluster, locateCollapse, JSONOutput = nil, true, false }()
+	locateCollapse = true
+
+	metrics := []string{"foo.bar", "foo.baz", "carbon.agents.x"}
+	for m, hosts := range mustLocateN(t, metrics, 3) {
+		if len(hosts) != 1 || hosts[0] != "graphite000" {
+			t.Errorf("%s placed on %v, rather than only graphite000", m, hosts)
+		}
+	}
+	replicas, err := replicaNodes(metrics, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for m, nodes := range replicas {
+		if len(nodes) != 1 {
+			t.Errorf("%s has %d replicas on a one node ring", m, len(nodes))
+		}
+	}
+	if colocated, err := ColocatedMetrics(metrics, 0); err != nil || len(colocated) != 0 {
+		t.Errorf("Metrics reported as colocated on a one node ring: %v", colocated)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeNeighbors(buf, mustLocateN(t, []string{"foo.bar"}, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if s := buf.String(); s != "foo.bar => graphite000 (neighbors: none)\n" {
+		t.Errorf("Unexpected neighbors output: %q", s)
+	}
+
+	counts := CountHosts(mustLocate(t, metrics))
+	s := NewCountSummary(counts)
+	if s.Total != 3 || s.Hosts["graphite000"].Fraction != 1 {
+		t.Errorf("Expected every metric on graphite000: %+v", s)
+	}
+	if hosts := imbalancedHosts(counts, 0); len(hosts) != 0 {
+		t.Errorf("A one node ring reported imbalanced hosts: %v", hosts)
+	}
+
+	d := NewDistribution(c.Hash, 100)
+	if d.Counts[ring.Nodes[0].String()] != 100 || d.Expected != 100 || d.Stddev != 0 || d.ChiSquare != 0 {
+		t.Errorf("Unexpected one node distribution: %+v", d)
+	}
+}
+
+func TestLocateKeyReverse(t *testing.T) {
+	defer func() { locateReverseKey, locateKeyDepth = false, 0 }()
+
+	data := map[string]string{
+		"a.b.c":           "c.b.a",
+		"a":               "a",
+		"a..b":            "b..a",
+		"cpu.usage;dc=b":  "usage.cpu;dc=b",
+		"carbon.agents.x": "x.agents.carbon",
+	}
+	locateReverseKey = true
+	for m, k := range data {
+		if r := locateKey(m); r != k {
+			t.Errorf("locateKey(%q) with --reverse-key returned %q, rather than %q", m, r, k)
+		}
+	}
+	locateKeyDepth = 2
+	if k := locateKey("servers.web01.cpu.idle"); k != "idle.cpu" {
+		t.Errorf("locateKey with --reverse-key and depth 2 returned %q", k)
+	}
+	locateKeyDepth = 0
+
+	// Placement is that of the reversed key as the relay hashes it
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{makeTestRing("fnv1a", 8)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	defer func() { Cluster = nil }()
+	for m, k := range data {
+		if h := mustLocate(t, []string{m})[m]; h != Cluster.Hash.GetNode(k).Server {
+			t.Errorf("%s located on %s, rather than the host of %s", m, h, k)
+		}
+	}
+}
+
+func TestWriteTextLocations(t *testing.T) {
+	list := map[string]string{
+		"foo.b": "graphite001",
+		"foo.a": "graphite002",
+		"bar.z": "graphite001",
+		"bar.y": "graphite002",
+	}
+	expected := map[string]string{
+		"metric": "bar.y => graphite002\nbar.z => graphite001\nfoo.a => graphite002\nfoo.b => graphite001\n",
+		"host":   "bar.z => graphite001\nfoo.b => graphite001\nbar.y => graphite002\nfoo.a => graphite002\n",
+	}
+	for by, e := range expected {
+		buf := new(bytes.Buffer)
+		writeTextLocations(buf, list, by)
+		if buf.String() != e {
+			t.Errorf("Sorting by %s wrote:\n%s\nrather than:\n%s", by, buf, e)
+		}
+	}
+}
+
+func TestWriteTextLocationsWeighted(t *testing.T) {
+	list := map[string]string{
+		"foo.b": "graphite001",
+		"foo.a": "graphite002",
+		"bar.z": "graphite001",
+		"bar.y": "graphite002",
+		"baz.x": "graphite001",
+	}
+	locateWeights = map[string]float64{"foo.a": 10, "bar.z": 500, "baz.x": 10}
+	defer func() { locateWeights = nil }()
+
+	expected := map[string]string{
+		"metric": "bar.z => graphite001\nbaz.x => graphite001\nfoo.a => graphite002\nbar.y => graphite002\nfoo.b => graphite001\n",
+		"host":   "bar.z => graphite001\nbaz.x => graphite001\nfoo.a => graphite002\nfoo.b => graphite001\nbar.y => graphite002\n",
+	}
+	for by, e := range expected {
+		buf := new(bytes.Buffer)
+		writeTextLocations(buf, list, by)
+		if buf.String() != e {
+			t.Errorf("Weighted sorting by %s wrote:\n%s\nrather than:\n%s", by, buf, e)
+		}
+	}
+}
+
+// BenchmarkLocateSliceMetrics locates 100,000 metrics on server:instance
+// nodes with and without --intern-hosts.  Interning saves building a host
+// name per metric: about 16 bytes and one allocation each, taking a run
+// from 200,585 to 100,614 allocations and 16.9MB to 15.3MB.
+func BenchmarkLocateSliceMetrics(b *testing.B) {
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{makeTestRing("carbon", 12)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	log.SetOutput(ioutil.Discard)
+	defer func() {
+		Cluster, locateCollapse, locateIntern = nil, true, false
+		log.SetOutput(os.Stderr)
+	}()
+
+	metrics := make([]string, 100000)
+	for i := range metrics {
+		metrics[i] = fmt.Sprintf("servers.dc1.rack%02d.graphite%04d.cpu.total.user", i%20, i)
+	}
+	locateCollapse = false
+	for _, intern := range []bool{false, true} {
+		locateIntern = intern
+		b.Run(fmt.Sprintf("intern=%v", intern), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				LocateSliceMetrics(metrics)
+			}
+		})
+	}
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
-	//"log"
+	"log"
 	"os"
 	"sort"
 	"strings"
@@ -98,6 +98,9 @@ func main() {
 	for _, c := range commands {
 		if c.Name == os.Args[1] {
 			c.Flag.Parse(os.Args[2:])
+			if err := ApplyConfig(c); err != nil {
+				log.Fatal(err)
+			}
 			os.Exit(c.Run(c))
 		}
 	}
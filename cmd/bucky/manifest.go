@@ -0,0 +1,126 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+)
+
+import . "github.com/jjneely/buckytools/metrics"
+
+// manifestFile is the JSON manifest written by tar or checked by restore.
+var manifestFile string
+
+// manifestEntry returns the manifest entry of a metric written to a tar
+// archive with the given unencoded data: its stat, as the buckyd daemon
+// reports it, and the checksum of the data.
+func manifestEntry(metric *MetricData, data []byte) *MetricData {
+	return &MetricData{
+		Name:     metric.Name,
+		Size:     int64(len(data)),
+		Mode:     metric.Mode,
+		ModTime:  metric.ModTime,
+		Encoding: EncIdentity,
+		Checksum: Checksum(data),
+	}
+}
+
+// WriteManifest writes the manifest entries, sorted by metric, as a JSON
+// array to the file at path.
+func WriteManifest(path string, manifest []*MetricData) error {
+	sort.Slice(manifest, func(i, j int) bool {
+		return manifest[i].Name < manifest[j].Name
+	})
+
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteJSON(fd, manifest); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// ReadManifest reads the JSON manifest written by tar --manifest from the
+// file at path.
+func ReadManifest(path string) ([]*MetricData, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	manifest := make([]*MetricData, 0)
+	if err := json.NewDecoder(fd).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("Error decoding manifest %s: %s", path, err)
+	}
+	return manifest, nil
+}
+
+// CheckManifest reads the tar archive and compares each Whisper DB in it
+// to the manifest.  Each metric missing from the archive, not listed in the
+// manifest, or whose size or checksum differs from its entry is logged and
+// an error returned if there are any.
+func CheckManifest(manifest []*MetricData, fd io.Reader) error {
+	entries := make(map[string]*MetricData, len(manifest))
+	for _, m := range manifest {
+		entries[m.Name] = m
+	}
+
+	problems := 0
+	seen := make(map[string]bool, len(manifest))
+	tr := tar.NewReader(fd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !isRestorable(hdr) {
+			continue
+		}
+
+		name := RelativeToMetric(hdr.Name)
+		seen[name] = true
+		entry, ok := entries[name]
+		if !ok {
+			log.Printf("Manifest: %s is in the archive but not the manifest", name)
+			problems++
+			continue
+		}
+		sum, err := ReaderChecksum(tr)
+		if err != nil {
+			return err
+		}
+		if hdr.Size != entry.Size {
+			log.Printf("Manifest: %s is %d bytes in the archive, rather than %d",
+				name, hdr.Size, entry.Size)
+			problems++
+		} else if entry.Checksum != "" && sum != entry.Checksum {
+			log.Printf("Manifest: checksum of %s in the archive %s does not match %s",
+				name, sum, entry.Checksum)
+			problems++
+		}
+	}
+
+	for _, m := range manifest {
+		if !seen[m.Name] {
+			log.Printf("Manifest: %s is missing from the archive", m.Name)
+			problems++
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("Archive does not match its manifest: %d problems", problems)
+	}
+	log.Printf("Archive matches its manifest of %d metrics", len(manifest))
+	return nil
+}
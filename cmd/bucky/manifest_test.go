@@ -0,0 +1,78 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+import . "github.com/jjneely/buckytools/metrics"
+
+func TestManifest(t *testing.T) {
+	data := map[string][]byte{
+		"foo.bar": []byte("whisper data of foo.bar"),
+		"foo.baz": []byte("whisper data of foo.baz, longer"),
+		"abc":     []byte("abc"),
+	}
+	buildTar := func(data map[string][]byte) []byte {
+		buf := new(bytes.Buffer)
+		tw := tar.NewWriter(buf)
+		tw.WriteHeader(&tar.Header{Name: "foo/", Mode: 0755, Typeflag: tar.TypeDir})
+		for m, d := range data {
+			tw.WriteHeader(&tar.Header{Name: MetricToRelative(m), Mode: 0644,
+				Size: int64(len(d)), Typeflag: tar.TypeReg})
+			tw.Write(d)
+		}
+		tw.Close()
+		return buf.Bytes()
+	}
+
+	manifest := make([]*MetricData, 0)
+	for m, d := range data {
+		manifest = append(manifest, manifestEntry(&MetricData{Name: m, Mode: 0644, ModTime: 1234}, d))
+	}
+
+	dir, err := ioutil.TempDir("", "bucky-manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "manifest.json")
+	if err := WriteManifest(path, manifest); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err = ReadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) != 3 || manifest[0].Name != "abc" || manifest[2].Name != "foo.baz" {
+		t.Fatalf("ReadManifest() returned entries out of order: %v", manifest)
+	}
+	if manifest[1].Size != int64(len(data["foo.bar"])) || manifest[1].ModTime != 1234 ||
+		manifest[1].Checksum != Checksum(data["foo.bar"]) {
+		t.Errorf("ReadManifest() returned %+v for foo.bar", manifest[1])
+	}
+
+	if err := CheckManifest(manifest, bytes.NewReader(buildTar(data))); err != nil {
+		t.Errorf("CheckManifest() of a matching archive returned %s", err)
+	}
+
+	bad := []map[string][]byte{
+		// missing
+		{"foo.bar": data["foo.bar"], "foo.baz": data["foo.baz"]},
+		// not in the manifest
+		{"foo.bar": data["foo.bar"], "foo.baz": data["foo.baz"], "abc": data["abc"], "xyz": nil},
+		// size differs
+		{"foo.bar": data["foo.bar"], "foo.baz": data["foo.baz"], "abc": []byte("abcd")},
+		// checksum differs
+		{"foo.bar": data["foo.bar"], "foo.baz": data["foo.baz"], "abc": []byte("xyz")},
+	}
+	for i, d := range bad {
+		if err := CheckManifest(manifest, bytes.NewReader(buildTar(d))); err == nil {
+			t.Errorf("CheckManifest() accepted bad archive %d", i)
+		}
+	}
+}
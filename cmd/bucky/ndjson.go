@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"regexp"
+)
+
+import "github.com/jjneely/buckytools/metrics"
+
+// locateNDJSON streams metric locations as newline delimited JSON.
+var locateNDJSON bool
+
+// NDJSONLocation is one line of the --ndjson output: a metric and the
+// server it is located on.  The instance is only included with
+// --collapse-instances=false.
+type NDJSONLocation struct {
+	Metric   string `json:"metric"`
+	Server   string `json:"server"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// NDJSONFilter returns an error to stop locating, or false to skip the
+// metric and true to locate it.
+type NDJSONFilter func(metric string) (bool, error)
+
+// StreamLocations calls read to read each metric, as streamMetrics()
+// does, and writes each metric kept by keep to w as an NDJSONLocation on
+// a line of its own as it is read.  Metrics are written in input order and
+// only the current metric is held in memory.  If keep is nil every metric
+// is kept.  The number of metrics written is returned.
+func StreamLocations(w io.Writer, read func(func(string) error) error, keep NDJSONFilter) (int, error) {
+	if !Cluster.Healthy {
+		return 0, ErrClusterUnhealthy
+	}
+
+	enc := json.NewEncoder(w)
+	count := 0
+	err := read(func(m string) error {
+		if keep != nil {
+			ok, err := keep(m)
+			if err != nil || !ok {
+				return err
+			}
+		}
+		n := Cluster.Hash.GetNode(locateKey(m))
+		loc := NDJSONLocation{Metric: m, Server: n.Server}
+		if !locateCollapse {
+			loc.Instance = n.Instance
+		}
+		count++
+		return enc.Encode(loc)
+	})
+	return count, err
+}
+
+// locateNDJSONCommand runs locate with --ndjson once the cluster is known.
+// The metrics are read from the command line, STDIN, or --from-dir and
+// filtered by --match, --exclude-prefix, and --validate-names as they are
+// streamed.
+func locateNDJSONCommand(c Command, match *regexp.Regexp) int {
+	var read func(func(string) error) error
+	if locateFromDir != "" {
+		read = func(fn func(string) error) error {
+			count := 0
+			return metrics.WalkMetrics(locateFromDir, func(m string) error {
+				count++
+				if err := checkMaxInput(count, locateMaxInput); err != nil {
+					return err
+				}
+				return fn(m)
+			})
+		}
+	} else if c.Flag.NArg() == 0 {
+		log.Print("At least one argument is required.")
+		return 1
+	} else if c.Flag.Arg(0) != "-" {
+		if err := checkMaxInput(c.Flag.NArg(), locateMaxInput); err != nil {
+			log.Printf("Error reading metrics: %s", err)
+			return 1
+		}
+		read = func(fn func(string) error) error {
+			for _, m := range c.Flag.Args() {
+				if err := fn(m); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	} else {
+		read = func(fn func(string) error) error {
+			return streamMetrics(os.Stdin, locateMaxInput, locateMaxInputBytes, fn)
+		}
+	}
+
+	excluded, invalid := 0, 0
+	keep := func(m string) (bool, error) {
+		if match != nil && !match.MatchString(m) {
+			return false, nil
+		}
+		if len(locateExclude) > 0 {
+			if kept, _ := excludePrefixes([]string{m}, locateExclude); len(kept) == 0 {
+				excluded++
+				return false, nil
+			}
+		}
+		if locateValidate {
+			if err := ValidateMetric(m); err != nil {
+				if locateStrict {
+					return false, err
+				}
+				invalid++
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	out, err := OpenOutput(locateOutput, locateFlushInterval, locateTee, false)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer out.Abort()
+
+	count, err := StreamLocations(out, read, keep)
+	if err != nil {
+		log.Printf("Error locating metrics: %s", err)
+		return 1
+	}
+	if err := out.Commit(); err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	if len(locateExclude) > 0 {
+		log.Printf("%d metrics excluded by --exclude-prefix", excluded)
+	}
+	if invalid > 0 {
+		log.Printf("%d metrics have invalid names", invalid)
+	}
+	log.Printf("%d metrics located", count)
+	if count == 0 {
+		log.Printf("Warning: 0 metrics located after filtering")
+		if locateErrorOnEmpty {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestStreamLocations(t *testing.T) {
+	ring := makeTestRing("carbon", 3)
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{ring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	defer func() { Cluster = nil }()
+
+	input := "foo.c\nfoo.a\n\nbar.b\nfoo.b\n"
+	read := func(fn func(string) error) error {
+		return streamMetrics(strings.NewReader(input), 0, 0, fn)
+	}
+	keep := func(m string) (bool, error) {
+		return strings.HasPrefix(m, "foo."), nil
+	}
+
+	buf := new(bytes.Buffer)
+	count, err := StreamLocations(buf, read, keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("StreamLocations() located %d rather than 3 metrics", count)
+	}
+
+	// One object per line in input order
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expected := []string{"foo.c", "foo.a", "foo.b"}
+	if len(lines) != len(expected) {
+		t.Fatalf("StreamLocations() wrote %q", buf)
+	}
+	for i, l := range lines {
+		var loc NDJSONLocation
+		if err := json.Unmarshal([]byte(l), &loc); err != nil {
+			t.Fatalf("StreamLocations() wrote %q: %s", l, err)
+		}
+		if loc.Metric != expected[i] || loc.Server != Cluster.Hash.GetNode(loc.Metric).Server {
+			t.Errorf("StreamLocations() wrote %+v on line %d", loc, i+1)
+		}
+		if strings.Contains(l, "instance") {
+			t.Errorf("StreamLocations() wrote an instance collapsing instances: %s", l)
+		}
+	}
+
+	// An error from the filter stops the stream
+	buf.Reset()
+	count, err = StreamLocations(buf, read, func(m string) (bool, error) {
+		if m == "foo.a" {
+			return false, fmt.Errorf("stop")
+		}
+		return true, nil
+	})
+	if err == nil || count != 1 {
+		t.Errorf("StreamLocations() returned %d, %v after a filter error", count, err)
+	}
+
+	Cluster.Healthy = false
+	if _, err := StreamLocations(buf, read, nil); err == nil {
+		t.Errorf("StreamLocations() located metrics on an unhealthy cluster")
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+import "github.com/golang/crypto/ssh/terminal"
+
+// exitInterrupted is the exit code used when a run is interrupted by
+// SIGINT or SIGTERM.
+const exitInterrupted = 130
+
+var interruptLock sync.Mutex
+var interruptCleanup []func()
+
+// HandleInterrupts installs a handler for SIGINT and SIGTERM that runs the
+// functions registered with OnInterrupt() and then exits with
+// exitInterrupted.  Sub-commands that want a clean interruption call this
+// from their Run function.
+func HandleInterrupts() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		log.Printf("Caught %s, aborting.", s)
+		interruptLock.Lock()
+		for _, f := range interruptCleanup {
+			f()
+		}
+		os.Exit(exitInterrupted)
+	}()
+}
+
+// OnInterrupt registers f to be run if we are interrupted by a signal
+// handled by HandleInterrupts().
+func OnInterrupt(f func()) {
+	interruptLock.Lock()
+	defer interruptLock.Unlock()
+	interruptCleanup = append(interruptCleanup, f)
+}
+
+// AtomicFile is an output file that is written to a temporary file in the
+// same directory as its final path and renamed into place by Commit().
+// Readers of the final path never see a partially written file.
+type AtomicFile struct {
+	*os.File
+	path string
+	lock sync.Mutex
+	done bool
+}
+
+// CreateAtomic opens a new AtomicFile that will be renamed to path when
+// committed.
+func CreateAtomic(path string) (*AtomicFile, error) {
+	fd, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return nil, err
+	}
+
+	return &AtomicFile{File: fd, path: path}, nil
+}
+
+// Commit closes the temporary file and renames it to its final path.  The
+// file keeps the permissions of the file it replaces, if any.
+func (a *AtomicFile) Commit() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.done {
+		return nil
+	}
+	a.done = true
+
+	// TempFile() creates the file 0600, which would survive the rename
+	if err := a.File.Chmod(outputMode(a.path)); err != nil {
+		a.File.Close()
+		os.Remove(a.File.Name())
+		return err
+	}
+	if err := a.File.Close(); err != nil {
+		os.Remove(a.File.Name())
+		return err
+	}
+	return os.Rename(a.File.Name(), a.path)
+}
+
+// outputMode returns the permissions a file written to path should have:
+// those of the file it replaces, or 0666 less the umask as os.Create()
+// would use for a new file.
+func outputMode(path string) os.FileMode {
+	if fi, err := os.Stat(path); err == nil {
+		return fi.Mode().Perm()
+	}
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return 0666 &^ os.FileMode(mask)
+}
+
+// Abort closes and removes the temporary file.  This is a no-op if the
+// file has already been committed or aborted and is safe to call from
+// another goroutine, such as a signal handler.
+func (a *AtomicFile) Abort() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.done {
+		return
+	}
+	a.done = true
+
+	a.File.Close()
+	os.Remove(a.File.Name())
+}
+
+// echoInterval is how often output echoed to STDOUT is flushed when no
+// other flush interval is given.
+const echoInterval = time.Second
+
+// echoStdout returns true if output written to a file should also be
+// echoed to STDOUT.  This is when tee is set or, unless the output is
+// binary, when STDOUT is a terminal.
+func echoStdout(tee, binary bool) bool {
+	return tee || (!binary && terminal.IsTerminal(int(os.Stdout.Fd())))
+}
+
+// FlushWriter buffers writes to an underlying io.Writer so that large
+// outputs do not make a system call per line.  It is safe to Flush() from
+// another goroutine, such as a signal handler.  Buffered data is written
+// when the buffer fills, on Flush(), on Close(), and periodically if a
+// flush interval is given.
+type FlushWriter struct {
+	w    *bufio.Writer
+	lock sync.Mutex
+	stop chan bool
+}
+
+// NewFlushWriter returns a FlushWriter writing to w.  If interval is
+// positive the buffer is also flushed that often so that consumers see
+// incremental output.
+func NewFlushWriter(w io.Writer, interval time.Duration) *FlushWriter {
+	f := &FlushWriter{w: bufio.NewWriterSize(w, 64*1024)}
+	if interval > 0 {
+		f.stop = make(chan bool)
+		go func() {
+			t := time.NewTicker(interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					f.Flush()
+				case <-f.stop:
+					return
+				}
+			}
+		}()
+	}
+
+	return f
+}
+
+func (f *FlushWriter) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.w.Write(p)
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (f *FlushWriter) Flush() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.w.Flush()
+}
+
+// Close stops any periodic flushing and flushes the buffer.  The
+// underlying io.Writer is not closed.
+func (f *FlushWriter) Close() error {
+	if f.stop != nil {
+		close(f.stop)
+		f.stop = nil
+	}
+	return f.Flush()
+}
+
+// Output is where a sub-command writes its results: STDOUT or an
+// AtomicFile, through a FlushWriter.  Output written to a file may also be
+// echoed to STDOUT.
+type Output struct {
+	io.Writer
+	fd   *AtomicFile
+	bw   *FlushWriter
+	echo *FlushWriter
+}
+
+// OpenOutput opens an Output writing to the file at path, or STDOUT if
+// path is empty, that is also flushed as often as interval if that is
+// positive.  Partial output is removed from a file, or flushed to STDOUT,
+// if we are interrupted.  Output written to a file is echoed to STDOUT as
+// echoStdout() decides with tee and binary.
+func OpenOutput(path string, interval time.Duration, tee, binary bool) (*Output, error) {
+	o := new(Output)
+	var out io.Writer = os.Stdout
+	if path != "" {
+		fd, err := CreateAtomic(path)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating output file: %s", err)
+		}
+		OnInterrupt(fd.Abort)
+		o.fd, out = fd, fd
+	}
+	o.bw = NewFlushWriter(out, interval)
+	if o.fd == nil {
+		// Don't lose the output so far on STDOUT
+		OnInterrupt(func() { o.bw.Flush() })
+	}
+	o.Writer = o.bw
+
+	if o.fd != nil && echoStdout(tee, binary) {
+		if interval <= 0 {
+			interval = echoInterval
+		}
+		o.echo = NewFlushWriter(os.Stdout, interval)
+		OnInterrupt(func() { o.echo.Flush() })
+		o.Writer = io.MultiWriter(o.bw, o.echo)
+	}
+
+	return o, nil
+}
+
+// Flush writes the buffered output, and its echo to STDOUT.
+func (o *Output) Flush() error {
+	if o.echo != nil {
+		if err := o.echo.Flush(); err != nil {
+			return err
+		}
+	}
+	return o.bw.Flush()
+}
+
+// Commit flushes the output and renames the file into place.
+func (o *Output) Commit() error {
+	if err := o.bw.Close(); err != nil {
+		return fmt.Errorf("Error writing output: %s", err)
+	}
+	if o.echo != nil {
+		if err := o.echo.Close(); err != nil {
+			return fmt.Errorf("Error writing output: %s", err)
+		}
+	}
+	if o.fd != nil {
+		if err := o.fd.Commit(); err != nil {
+			return fmt.Errorf("Error writing output file: %s", err)
+		}
+	}
+	return nil
+}
+
+// Abort stops any periodic flushing and removes the file unless it has
+// been committed.
+func (o *Output) Abort() {
+	if o.echo != nil {
+		o.echo.Close()
+	}
+	o.bw.Close()
+	if o.fd != nil {
+		o.fd.Abort()
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe to read while a FlushWriter flushes
+// into it from its own goroutine.
+type lockedBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestFlushWriter(t *testing.T) {
+	buf := new(lockedBuffer)
+	w := NewFlushWriter(buf, 0)
+	w.Write([]byte("foo.bar => graphite010\n"))
+	if buf.String() != "" {
+		t.Errorf("FlushWriter wrote %q before being flushed", buf.String())
+	}
+	w.Close()
+	if buf.String() != "foo.bar => graphite010\n" {
+		t.Errorf("FlushWriter wrote %q on Close()", buf.String())
+	}
+
+	buf = new(lockedBuffer)
+	w = NewFlushWriter(buf, 10*time.Millisecond)
+	defer w.Close()
+	w.Write([]byte("foo.bar => graphite010\n"))
+	for i := 0; i < 100 && buf.String() == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if buf.String() != "foo.bar => graphite010\n" {
+		t.Errorf("FlushWriter did not flush on its interval: %q", buf.String())
+	}
+}
+
+func TestEchoStdout(t *testing.T) {
+	if !echoStdout(true, true) {
+		t.Errorf("Output was not echoed with --tee")
+	}
+	// STDOUT of the test binary is not a terminal
+	if echoStdout(false, false) {
+		t.Errorf("Output was echoed without --tee to a non-terminal")
+	}
+}
+
+func TestAtomicFileMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bucky-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer syscall.Umask(syscall.Umask(022))
+	path := filepath.Join(dir, "metrics.txt")
+
+	commit := func() os.FileMode {
+		a, err := CreateAtomic(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Mode().Perm()
+	}
+
+	if mode := commit(); mode != 0644 {
+		t.Errorf("New file has mode %o rather than 0644 with umask 022", mode)
+	}
+
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if mode := commit(); mode != 0640 {
+		t.Errorf("Replaced file has mode %o rather than its original 0640", mode)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// PendingLocation is a metric's host on the current hash ring and on the
+// pending hash ring of a staged migration.
+type PendingLocation struct {
+	Current string `json:"current"`
+	Pending string `json:"pending"`
+
+	// Migrating is true if the pending host differs from the current host
+	Migrating bool `json:"migrating"`
+}
+
+// readPendingRing builds the pending hash ring from the given ring file.
+func readPendingRing(path string) (hashing.HashRing, error) {
+	rings, err := ReadRingFile(path)
+	if err != nil {
+		log.Printf("Abort: Cannot read ring file %s: %s", path, err)
+		return nil, err
+	}
+	return buildHashRing(rings)
+}
+
+// LocatePending returns a map of metric => PendingLocation for the given
+// metrics located with both the current and the pending hash rings.
+func LocatePending(metrics []string, current, pending hashing.HashRing) map[string]PendingLocation {
+	result := make(map[string]PendingLocation, len(metrics))
+	for _, m := range metrics {
+		key := locateKey(m)
+		p := PendingLocation{
+			Current: nodeName(current.GetNode(key)),
+			Pending: nodeName(pending.GetNode(key)),
+		}
+		p.Migrating = p.Current != p.Pending
+		result[m] = p
+	}
+
+	migrating := 0
+	for _, p := range result {
+		if p.Migrating {
+			migrating++
+		}
+	}
+	log.Printf("%d of %d metrics are placed differently by the pending ring",
+		migrating, len(result))
+
+	return result
+}
+
+// writePending writes the map of metric => PendingLocation to w sorted by
+// metric in the form "metric => current, pending".  Metrics whose hosts
+// differ are flagged with " (migrating)".  JSON or YAML is written if
+// JSONOutput or YAMLOutput is set.
+func writePending(w io.Writer, list map[string]PendingLocation) error {
+	if JSONOutput {
+		return WriteJSON(w, list)
+	}
+	if YAMLOutput {
+		return WriteYAML(w, list)
+	}
+
+	keys := make([]string, 0, len(list))
+	for m := range list {
+		keys = append(keys, m)
+	}
+	sort.Strings(keys)
+	for _, m := range keys {
+		p := list[m]
+		flag := ""
+		if p.Migrating {
+			flag = " (migrating)"
+		}
+		if _, err := fmt.Fprintf(w, "%s => %s, %s%s\n", m, p.Current, p.Pending, flag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestLocatePending(t *testing.T) {
+	current := hashing.NewCarbonHashRing()
+	current.AddNode(hashing.NewNode("graphite010", 2004, ""))
+	current.AddNode(hashing.NewNode("graphite011", 2004, ""))
+	pending := hashing.NewCarbonHashRing()
+	pending.AddNode(hashing.NewNode("graphite010", 2004, ""))
+	pending.AddNode(hashing.NewNode("graphite011", 2004, ""))
+	pending.AddNode(hashing.NewNode("graphite012", 2004, ""))
+
+	metrics := make([]string, 0)
+	for i := 0; i < 100; i++ {
+		metrics = append(metrics, fmt.Sprintf("foo.bar.metric%d", i))
+	}
+
+	list := LocatePending(metrics, current, pending)
+	migrating := 0
+	for _, m := range metrics {
+		p := list[m]
+		if p.Current != current.GetNode(m).Server || p.Pending != pending.GetNode(m).Server {
+			t.Errorf("%s located as %v", m, p)
+		}
+		if p.Migrating != (p.Current != p.Pending) {
+			t.Errorf("%s migrating is %v for %v", m, p.Migrating, p)
+		}
+		if p.Migrating {
+			migrating++
+		}
+	}
+	if migrating == 0 || migrating == len(metrics) {
+		t.Errorf("%d of %d metrics migrating", migrating, len(metrics))
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writePending(buf, map[string]PendingLocation{
+		"b.metric": {"graphite010", "graphite012", true},
+		"a.metric": {"graphite011", "graphite011", false},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"a.metric => graphite011, graphite011",
+		"b.metric => graphite010, graphite012 (migrating)",
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("writePending() wrote %q", lines)
+	}
+}
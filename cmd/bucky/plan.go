@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// planVersion is the version of the migration plan format we write.
+// Plans with a different version are refused.
+const planVersion = 1
+
+// planExecute runs the moves in a migration plan rather than reporting
+// them.
+var planExecute bool
+
+// MigrationPlan is a reviewable set of metric moves produced by comparing
+// the live cluster's hash ring to a proposed ring file.
+type MigrationPlan struct {
+	// Version is the plan format version
+	Version int `json:"version"`
+
+	// GeneratedAt is the RFC3339 time the plan was created
+	GeneratedAt string `json:"generated_at"`
+
+	// RingFile is the proposed ring file the plan moves metrics to
+	RingFile string `json:"ring_file"`
+
+	// Total is the number of metrics compared
+	Total int `json:"total"`
+
+	// Churn is the percentage of metrics that move
+	Churn float64 `json:"churn"`
+
+	// Moves lists each metric to move sorted by metric
+	Moves []MovedMetric `json:"moves"`
+
+	// Estimate is the cost of the moves if --estimate-bytes was given
+	Estimate *TransferEstimate `json:"estimate,omitempty"`
+}
+
+func init() {
+	usage := "[options] <plan file>"
+	short := "Review or execute a migration plan."
+	long := `Read a migration plan written by "bucky locate --compare-live
+--emit-plan" and move each metric in the plan from its current server to
+its new server, backfilling as needed.
+
+By default this is a dry-run that prints each move and a per server summary
+without altering any metrics.  Use --execute to perform the moves.
+
+Use --estimate-bytes to stat each metric on the server it moves from and
+report the total bytes the moves transfer.  Add --bwlimit with a rate in
+KiB per second to also estimate how long the transfer takes.  An estimate
+stored in the plan by "bucky locate --estimate-bytes" is reported as well.
+
+Use --delete to delete metric source locations after they are moved.  The
+default is to not remove the source metrics.
+
+Set -w to change the number of worker threads used to upload the Whisper
+DBs to the remote servers.`
+
+	c := NewCommand(applyPlanCommand, "apply-plan", usage, short, long)
+	SetupCommon(c)
+	SetupHostname(c)
+
+	c.Flag.BoolVar(&planExecute, "execute", false,
+		"Perform the moves in the plan.")
+	c.Flag.BoolVar(&doDelete, "delete", false,
+		"Delete metrics after moving them.")
+	SetupEstimate(c)
+	c.Flag.IntVar(&metricWorkers, "w", 5,
+		"Downloader threads.")
+	c.Flag.IntVar(&metricWorkers, "workers", 5,
+		"Downloader threads.")
+}
+
+// NewMigrationPlan returns a MigrationPlan holding the moves in diff to
+// the given proposed ring file.
+func NewMigrationPlan(diff *RingDiff, ringFile string) *MigrationPlan {
+	return &MigrationPlan{
+		Version:     planVersion,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		RingFile:    ringFile,
+		Total:       diff.Total,
+		Churn:       diff.Churn,
+		Moves:       diff.Moved,
+		Estimate:    diff.Estimate,
+	}
+}
+
+// WritePlan writes the MigrationPlan to the file at path.  The file is
+// written atomically.
+func WritePlan(path string, plan *MigrationPlan) error {
+	blob, err := json.MarshalIndent(plan, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	fd, err := CreateAtomic(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Abort()
+	OnInterrupt(fd.Abort)
+
+	fd.Write(blob)
+	fd.Write([]byte("\n"))
+	return fd.Commit()
+}
+
+// ReadPlan reads the MigrationPlan in the file at path.
+func ReadPlan(path string) (*MigrationPlan, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := new(MigrationPlan)
+	err = json.Unmarshal(blob, plan)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("Unsupported plan version %d, expected %d",
+			plan.Version, planVersion)
+	}
+
+	return plan, nil
+}
+
+// ApplyPlan moves each metric in the plan to its new server using the
+// rebalance workers.  When planExecute is false we only report what would
+// be done.
+func ApplyPlan(plan *MigrationPlan) error {
+	moves := make(map[string]int)
+	for _, m := range plan.Moves {
+		moves[m.From+" => "+m.To]++
+		if !planExecute {
+			log.Printf("[%s] %s => %s", m.From, m.Metric, m.To)
+		}
+	}
+
+	pairs := make([]string, 0, len(moves))
+	for p := range moves {
+		pairs = append(pairs, p)
+	}
+	sort.Strings(pairs)
+	for _, p := range pairs {
+		log.Printf("%d metrics to move %s", moves[p], p)
+	}
+	log.Printf("Plan generated %s moves %d of %d metrics (%.2f%%) to %s",
+		plan.GeneratedAt, len(plan.Moves), plan.Total, plan.Churn, plan.RingFile)
+	if estimateBytes {
+		plan.Estimate = EstimateMoves(plan.Moves)
+	}
+	if plan.Estimate != nil {
+		log.Print(plan.Estimate)
+	}
+
+	if !planExecute {
+		log.Printf("Dry-run complete.  Use --execute to move metrics.")
+		return nil
+	}
+
+	workIn := make(chan *MigrateWork, 25)
+	wg := new(sync.WaitGroup)
+	wg.Add(metricWorkers)
+	for i := 0; i < metricWorkers; i++ {
+		go rebalanceWorker(workIn, wg)
+	}
+
+	l := len(plan.Moves)
+	t := time.Now().Unix()
+	for c, m := range plan.Moves {
+		work := new(MigrateWork)
+		work.oldName = m.Metric
+		work.newName = m.Metric
+		work.oldLocation = m.From
+		work.newLocation = m.To
+		workIn <- work
+
+		if (c+1)%10 == 0 {
+			s := time.Now().Unix() - t
+			if s == 0 {
+				s = 1
+			}
+			log.Printf("Progress %d / %d: %.2f%%  Metrics/second: %.2f  Delete: %t",
+				c+1, l,
+				100*float64(c+1)/float64(l),
+				float64(c+1)/float64(s),
+				doDelete)
+		}
+	}
+
+	close(workIn)
+	wg.Wait()
+
+	log.Printf("Plan complete.")
+	if workerErrors {
+		log.Printf("Errors are present in plan execution.")
+		return fmt.Errorf("Errors present.")
+	}
+	return nil
+}
+
+// applyPlanCommand runs this subcommand.
+func applyPlanCommand(c Command) int {
+	if c.Flag.NArg() != 1 {
+		log.Printf("A single plan file is required.")
+		return 1
+	}
+
+	plan, err := ReadPlan(c.Flag.Arg(0))
+	if err != nil {
+		log.Printf("Error reading plan %s: %s", c.Flag.Arg(0), err)
+		return 1
+	}
+
+	// We need the cluster's port to reach each server in the plan
+	_, err = GetClusterConfig(HostPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	err = ApplyPlan(plan)
+	if err != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	diff := &RingDiff{
+		Total:   2,
+		Changed: 1,
+		Churn:   50,
+		Moved:   []MovedMetric{{"foo.bar", "graphite010", "graphite011"}},
+	}
+
+	err := WritePlan(path, NewMigrationPlan(diff, "ring.json"))
+	if err != nil {
+		t.Fatalf("WritePlan returned an error: %s", err)
+	}
+	plan, err := ReadPlan(path)
+	if err != nil {
+		t.Fatalf("ReadPlan returned an error: %s", err)
+	}
+	if plan.Total != 2 || len(plan.Moves) != 1 || plan.Moves[0] != diff.Moved[0] {
+		t.Errorf("ReadPlan returned %+v", plan)
+	}
+
+	err = os.WriteFile(path, []byte(`{"version": 99, "moves": []}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPlan(path); err == nil {
+		t.Errorf("ReadPlan accepted an unsupported plan version")
+	}
+}
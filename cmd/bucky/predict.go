@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// predictPrefixes are the metric prefixes to predict placement for.
+var predictPrefixes StringList
+
+// predictEstimate is the number of synthetic metrics under each prefix.
+var predictEstimate int
+
+func init() {
+	usage := "[options]"
+	short := "Predict where the metrics under a new prefix will be placed."
+	long := `Generate --estimate synthetic metric names under each metric prefix
+given by --prefix, locate them with the hash ring, and report how many of
+each prefix's metrics land on each host.  This helps plan capacity before a
+new service starts emitting metrics under that prefix.  Use --prefix more
+than once to predict several prefixes in one run.  A trailing ".*" on a
+prefix is ignored.
+
+The text output is one line per prefix and host of the form
+
+    prefix<tab>host<tab>count<tab>percent
+
+With -j we write a JSON object of prefix => host => count.  Instances are
+collapsed to their server unless --collapse-instances=false is given.
+
+Use -s to query the hash ring only on the host given by -h or in the
+BUCKYHOST environment variable.  Use --ring-file to predict placement with
+a ring file rather than the cluster.`
+
+	c := NewCommand(predictCommand, "predict", usage, short, long)
+	SetupCommon(c)
+	SetupHostname(c)
+	SetupSingle(c)
+	SetupJSON(c)
+	SetupRingFile(c)
+
+	c.Flag.Var(&predictPrefixes, "prefix",
+		"Metric prefix to predict placement for. May be repeated.")
+	c.Flag.IntVar(&predictEstimate, "estimate", 1000,
+		"Number of metrics expected under each prefix.")
+	c.Flag.BoolVar(&locateCollapse, "collapse-instances", true,
+		"Report servers rather than server:instance nodes.")
+}
+
+// PredictPrefix returns a map of host => the number of n synthetic metrics
+// under the given prefix that the hash ring places on that host.
+func PredictPrefix(prefix string, n int) map[string]int {
+	prefix = strings.TrimSuffix(strings.TrimSuffix(prefix, ".*"), ".")
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("%s.predict%04d.metric%d", prefix, i%1000, i)
+		counts[nodeName(Cluster.Hash.GetNode(locateKey(key)))]++
+	}
+
+	return counts
+}
+
+// predictCommand runs this subcommand.
+func predictCommand(c Command) int {
+	if len(predictPrefixes) == 0 {
+		log.Print("At least one --prefix is required.")
+		return 1
+	}
+	if predictEstimate <= 0 {
+		log.Print("--estimate must be positive.")
+		return 1
+	}
+
+	_, err := GetClusterConfig(HostPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if !Cluster.Healthy {
+		log.Printf("Warning: Cluster is not healthy!")
+	}
+
+	result := make(map[string]map[string]int, len(predictPrefixes))
+	for _, p := range predictPrefixes {
+		result[p] = PredictPrefix(p, predictEstimate)
+	}
+
+	if JSONOutput {
+		err = WriteJSON(os.Stdout, result)
+		if err != nil {
+			log.Printf("Error encoding JSON output: %s", err)
+			return 1
+		}
+		return 0
+	}
+
+	for _, p := range predictPrefixes {
+		counts := result[p]
+		for _, h := range sortedHosts(counts) {
+			fmt.Printf("%s\t%s\t%d\t%.2f%%\n", p, h, counts[h],
+				100*float64(counts[h])/float64(predictEstimate))
+		}
+	}
+	return 0
+}
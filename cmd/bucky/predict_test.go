@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestPredictPrefix(t *testing.T) {
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{makeTestRing("carbon", 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Cluster = c
+	defer func() { Cluster = nil }()
+
+	counts := PredictPrefix("app.foo", 1000)
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total != 1000 || len(counts) != 4 {
+		t.Errorf("PredictPrefix placed %d metrics on %d hosts: %v", total, len(counts), counts)
+	}
+
+	other := PredictPrefix("app.foo.*", 1000)
+	for h, n := range counts {
+		if other[h] != n {
+			t.Errorf("PredictPrefix placed app.foo.* differently than app.foo: %v != %v",
+				other, counts)
+			break
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// maxProtoRecord is the largest length-delimited record we accept.
+const maxProtoRecord = 1 << 20
+
+// readProtoMetrics reads a stream of length-delimited protobuf records from
+// fd and returns the metric name of each.  Every record is a varint byte
+// length followed by a message of the form
+//
+//	message Metric {
+//		string name = 1;
+//	}
+//
+// Other fields are skipped so that catalogs may carry more data.  An error
+// is returned as soon as more than maxCount records or maxBytes bytes are
+// read.  Zero values mean no limit.
+func readProtoMetrics(fd io.Reader, maxCount int, maxBytes int64) ([]string, error) {
+	r := bufio.NewReader(&limitReader{r: fd, max: maxBytes})
+	metrics := make([]string, 0)
+	for {
+		size, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return metrics, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Record %d: %s", len(metrics)+1, err)
+		}
+		if size > maxProtoRecord {
+			return nil, fmt.Errorf("Record %d of %d bytes exceeds the limit of %d bytes",
+				len(metrics)+1, size, maxProtoRecord)
+		}
+
+		record := make([]byte, size)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return nil, fmt.Errorf("Record %d is truncated: %s", len(metrics)+1, err)
+		}
+		name, err := protoName(record)
+		if err != nil {
+			return nil, fmt.Errorf("Record %d: %s", len(metrics)+1, err)
+		}
+		metrics = append(metrics, name)
+		if err := checkMaxInput(len(metrics), maxCount); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// protoName returns field 1, the metric name, of the protobuf encoded
+// message.  As protobuf parsers do, the last name given wins.
+func protoName(msg []byte) (string, error) {
+	name := ""
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return "", fmt.Errorf("Invalid field tag")
+		}
+		msg = msg[n:]
+
+		field, wire := tag>>3, tag&7
+		switch wire {
+		case 0: // varint
+			if _, n = binary.Uvarint(msg); n <= 0 {
+				return "", fmt.Errorf("Invalid varint in field %d", field)
+			}
+		case 1: // 64-bit
+			n = 8
+		case 2: // length-delimited
+			size, m := binary.Uvarint(msg)
+			if m <= 0 || size > uint64(len(msg)-m) {
+				return "", fmt.Errorf("Invalid length of field %d", field)
+			}
+			if field == 1 {
+				name = string(msg[m : m+int(size)])
+			}
+			n = m + int(size)
+		case 5: // 32-bit
+			n = 4
+		default:
+			return "", fmt.Errorf("Unsupported wire type %d in field %d", wire, field)
+		}
+		if n > len(msg) {
+			return "", fmt.Errorf("Field %d is truncated", field)
+		}
+		msg = msg[n:]
+	}
+
+	if name == "" {
+		return "", fmt.Errorf("No metric name in field 1")
+	}
+	return name, nil
+}
+
+// readProtoFiles returns the metric names in the length-delimited protobuf
+// streams in each of the given files, as readProtoMetrics() reads them.  A
+// path of "-" reads STDIN.  The limits apply to each file.
+func readProtoFiles(paths []string, maxCount int, maxBytes int64) ([]string, error) {
+	metrics := make([]string, 0)
+	for _, path := range paths {
+		fd := os.Stdin
+		if path != "-" {
+			var err error
+			fd, err = os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer fd.Close()
+		}
+
+		m, err := readProtoMetrics(fd, maxCount, maxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		metrics = append(metrics, m...)
+		if err := checkMaxInput(len(metrics), maxCount); err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
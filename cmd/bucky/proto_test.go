@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// protoRecord returns a length-delimited record holding the given fields
+// already encoded with their tags.
+func protoRecord(fields ...[]byte) []byte {
+	msg := bytes.Join(fields, nil)
+	return append(binary.AppendUvarint(nil, uint64(len(msg))), msg...)
+}
+
+// protoString returns field 1 holding s as protobuf encodes it.
+func protoString(s string) []byte {
+	return append(binary.AppendUvarint([]byte{0x0a}, uint64(len(s))), s...)
+}
+
+func TestReadProtoMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(protoRecord(protoString("foo.bar")))
+	// Unknown varint and fixed width fields are skipped
+	buf.Write(protoRecord([]byte{0x10, 0x96, 0x01}, protoString("foo.baz"),
+		[]byte{0x1d, 1, 2, 3, 4}))
+	buf.Write(protoRecord(protoString("ignored"), protoString("foo.qux")))
+
+	metrics, err := readProtoMetrics(bytes.NewReader(buf.Bytes()), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"foo.bar", "foo.baz", "foo.qux"}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("readProtoMetrics returned %v, rather than %v", metrics, expected)
+	}
+
+	if _, err := readProtoMetrics(bytes.NewReader(buf.Bytes()), 2, 0); err == nil {
+		t.Errorf("readProtoMetrics read more than the limit of 2 metrics")
+	}
+	if _, err := readProtoMetrics(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), 0, 0); err == nil {
+		t.Errorf("readProtoMetrics accepted a truncated record")
+	}
+	if _, err := readProtoMetrics(bytes.NewReader(protoRecord([]byte{0x10, 1})), 0, 0); err == nil {
+		t.Errorf("readProtoMetrics accepted a record without a name")
+	}
+}
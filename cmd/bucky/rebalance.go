@@ -26,6 +26,11 @@ relocated according to the hash ring.  This is useful for moving all
 metrics off of a server when removing it from the cluster.  Metrics will be
 deleted per normal according to the --no-delete flag.
 
+When the cluster replicates metrics, metrics found on any of the servers
+owning their replicas are left in place, as for the inconsistent command.
+Use --replicas to give the number of replicas rather than the hash ring's.
+Other metrics are moved to the server owning their first replica.
+
 Use -s to operate on metrics found on the initial host given by -h or the
 BUCKYHOST environment variable.  Cluster health is not checked.  Moves that
 result in metrics that live on a different host will be completed, so other
@@ -55,6 +60,8 @@ DBs to the remote servers.`
 		"Downloader threads.")
 	c.Flag.BoolVar(&listForce, "f", false,
 		"Force the remote daemons to rebuild their cache.")
+	c.Flag.IntVar(&consistentReplicas, "replicas", 0,
+		"Replicas of each metric, 0 for the hash ring's replicas.")
 }
 
 func rebalanceWorker(workIn chan *MigrateWork, wg *sync.WaitGroup) {
@@ -199,6 +206,11 @@ func RebalanceMetrics(extraHostPorts []string) error {
 
 // rebalanceCommand runs this subcommand.
 func rebalanceCommand(c Command) int {
+	if consistentReplicas < 0 {
+		log.Print("--replicas must not be negative.")
+		return 1
+	}
+
 	_, err := GetClusterConfig(HostPort)
 	if err != nil {
 		log.Print(err)
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// reconcileHost is the server whose metrics we reconcile.
+var reconcileHost string
+
+// reconcileFromDir is a Whisper DB tree to read metric names from.
+var reconcileFromDir string
+
+// Reconciliation compares the metrics the hash ring places on a server with
+// the metrics actually found there.
+type Reconciliation struct {
+	// Server is the server reconciled
+	Server string `json:"server"`
+
+	// Expected is the number of given metrics the hash ring places here
+	Expected int `json:"expected"`
+
+	// Actual is the number of metrics found on the server
+	Actual int `json:"actual"`
+
+	// Missing are the expected metrics not found on the server, sorted
+	Missing []string `json:"missing"`
+
+	// Orphaned are the metrics found on the server that the hash ring
+	// places elsewhere, sorted
+	Orphaned []string `json:"orphaned"`
+}
+
+func init() {
+	usage := "[options] <metric list>"
+	short := "Find missing and orphaned metrics on a server."
+	long := `Compare the metrics the hash ring places on the server given by
+--server with the metrics actually stored there.
+
+The expected metrics are those of the given metrics that the hash ring
+places on the server, as the inventory command reports.  Metrics may be
+listed on the command line as arguments or, if the first argument is "-" we
+read the list on STDIN as a JSON array or one metric per line.  Use
+--from-dir to read the metrics of every Whisper DB found in a directory tree
+instead.
+
+The actual metrics are listed from the buckyd daemon on the server.  We
+report the expected metrics that are missing from the server and the
+orphaned metrics stored on the server that the hash ring places elsewhere.
+As with the inconsistent command, carbon.agents metrics are never reported
+as orphaned.
+
+Counts are written to STDOUT.  Use -j for a JSON object that includes the
+full lists of missing and orphaned metrics.`
+
+	c := NewCommand(reconcileCommand, "reconcile", usage, short, long)
+	SetupCommon(c)
+	SetupHostname(c)
+	SetupSingle(c)
+	SetupJSON(c)
+	SetupRingFile(c)
+
+	c.Flag.StringVar(&reconcileHost, "server", "",
+		"Reconcile the metrics on this server.")
+	c.Flag.StringVar(&reconcileFromDir, "from-dir", "",
+		"Read metrics from the Whisper DBs found in this directory tree.")
+	c.Flag.BoolVar(&listForce, "f", false,
+		"Force the remote daemon to rebuild its cache.")
+}
+
+// ReconcileMetrics compares the metrics the hash ring places on server,
+// from the expected list, to the actual metrics found on server.
+func ReconcileMetrics(server string, expected, actual []string) *Reconciliation {
+	r := &Reconciliation{
+		Server:   server,
+		Expected: len(expected),
+		Actual:   len(actual),
+		Missing:  make([]string, 0),
+		Orphaned: make([]string, 0),
+	}
+
+	found := make(map[string]bool, len(actual))
+	for _, m := range actual {
+		found[m] = true
+		if strings.HasPrefix(m, "carbon.agents.") {
+			// These metrics are inserted into the stream after hashing
+			continue
+		}
+		if Cluster.Hash.GetNode(locateKey(m)).Server != server {
+			r.Orphaned = append(r.Orphaned, m)
+		}
+	}
+	for _, m := range expected {
+		if !found[m] {
+			r.Missing = append(r.Missing, m)
+		}
+	}
+
+	sort.Strings(r.Missing)
+	sort.Strings(r.Orphaned)
+	return r
+}
+
+// reconcileCommand runs this subcommand.
+func reconcileCommand(c Command) int {
+	if reconcileHost == "" {
+		log.Print("A server must be given with --server.")
+		return 1
+	}
+
+	_, err := GetClusterConfig(HostPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	var metrics []string
+	if reconcileFromDir != "" {
+		metrics, err = walkMetrics(reconcileFromDir, nil, 0)
+		if err != nil {
+			log.Printf("Error reading %s: %s", reconcileFromDir, err)
+			return 1
+		}
+	} else if c.Flag.NArg() == 0 {
+		log.Print("At least one argument is required.")
+		return 1
+	} else if c.Flag.Arg(0) != "-" {
+		metrics = c.Flag.Args()
+	} else {
+		metrics, err = ReadMetrics(os.Stdin)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+
+	// Locate by server, not server:instance
+	locateCollapse = true
+	expected, err := InventoryMetrics(reconcileHost, metrics)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	hostport := net.JoinHostPort(reconcileHost, Cluster.Port)
+	list, err := ListAllMetrics([]string{hostport}, listForce)
+	if err != nil {
+		log.Printf("Error retrieving metric list from %s: %s", hostport, err)
+		return 1
+	}
+
+	r := ReconcileMetrics(reconcileHost, expected, list[hostport])
+	if JSONOutput {
+		err = WriteJSON(os.Stdout, r)
+		if err != nil {
+			log.Printf("Error encoding JSON output: %s", err)
+			return 1
+		}
+	} else {
+		fmt.Printf("Server: %s\n", r.Server)
+		fmt.Printf("Expected metrics: %d\n", r.Expected)
+		fmt.Printf("Actual metrics: %d\n", r.Actual)
+		fmt.Printf("Missing metrics: %d\n", len(r.Missing))
+		fmt.Printf("Orphaned metrics: %d\n", len(r.Orphaned))
+	}
+
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestReconcileMetrics(t *testing.T) {
+	hr, err := buildHashRing([]*hashing.JSONRingType{makeTestRing("carbon", 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Cluster = &ClusterConfig{Hash: hr, Healthy: true}
+	defer func() { Cluster = nil }()
+
+	metrics := make([]string, 0)
+	for _, p := range []string{"foo", "bar", "baz", "qux"} {
+		for _, s := range []string{"cpu", "mem", "disk", "net"} {
+			metrics = append(metrics, p+"."+s)
+		}
+	}
+	server := hr.GetNode(metrics[0]).Server
+	expected, err := InventoryMetrics(server, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Found on the server: all but the first expected metric, a metric
+	// owned elsewhere, and a carbon.agents metric
+	var elsewhere string
+	for _, m := range metrics {
+		if hr.GetNode(m).Server != server {
+			elsewhere = m
+			break
+		}
+	}
+	actual := append([]string{elsewhere, "carbon.agents.foo.cpuUsage"}, expected[1:]...)
+
+	r := ReconcileMetrics(server, expected, actual)
+	if strings.Join(r.Missing, " ") != expected[0] {
+		t.Errorf("ReconcileMetrics found missing %v, rather than %s", r.Missing, expected[0])
+	}
+	if strings.Join(r.Orphaned, " ") != elsewhere {
+		t.Errorf("ReconcileMetrics found orphaned %v, rather than %s", r.Orphaned, elsewhere)
+	}
+	if r.Expected != len(expected) || r.Actual != len(actual) {
+		t.Errorf("ReconcileMetrics counted %d expected and %d actual metrics",
+			r.Expected, r.Actual)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// relayAlgos maps the carbon-c-relay consistent hash cluster types to the
+// hashing algorithm each uses.
+var relayAlgos = map[string]string{
+	"carbon_ch":     "carbon",
+	"fnv1a_ch":      "fnv1a",
+	"jump_fnv1a_ch": "jump_fnv1a",
+}
+
+// relayRoute is a carbon-c-relay match rule.  A nil pattern matches
+// every metric, as "*" does.
+type relayRoute struct {
+	Patterns []*regexp.Regexp
+	Clusters []string
+	Stop     bool
+}
+
+// relayCluster is a carbon-c-relay consistent hash cluster: its hash ring
+// and the number of hosts each metric is written to.
+type relayCluster struct {
+	hashing.HashRing
+	Replication int
+}
+
+// RelayConfig is the routing of a carbon-c-relay configuration.  Metrics
+// are sent to the clusters of each match rule they match, in order, until
+// a rule with stop, and placed on Replication hosts by each cluster's hash
+// ring.
+type RelayConfig struct {
+	Clusters map[string]*relayCluster
+	Routes   []relayRoute
+}
+
+// Matches returns true if the metric matches the route.
+func (r relayRoute) Matches(metric string) bool {
+	for _, p := range r.Patterns {
+		if p == nil || p.MatchString(metric) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadRelayConfig reads the carbon-c-relay configuration file at path.
+func ReadRelayConfig(path string) (*RelayConfig, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	rc, err := parseRelayConfig(fd)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing relay config %s: %s", path, err)
+	}
+	return rc, nil
+}
+
+// relayStatements splits a carbon-c-relay configuration into its ;
+// terminated statements of whitespace separated words.  Comments run from
+// # to the end of the line.
+func relayStatements(r io.Reader) ([][]string, error) {
+	statements := make([][]string, 0)
+	words := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		for _, w := range strings.Fields(strings.ReplaceAll(line, ";", " ; ")) {
+			if w != ";" {
+				words = append(words, w)
+			} else if len(words) > 0 {
+				statements = append(statements, words)
+				words = make([]string, 0)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) > 0 {
+		return nil, fmt.Errorf("Statement not terminated by ;: %s", strings.Join(words, " "))
+	}
+	return statements, nil
+}
+
+// parseRelayConfig parses the cluster and match statements of a
+// carbon-c-relay configuration.  Other statements do not affect placement
+// and are skipped with a warning.
+func parseRelayConfig(r io.Reader) (*RelayConfig, error) {
+	statements, err := relayStatements(r)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &RelayConfig{Clusters: make(map[string]*relayCluster)}
+	for _, s := range statements {
+		switch s[0] {
+		case "cluster":
+			name, cluster, err := parseRelayCluster(s)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := rc.Clusters[name]; ok {
+				return nil, fmt.Errorf("Cluster %s is defined more than once", name)
+			}
+			rc.Clusters[name] = cluster
+		case "match":
+			route, err := parseRelayMatch(s)
+			if err != nil {
+				return nil, err
+			}
+			rc.Routes = append(rc.Routes, route)
+		default:
+			log.Printf("Warning: Skipping relay config %s statement", s[0])
+		}
+	}
+
+	for _, route := range rc.Routes {
+		for _, c := range route.Clusters {
+			if _, ok := rc.Clusters[c]; !ok {
+				return nil, fmt.Errorf("Match sends to undefined cluster %s", c)
+			}
+		}
+	}
+	if len(rc.Routes) == 0 {
+		return nil, fmt.Errorf("No match rules found")
+	}
+	return rc, nil
+}
+
+// parseRelayCluster parses a statement of the form
+// "cluster NAME TYPE [replication N] HOST[:PORT][=INSTANCE] ..." and
+// returns the cluster's name and the cluster.
+func parseRelayCluster(s []string) (string, *relayCluster, error) {
+	if len(s) < 4 {
+		return "", nil, fmt.Errorf("Incomplete cluster statement: %s", strings.Join(s, " "))
+	}
+	name := s[1]
+	algo, ok := relayAlgos[s[2]]
+	if !ok {
+		return "", nil, fmt.Errorf("Cluster %s of type %s does not place metrics by hash", name, s[2])
+	}
+
+	replicas, hosts := 1, s[3:]
+	if hosts[0] == "replication" {
+		if len(hosts) < 3 {
+			return "", nil, fmt.Errorf("Incomplete cluster statement: %s", strings.Join(s, " "))
+		}
+		var err error
+		replicas, err = strconv.Atoi(hosts[1])
+		if err != nil || replicas < 1 {
+			return "", nil, fmt.Errorf("Cluster %s has an invalid replication: %s", name, hosts[1])
+		}
+		hosts = hosts[2:]
+	}
+
+	hr, err := hashing.NewHashRing(algo, replicas)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, h := range hosts {
+		n, err := hashing.NewNodeParser(h)
+		if err != nil {
+			return "", nil, fmt.Errorf("Cluster %s: %s", name, err)
+		}
+		hr.AddNode(n)
+	}
+	return name, &relayCluster{HashRing: hr, Replication: replicas}, nil
+}
+
+// parseRelayMatch parses a statement of the form
+// "match EXPR ... send to CLUSTER ... [stop]".
+func parseRelayMatch(s []string) (relayRoute, error) {
+	route := relayRoute{}
+	i := 1
+	for ; i < len(s) && s[i] != "send"; i++ {
+		if s[i] == "*" {
+			route.Patterns = append(route.Patterns, nil)
+			continue
+		}
+		re, err := regexp.Compile(s[i])
+		if err != nil {
+			return route, fmt.Errorf("Invalid match expression %s: %s", s[i], err)
+		}
+		route.Patterns = append(route.Patterns, re)
+	}
+	if len(route.Patterns) == 0 || i+2 >= len(s) || s[i+1] != "to" {
+		return route, fmt.Errorf("Expected match EXPR send to CLUSTER: %s", strings.Join(s, " "))
+	}
+
+	route.Clusters = s[i+2:]
+	if route.Clusters[len(route.Clusters)-1] == "stop" {
+		route.Stop = true
+		route.Clusters = route.Clusters[:len(route.Clusters)-1]
+	}
+	if len(route.Clusters) == 0 {
+		return route, fmt.Errorf("Match sends to no clusters: %s", strings.Join(s, " "))
+	}
+	return route, nil
+}
+
+// Locate returns the "cluster/host" placements of the metric in the order
+// its match rules route it, with each replica a cluster writes the metric
+// to in the order the relay chooses them.  Metrics matching no rule have
+// no placement.
+func (rc *RelayConfig) Locate(metric string) []string {
+	result := make([]string, 0)
+	key := locateKey(metric)
+	for _, route := range rc.Routes {
+		if !route.Matches(metric) {
+			continue
+		}
+		for _, c := range route.Clusters {
+			cluster := rc.Clusters[c]
+			for _, n := range cluster.GetNodes(key, cluster.Replication) {
+				result = append(result, c+"/"+nodeName(n))
+			}
+		}
+		if route.Stop {
+			break
+		}
+	}
+	return result
+}
+
+// LocateRelayMetrics returns a map of metric => "cluster/host" placements
+// for each of the given metrics, as RelayConfig.Locate() places them.  The
+// number of metrics no match rule routes is logged.
+func LocateRelayMetrics(rc *RelayConfig, metrics []string) map[string][]string {
+	result := make(map[string][]string, len(metrics))
+	unrouted := 0
+	for _, m := range metrics {
+		result[m] = rc.Locate(m)
+		if len(result[m]) == 0 {
+			unrouted++
+		}
+	}
+	if unrouted > 0 {
+		log.Printf("Warning: %d metrics match no relay rule and are dropped", unrouted)
+	}
+	return result
+}
+
+// writeRouted writes the map of metric => placements returned by
+// LocateRelayMetrics() to w sorted by metric in the form
+// "metric => cluster/host[, cluster/host]".  JSON or YAML is written if
+// JSONOutput or YAMLOutput is set.
+func writeRouted(w io.Writer, list map[string][]string) error {
+	if JSONOutput {
+		return WriteJSON(w, list)
+	}
+	if YAMLOutput {
+		return WriteYAML(w, list)
+	}
+
+	metrics := make([]string, 0, len(list))
+	for m := range list {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+	for _, m := range metrics {
+		hosts := strings.Join(list[m], ", ")
+		if hosts == "" {
+			hosts = "none"
+		}
+		fmt.Fprintf(w, "%s => %s\n", m, hosts)
+	}
+	return nil
+}
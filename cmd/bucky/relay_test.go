@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRelayConfig = `
+# carbon-c-relay routing
+cluster sys fnv1a_ch replication 2
+    10.0.0.1:2003=a
+    10.0.0.2:2003=b
+    ;
+cluster apps carbon_ch 10.1.0.1 10.1.0.2;
+listen type linemode 2003 proto tcp;
+match ^sys\. send to sys stop;
+match ^app\. ^web\. send to apps;
+match * send to sys;
+`
+
+func TestParseRelayConfig(t *testing.T) {
+	rc, err := parseRelayConfig(strings.NewReader(testRelayConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.Clusters) != 2 || len(rc.Routes) != 3 {
+		t.Fatalf("Parsed %d clusters and %d routes, rather than 2 and 3",
+			len(rc.Clusters), len(rc.Routes))
+	}
+
+	defer func() { locateCollapse = true }()
+	locateCollapse = true
+	if rc.Clusters["sys"].Replication != 2 || rc.Clusters["apps"].Replication != 1 {
+		t.Errorf("Parsed replication %d and %d, rather than 2 and 1",
+			rc.Clusters["sys"].Replication, rc.Clusters["apps"].Replication)
+	}
+
+	// sys writes each metric to both of its hosts, primary first
+	data := map[string][]string{
+		"sys.cpu": {"sys", "sys"},
+		"app.foo": {"apps", "sys", "sys"},
+		"web.bar": {"apps", "sys", "sys"},
+		"other":   {"sys", "sys"},
+	}
+	for m, clusters := range data {
+		result := rc.Locate(m)
+		found := make([]string, 0, len(result))
+		for _, p := range result {
+			found = append(found, strings.SplitN(p, "/", 2)[0])
+		}
+		if !reflect.DeepEqual(found, clusters) {
+			t.Errorf("%s routed to %v, rather than %v", m, found, clusters)
+			continue
+		}
+
+		sys := result[len(result)-2:]
+		primary := "sys/" + rc.Clusters["sys"].GetNode(locateKey(m)).Server
+		if sys[0] != primary || sys[0] == sys[1] {
+			t.Errorf("%s placed on %v, rather than primary %s and the other sys host", m, sys, primary)
+		}
+		for _, p := range sys {
+			if p != "sys/10.0.0.1" && p != "sys/10.0.0.2" {
+				t.Errorf("%s placed on %s, which is not a sys host", m, p)
+			}
+		}
+	}
+}
+
+func TestParseRelayConfigErrors(t *testing.T) {
+	configs := []string{
+		"cluster a forward 10.0.0.1; match * send to a;",
+		"cluster a carbon_ch 10.0.0.1; match * send to b;",
+		"cluster a carbon_ch 10.0.0.1; match * send a;",
+		"cluster a carbon_ch replication x 10.0.0.1; match * send to a;",
+		"cluster a carbon_ch 10.0.0.1;",
+		"cluster a carbon_ch 10.0.0.1; match * send to a",
+		"cluster a carbon_ch 10.0.0.1; match ( send to a;",
+	}
+	for _, c := range configs {
+		if _, err := parseRelayConfig(strings.NewReader(c)); err == nil {
+			t.Errorf("Expected an error parsing %q", c)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// RemovalResult is the outcome of simulating the removal of nodes from the
+// cluster's hash ring.
+type RemovalResult struct {
+	// Diff is the metrics that move from the removed nodes
+	Diff *RingDiff
+
+	// Unowned lists the metrics that no longer resolve to one of the
+	// remaining nodes, which means the removal logic of the ring is broken
+	Unowned []string
+}
+
+// matchesNode returns true if the node spec, as given to --remove-node,
+// names the node.  A spec without a port or instance matches any.
+func matchesNode(spec, n hashing.Node) bool {
+	return spec.Server == n.Server &&
+		(spec.Port == 0 || spec.Port == n.Port) &&
+		(spec.Instance == "" || spec.Instance == n.Instance)
+}
+
+// removedNodes returns the nodes of the ring each of the specs, in the
+// HOST[:PORT][=INSTANCE] form, names.  An error is returned if a spec
+// names no node or every node would be removed.
+func removedNodes(ring *hashing.JSONRingType, specs []string) ([]hashing.Node, error) {
+	removed := make([]hashing.Node, 0)
+	seen := make(map[hashing.Node]bool)
+	for _, s := range specs {
+		spec, err := hashing.NewNodeParser(s)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, n := range ring.Nodes {
+			if matchesNode(spec, n) {
+				found = true
+				if !seen[n] {
+					seen[n] = true
+					removed = append(removed, n)
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("--remove-node %s names no node of the hash ring", s)
+		}
+	}
+	if len(removed) == len(ring.Nodes) {
+		return nil, fmt.Errorf("--remove-node would remove every node of the hash ring")
+	}
+	return removed, nil
+}
+
+// UnownedMetrics returns the metrics the hash ring places on a node that
+// is not one of the remaining nodes.  A correct ring never does.
+func UnownedMetrics(metrics []string, hr hashing.HashRing, remaining []hashing.Node) []string {
+	valid := make(map[string]bool, len(remaining))
+	for _, n := range remaining {
+		valid[n.String()] = true
+	}
+
+	unowned := make([]string, 0)
+	for _, m := range metrics {
+		if !valid[hr.GetNode(locateKey(m)).String()] {
+			unowned = append(unowned, m)
+		}
+	}
+	return unowned
+}
+
+// SimulateRemoval removes the nodes named by specs from a hash ring built
+// from the ring with the ring's own RemoveNode() and compares the
+// placement of the metrics before and after.  Each metric is then checked
+// to resolve to one of the remaining nodes.  Removing any node but the
+// last buckets of a jump ring is an error.
+func SimulateRemoval(metrics []string, ring *hashing.JSONRingType, specs []string) (*RemovalResult, error) {
+	removed, err := removedNodes(ring, specs)
+	if err != nil {
+		return nil, err
+	}
+	before, err := buildHashRing([]*hashing.JSONRingType{ring})
+	if err != nil {
+		return nil, err
+	}
+	after, err := buildHashRing([]*hashing.JSONRingType{ring})
+	if err != nil {
+		return nil, err
+	}
+
+	r, ok := after.(interface{ RemoveNode(hashing.Node) })
+	if !ok {
+		return nil, fmt.Errorf("The %s hash ring does not support removing nodes", ring.Algo)
+	}
+	gone := make(map[hashing.Node]bool, len(removed))
+	for _, n := range removed {
+		r.RemoveNode(n)
+		gone[n] = true
+	}
+	remaining := make([]hashing.Node, 0, len(ring.Nodes)-len(removed))
+	for _, n := range ring.Nodes {
+		if !gone[n] {
+			remaining = append(remaining, n)
+		}
+	}
+	if err := checkJumpRemoval(before, after, gone); err != nil {
+		return nil, err
+	}
+
+	return &RemovalResult{
+		Diff:    CompareRings(metrics, before, after),
+		Unowned: UnownedMetrics(metrics, after, remaining),
+	}, nil
+}
+
+// checkJumpRemoval returns an error if the nodes in gone are not the ones
+// a jump ring removed.  Jump hashing has no removal logic of its own: it
+// can only shrink by dropping its last buckets, and any other node must be
+// replaced in place instead.
+func checkJumpRemoval(before, after hashing.HashRing, gone map[hashing.Node]bool) error {
+	if _, ok := after.(*hashing.JumpHashRing); !ok {
+		return nil
+	}
+	kept := make(map[string]bool, after.Len())
+	for _, n := range after.Nodes() {
+		kept[n.String()] = true
+	}
+	last := make([]string, 0, len(gone))
+	ok := true
+	for _, n := range before.Nodes() {
+		if !kept[n.String()] {
+			last = append(last, n.String())
+			ok = ok && gone[n]
+		}
+	}
+	if !ok {
+		return fmt.Errorf("A jump hash ring can only shrink from the end: removing %d nodes drops its last buckets %s, not the nodes given",
+			len(last), strings.Join(last, ", "))
+	}
+	return nil
+}
+
+// compareRemoval simulates removing the nodes named by specs from the
+// cluster's hash ring and returns the differences in placement of the
+// metrics.  Metrics that resolve to no remaining node are logged and
+// returned as a count.
+func compareRemoval(metrics []string, specs []string) (*RingDiff, int, error) {
+	if !Cluster.Healthy {
+		log.Print(ErrClusterUnhealthy)
+		return nil, 0, ErrClusterUnhealthy
+	}
+	result, err := SimulateRemoval(metrics, Cluster.Rings[0], specs)
+	if err != nil {
+		log.Print(err)
+		return nil, 0, err
+	}
+	if len(result.Unowned) > 0 {
+		logSample("metrics resolve to no remaining node after removal:", result.Unowned)
+	} else {
+		log.Printf("All %d metrics resolve to a remaining node after removal", result.Diff.Total)
+	}
+	return result.Diff, len(result.Unowned), nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestRemovedNodes(t *testing.T) {
+	ring := makeTestRing("carbon", 3)
+
+	removed, err := removedNodes(ring, []string{"graphite001"})
+	if err != nil || len(removed) != 2 {
+		t.Errorf("removedNodes() of a server returned %v, %v", removed, err)
+	}
+	removed, err = removedNodes(ring, []string{"graphite001=b", "graphite001:2004"})
+	if err != nil || len(removed) != 1 || removed[0] != hashing.NewNode("graphite001", 2004, "b") {
+		t.Errorf("removedNodes() of one instance returned %v, %v", removed, err)
+	}
+
+	bad := [][]string{
+		{"graphite009"},
+		{"graphite001=c"},
+		{"graphite000", "graphite001", "graphite002"},
+		{"graphite001:x"},
+	}
+	for _, specs := range bad {
+		if _, err := removedNodes(ring, specs); err == nil {
+			t.Errorf("removedNodes(%v) did not return an error", specs)
+		}
+	}
+}
+
+func TestSimulateRemoval(t *testing.T) {
+	metrics := make([]string, 0, 500)
+	for i := 0; i < 500; i++ {
+		metrics = append(metrics, fmt.Sprintf("foo.bar%d.baz", i))
+	}
+
+	ring := makeTestRing("carbon", 4)
+	result, err := SimulateRemoval(metrics, ring, []string{"graphite002"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Unowned) != 0 {
+		t.Errorf("SimulateRemoval() left %d metrics unowned", len(result.Unowned))
+	}
+	if result.Diff.Changed == 0 {
+		t.Errorf("SimulateRemoval() moved no metrics")
+	}
+	for _, m := range result.Diff.Moved {
+		if m.From != "graphite002" || m.To == "graphite002" {
+			t.Errorf("SimulateRemoval() moved %s from %s to %s", m.Metric, m.From, m.To)
+		}
+	}
+
+	// A jump ring can only remove its last nodes, ordered by instance
+	ring = makeTestRing("jump_fnv1a", 4)
+	for i := range ring.Nodes {
+		ring.Nodes[i].Instance = fmt.Sprintf("%s-%s", ring.Nodes[i].Server, ring.Nodes[i].Instance)
+	}
+	result, err = SimulateRemoval(metrics, ring, []string{"graphite003"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Unowned) != 0 {
+		t.Errorf("SimulateRemoval() of the last jump nodes left %d metrics unowned", len(result.Unowned))
+	}
+	for _, spec := range []string{"graphite000=graphite000-a", "graphite003=graphite003-a"} {
+		_, err = SimulateRemoval(metrics, ring, []string{spec})
+		if err == nil || !strings.Contains(err.Error(), "shrink from the end") {
+			t.Errorf("SimulateRemoval() of jump node %s returned %v", spec, err)
+		}
+	}
+	result, err = SimulateRemoval(metrics, ring, []string{"graphite003=graphite003-b"})
+	if err != nil || len(result.Unowned) != 0 {
+		t.Errorf("SimulateRemoval() of the last jump bucket returned %v", err)
+	}
+}
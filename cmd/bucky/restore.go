@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -36,6 +37,30 @@ the top level whisper storage directory on the Graphite servers you can use the
 path and the path contained in the tar file must result in the relative path to
 the metric on the Graphite server rooted at the whisper storage directory.
 
+Before restoring any metrics we print how many will be written to each
+server and ask for confirmation.  An archive read from STDIN is first copied
+to a temporary file to do so.  Use --yes to skip the prompt.  We do not ask
+when there is no terminal to ask on.
+
+Use --host-map to give a file mapping carbon instances to the hosts to
+connect to when they differ, such as when an instance name is not the
+server's hostname.  The file is a JSON object of instance => host or has
+an instance and a host on each line separated by whitespace.  Entries may
+name a server:instance node, an instance, or a server.  Placement still
+uses the hash ring's nodes.
+
+Each Whisper DB is sent with its SHA-256 checksum and the receiving buckyd
+daemon verifies the data it receives before writing or filling from it, so
+truncated or corrupted transfers are caught.  Failed uploads are retried
+--retries times and metrics that still fail are listed and make the
+restore fail.
+
+Use --manifest to give the JSON manifest written by tar --manifest.  Before
+anything is restored the archive is checked against it and we exit with an
+error, listing the problems, if any metric is missing from the archive or the
+manifest or if its size or checksum differs.  An archive read from STDIN is
+first copied to a temporary file to do so.
+
 Set -w to change the number of worker threads used to upload the Whisper
 DBs to the remote servers.`
 
@@ -43,6 +68,9 @@ DBs to the remote servers.`
 	SetupCommon(c)
 	SetupHostname(c)
 	SetupSingle(c)
+	SetupConfirm(c)
+	SetupHostMap(c)
+	SetupRetries(c)
 
 	c.Flag.IntVar(&metricWorkers, "w", 5,
 		"Downloader threads.")
@@ -50,22 +78,95 @@ DBs to the remote servers.`
 		"Downloader threads.")
 	c.Flag.StringVar(&tarPrefix, "p", "",
 		"Prefix all metrics in the tar file with this path.")
+	c.Flag.StringVar(&manifestFile, "manifest", "",
+		"Check the tar file against this manifest before restoring.")
+}
+
+// restoreServer returns the server the metric in the tar archive at the
+// given path is restored to.
+func restoreServer(name string) string {
+	return Cluster.Hash.GetNode(RelativeToMetric(filepath.Join(tarPrefix, name))).Server
+}
+
+// isRestorable returns true if the tar entry is a regular file.
+func isRestorable(hdr *tar.Header) bool {
+	return hdr.Typeflag == tar.TypeRegA || hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeGNUSparse
+}
+
+// tarPlacement reads the tar archive and returns a map of server => the
+// number of its metrics that would be restored there.
+func tarPlacement(servers []string, fd io.Reader) (map[string]int, error) {
+	dests := make(map[string]int)
+	tr := tar.NewReader(fd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return dests, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !isRestorable(hdr) {
+			continue
+		}
+		server := restoreServer(hdr.Name)
+		if SingleHost && server != servers[0] {
+			continue
+		}
+		dests[server]++
+	}
+}
+
+// confirmRestore shows where the metrics in the tar archive would be
+// restored and asks the user to confirm.  The archive is rewound so that
+// it can then be restored.
+func confirmRestore(servers []string, fd *os.File) (bool, error) {
+	dests, err := tarPlacement(servers, fd)
+	if err != nil {
+		return false, err
+	}
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return confirmPlacement(dests), nil
+}
+
+// spoolStdin copies STDIN to a temporary file so that it may be read more
+// than once.  The file is removed when closed by the caller.
+func spoolStdin() (*os.File, error) {
+	fd, err := ioutil.TempFile("", "bucky-restore.")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(fd.Name())
+	if _, err := io.Copy(fd, os.Stdin); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return fd, nil
 }
 
 func restoreTarWorker(workIn chan *MetricData, servers []string, wg *sync.WaitGroup) {
 	for work := range workIn {
-		server := Cluster.Hash.GetNode(work.Name).Server
-		if SingleHost && server != servers[0] {
-			log.Printf("In single mode, skipping metric %s for server %s", work.Name, server)
+		node := Cluster.Hash.GetNode(work.Name)
+		if SingleHost && node.Server != servers[0] {
+			log.Printf("In single mode, skipping metric %s for server %s", work.Name, node.Server)
 			continue
 		}
+		server := connectHost(node)
 		if err := MetricEncode(work, EncSnappy); err != nil {
 			log.Printf("Skipping %s due to encoding error: %s", work.Name, err)
 			workerErrors = true
 			continue
 		}
 		log.Printf("Uploading %s => %s", work.Name, server)
-		err := PostMetric(server, work)
+		err := retryTransfer(work.Name, func() error {
+			return PostMetric(server, work)
+		})
 		if err != nil {
 			workerErrors = true
 		}
@@ -93,7 +194,7 @@ func RestoreTar(servers []string, fd *os.File) error {
 			log.Printf("Error reading tar archive: %s", err)
 			return err
 		}
-		if (hdr.Typeflag != tar.TypeRegA) && (hdr.Typeflag != tar.TypeReg) && (hdr.Typeflag != tar.TypeGNUSparse) {
+		if !isRestorable(hdr) {
 			// A non-normal file, probably directory
 			log.Printf("Non-restorable file/directory. Type: 0x%X Name: %s",
 				hdr.Typeflag, hdr.Name)
@@ -117,6 +218,7 @@ func RestoreTar(servers []string, fd *os.File) error {
 			log.Printf("Error: Data from tar file not the correct size.")
 			return fmt.Errorf("Data from tar file not the correct size.")
 		}
+		metric.Checksum = Checksum(metric.Data)
 		// XXX: Snappy Compress for transit?
 		workIn <- metric
 	}
@@ -125,6 +227,9 @@ func RestoreTar(servers []string, fd *os.File) error {
 	wg.Wait()
 
 	log.Printf("Restore complete.")
+	if err := logFailedTransfers(); err != nil {
+		return err
+	}
 	if workerErrors {
 		log.Printf("Errors are present in restore.")
 		return fmt.Errorf("Errors uploading metric data present.")
@@ -134,6 +239,10 @@ func RestoreTar(servers []string, fd *os.File) error {
 
 // restoreCommand runs this subcommand.
 func restoreCommand(c Command) int {
+	if err := LoadHostMap(); err != nil {
+		log.Print(err)
+		return 1
+	}
 	_, err := GetClusterConfig(HostPort)
 	if err != nil {
 		log.Print(err)
@@ -148,16 +257,53 @@ func restoreCommand(c Command) int {
 		return 1
 	}
 
+	fd := os.Stdin
 	if c.Flag.Arg(0) != "-" {
-		fd, err := os.Open(c.Flag.Arg(0))
+		fd, err = os.Open(c.Flag.Arg(0))
 		if err != nil {
 			log.Fatalf("Error opening tar archive: %s", err)
 		}
-		err = RestoreTar(Cluster.HostPorts(), fd)
-	} else {
-		err = RestoreTar(Cluster.HostPorts(), os.Stdin)
+		defer fd.Close()
+	}
+
+	if (needConfirmation() || manifestFile != "") && fd == os.Stdin {
+		fd, err = spoolStdin()
+		if err != nil {
+			log.Printf("Error reading tar archive from STDIN: %s", err)
+			return 1
+		}
+		defer fd.Close()
+	}
+
+	if manifestFile != "" {
+		manifest, err := ReadManifest(manifestFile)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		if err := CheckManifest(manifest, fd); err != nil {
+			log.Print(err)
+			return 1
+		}
+		if _, err := fd.Seek(0, io.SeekStart); err != nil {
+			log.Printf("Error reading tar archive: %s", err)
+			return 1
+		}
+	}
+
+	if needConfirmation() {
+		ok, err := confirmRestore(Cluster.HostPorts(), fd)
+		if err != nil {
+			log.Printf("Error reading tar archive: %s", err)
+			return 1
+		}
+		if !ok {
+			log.Printf("Restore aborted.")
+			return 1
+		}
 	}
 
+	err = RestoreTar(Cluster.HostPorts(), fd)
 	if err != nil {
 		return 1
 	}
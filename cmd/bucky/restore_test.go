@@ -0,0 +1,62 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestTarPlacement(t *testing.T) {
+	ring := &hashing.JSONRingType{
+		Name:     "graphite010",
+		Algo:     "carbon",
+		Replicas: 100,
+		Nodes: []hashing.Node{
+			hashing.NewNode("graphite010", 2004, ""),
+			hashing.NewNode("graphite011", 2004, ""),
+		},
+	}
+	c, err := NewClusterConfig("4242", []*hashing.JSONRingType{ring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Cluster = c
+	defer func() { Cluster, SingleHost = nil, false }()
+
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	names := []string{"foo/bar.wsp", "foo/baz.wsp", "foo/qux.wsp", "abc/def.wsp"}
+	expected := make(map[string]int)
+	for _, n := range names {
+		tw.WriteHeader(&tar.Header{Name: n, Mode: 0644, Size: 0, Typeflag: tar.TypeReg})
+		expected[restoreServer(n)]++
+	}
+	tw.WriteHeader(&tar.Header{Name: "foo/", Mode: 0755, Typeflag: tar.TypeDir})
+	tw.Close()
+
+	dests, err := tarPlacement(c.HostPorts(), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dests) != len(expected) {
+		t.Fatalf("tarPlacement() returned %v, expected %v", dests, expected)
+	}
+	for s, n := range expected {
+		if dests[s] != n {
+			t.Errorf("tarPlacement() placed %d metrics on %s, expected %d", dests[s], s, n)
+		}
+	}
+
+	SingleHost = true
+	dests, err = tarPlacement([]string{"graphite010"}, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for s := range dests {
+		if s != "graphite010" {
+			t.Errorf("tarPlacement() with -s placed metrics on %s", s)
+		}
+	}
+}
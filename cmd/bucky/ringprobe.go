@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// probePosition is the ring position probed in decimal or 0x prefixed hex.
+var probePosition string
+
+// probeHash is the ring position probed given as a hex hash value.
+var probeHash string
+
+// probeWindow is the distance around the position metrics are reported.
+var probeWindow int
+
+// ProbedMetric is a metric found near the probed ring position.
+type ProbedMetric struct {
+	Metric string `json:"metric"`
+
+	// Position is the ring position the metric hashes to
+	Position int `json:"position"`
+
+	// Offset is the distance from the probed position, negative before it
+	Offset int `json:"offset"`
+
+	// Node owns the metric's position
+	Node string `json:"node"`
+}
+
+// RingProbe reports the given metrics that hash near a ring position.
+type RingProbe struct {
+	Position int `json:"position"`
+	Window   int `json:"window"`
+
+	// Owner is the Node that owns the probed position
+	Owner string `json:"owner"`
+
+	// Owners are the Nodes that own any part of the window in ring order
+	Owners []string `json:"owners"`
+
+	// Metrics are the metrics within the window sorted by offset
+	Metrics []ProbedMetric `json:"metrics"`
+}
+
+func init() {
+	usage := "[options] <metric list>"
+	short := "Find the metrics that hash near a ring position."
+	long := `Report which of the given metrics hash to within --window positions
+of the ring position given by --position, and which nodes own that part of
+the ring.  This helps explain why a node is hot by surfacing the exact keys
+clustered at its ring segment.  Use --hash to give the position as a hex
+hash value, such as 1a2b, rather than --position.  Positions may be given
+in decimal or in hex with a 0x prefix and wrap around the end of the ring.
+
+Metrics may be listed on the command line as arguments or, if the first
+argument is "-" we read the list on STDIN as a JSON array or one metric per
+line.  Each metric found is written with its offset from the probed
+position, its position, and the node owning it, sorted by offset.  Use -j for JSON output.
+
+The jump_fnv1a algorithm places metrics without ring positions and cannot
+be probed.  Use -s to query the hash ring only on the host given by -h or
+in the BUCKYHOST environment variable.  Use --ring-file to probe the hash
+ring in a ring file rather than the cluster.`
+
+	c := NewCommand(ringProbeCommand, "ring-probe", usage, short, long)
+	SetupCommon(c)
+	SetupHostname(c)
+	SetupSingle(c)
+	SetupJSON(c)
+	SetupRingFile(c)
+
+	c.Flag.StringVar(&probePosition, "position", "",
+		"Ring position to probe.")
+	c.Flag.StringVar(&probeHash, "hash", "",
+		"Ring position to probe as a hex hash value.")
+	c.Flag.IntVar(&probeWindow, "window", 100,
+		"Report metrics within this many positions of the probed position.")
+}
+
+// probedPosition returns the ring position given by --position or
+// --hash.
+func probedPosition() (int, error) {
+	var p int64
+	var err error
+	switch {
+	case probePosition != "" && probeHash != "":
+		return 0, fmt.Errorf("--position and --hash are mutually exclusive.")
+	case probePosition != "":
+		p, err = strconv.ParseInt(probePosition, 0, 64)
+	case probeHash != "":
+		p, err = strconv.ParseInt(strings.TrimPrefix(probeHash, "0x"), 16, 64)
+	default:
+		return 0, fmt.Errorf("A ring position must be given with --position or --hash.")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Invalid ring position: %s", err)
+	}
+	if p < 0 || p >= ringSize {
+		return 0, fmt.Errorf("Ring position %d is not between 0 and %d.", p, ringSize-1)
+	}
+	return int(p), nil
+}
+
+// ringOffset returns the signed distance from position from to position to
+// going the shorter way around the ring.
+func ringOffset(from, to int) int {
+	d := (to - from) % ringSize
+	if d < 0 {
+		d += ringSize
+	}
+	if d >= ringSize/2 {
+		d -= ringSize
+	}
+	return d
+}
+
+// ProbeRing returns the RingProbe of the given metrics within window of
+// position on the hash ring.
+func ProbeRing(hr hashing.HashRing, position, window int, metrics []string) (*RingProbe, error) {
+	ring, err := ringEntries(hr)
+	if err != nil {
+		return nil, err
+	}
+	owners := ringOwners(ring)
+	if window > ringSize/2 {
+		window = ringSize / 2
+	}
+
+	probe := &RingProbe{
+		Position: position,
+		Window:   window,
+		Owner:    owners[position],
+		Owners:   make([]string, 0),
+		Metrics:  make([]ProbedMetric, 0),
+	}
+	seen := make(map[string]bool)
+	for off := -window; off <= window; off++ {
+		o := owners[(position+off+ringSize)%ringSize]
+		if !seen[o] {
+			seen[o] = true
+			probe.Owners = append(probe.Owners, o)
+		}
+	}
+
+	positions := hr.(hashing.RingPositions)
+	for _, m := range metrics {
+		p := positions.KeyPosition(locateKey(m))
+		off := ringOffset(position, p)
+		if off < -window || off > window {
+			continue
+		}
+		probe.Metrics = append(probe.Metrics, ProbedMetric{m, p, off, owners[p]})
+	}
+	sort.Slice(probe.Metrics, func(i, j int) bool {
+		a, b := probe.Metrics[i], probe.Metrics[j]
+		if a.Offset != b.Offset {
+			return a.Offset < b.Offset
+		}
+		return a.Metric < b.Metric
+	})
+
+	return probe, nil
+}
+
+// writeRingProbe writes the RingProbe to w as text or, if JSONOutput is
+// set, as JSON.
+func writeRingProbe(w io.Writer, probe *RingProbe) error {
+	if JSONOutput {
+		return WriteJSON(w, probe)
+	}
+
+	fmt.Fprintf(w, "Position %d (0x%04x) is owned by %s\n",
+		probe.Position, probe.Position, probe.Owner)
+	fmt.Fprintf(w, "Window of %d positions is owned by %s\n",
+		probe.Window, strings.Join(probe.Owners, ", "))
+	for _, m := range probe.Metrics {
+		fmt.Fprintf(w, "%+d\t%d\t%s\t%s\n", m.Offset, m.Position, m.Node, m.Metric)
+	}
+	_, err := fmt.Fprintf(w, "%d metrics within the window\n", len(probe.Metrics))
+	return err
+}
+
+// ringProbeCommand runs this subcommand.
+func ringProbeCommand(c Command) int {
+	position, err := probedPosition()
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if probeWindow < 0 {
+		log.Print("--window must not be negative.")
+		return 1
+	}
+	if c.Flag.NArg() == 0 {
+		log.Print("At least one argument is required.")
+		return 1
+	}
+
+	_, err = GetClusterConfig(HostPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if !Cluster.Healthy {
+		log.Printf("Warning: Cluster is not healthy!")
+	}
+
+	var metrics []string
+	if c.Flag.Arg(0) != "-" {
+		metrics = c.Flag.Args()
+	} else {
+		metrics, err = ReadMetrics(os.Stdin)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+
+	probe, err := ProbeRing(Cluster.Hash, position, probeWindow, metrics)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	err = writeRingProbe(os.Stdout, probe)
+	if err != nil {
+		log.Printf("Error writing output: %s", err)
+		return 1
+	}
+	return 0
+}
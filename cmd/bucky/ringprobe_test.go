@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestRingOffset(t *testing.T) {
+	data := [][3]int{
+		{100, 150, 50},
+		{150, 100, -50},
+		{10, ringSize - 10, -20},
+		{ringSize - 10, 10, 20},
+		{0, ringSize / 2, -ringSize / 2},
+	}
+	for _, d := range data {
+		if off := ringOffset(d[0], d[1]); off != d[2] {
+			t.Errorf("ringOffset(%d, %d) returned %d, rather than %d", d[0], d[1], off, d[2])
+		}
+	}
+}
+
+func TestProbeRing(t *testing.T) {
+	hr, err := buildHashRing([]*hashing.JSONRingType{makeTestRing("carbon", 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := make([]string, 0, 5000)
+	for i := 0; i < 5000; i++ {
+		metrics = append(metrics, fmt.Sprintf("bucky.probe.metric%d", i))
+	}
+
+	// Probe around the position of a metric so the window is not empty
+	positions := hr.(hashing.RingPositions)
+	center := positions.KeyPosition(metrics[0])
+	probe, err := ProbeRing(hr, center, 500, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(probe.Metrics) == 0 || len(probe.Metrics) == len(metrics) {
+		t.Fatalf("Found %d of %d metrics within the window", len(probe.Metrics), len(metrics))
+	}
+	if probe.Owner != hr.GetNode(metrics[0]).String() {
+		t.Errorf("Position %d owned by %s, rather than %s", center, probe.Owner, hr.GetNode(metrics[0]))
+	}
+
+	found := 0
+	for i, m := range probe.Metrics {
+		if m.Offset < -500 || m.Offset > 500 || m.Offset != ringOffset(center, m.Position) {
+			t.Errorf("%s at %d has offset %d from %d", m.Metric, m.Position, m.Offset, center)
+		}
+		if i > 0 && m.Offset < probe.Metrics[i-1].Offset {
+			t.Errorf("Metrics are not sorted by offset at %d", i)
+		}
+		if m.Node != hr.GetNode(m.Metric).String() {
+			t.Errorf("%s owned by %s, rather than %s", m.Metric, m.Node, hr.GetNode(m.Metric))
+		}
+		owned := false
+		for _, o := range probe.Owners {
+			owned = owned || o == m.Node
+		}
+		if !owned {
+			t.Errorf("%s owner %s is not a window owner %v", m.Metric, m.Node, probe.Owners)
+		}
+		found++
+	}
+	for _, m := range metrics {
+		if off := ringOffset(center, positions.KeyPosition(m)); off >= -500 && off <= 500 {
+			found--
+		}
+	}
+	if found != 0 {
+		t.Errorf("Probe missed %d metrics within the window", -found)
+	}
+
+	jump, _ := buildHashRing([]*hashing.JSONRingType{makeTestRing("jump_fnv1a", 4)})
+	if _, err := ProbeRing(jump, 0, 10, metrics); err == nil {
+		t.Errorf("Expected an error probing a jump_fnv1a ring")
+	}
+}
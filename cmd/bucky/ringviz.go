@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// ringVizFormat is the visualization format, dot or ascii.
+var ringVizFormat string
+
+// ringVizWidth is the number of columns of the ASCII ring.
+var ringVizWidth int
+
+// ringSize is the number of positions in the 16bit wide hash rings.
+const ringSize = 0x10000
+
+func init() {
+	usage := "[options]"
+	short := "Visualize the hash ring's nodes and ring positions."
+	long := `Write to STDOUT a visualization of the hash ring showing where each
+physical node's points lie on the ring.  This is a teaching aid to explain
+how metrics are placed and is built from the cluster's hash ring.  A metric
+belongs to the node owning the first point at or after the metric's own
+position on the ring, wrapping around at the end.
+
+With --format=dot, the default, we write a Graphviz DOT graph.  The ring
+points, labeled with their positions, are joined in ring order and each is
+attached to its node.  Render it with, for example:
+
+    bucky ring-viz | circo -Tsvg > ring.svg
+
+With --format=ascii we write the ring as a strip of --width columns, each
+column being a slice of the ring labeled with the letter of the node owning
+most of it, followed by a legend of the nodes, their points, and their share
+of the ring.
+
+The jump_fnv1a algorithm places metrics without ring points and cannot be
+visualized.  Use -s to query the hash ring only on the host given by -h or
+in the BUCKYHOST environment variable.  Use --ring-file to visualize the
+hash ring in a ring file rather than the cluster.`
+
+	c := NewCommand(ringVizCommand, "ring-viz", usage, short, long)
+	SetupCommon(c)
+	SetupHostname(c)
+	SetupSingle(c)
+	SetupRingFile(c)
+
+	c.Flag.StringVar(&ringVizFormat, "format", "dot",
+		"Visualization format: dot or ascii.")
+	c.Flag.IntVar(&ringVizWidth, "width", 72,
+		"Number of columns of the ascii ring.")
+}
+
+// ringEntries returns the ring entries of the given hash ring or an error
+// if it does not place nodes on a ring.
+func ringEntries(hr hashing.HashRing) ([]hashing.RingEntry, error) {
+	r, ok := hr.(hashing.RingPositions)
+	if !ok {
+		return nil, fmt.Errorf("Hash ring %s has no ring positions to visualize", hr)
+	}
+	ring := r.Ring()
+	if len(ring) == 0 {
+		return nil, fmt.Errorf("Hash ring is empty")
+	}
+	return ring, nil
+}
+
+// writeRingDot writes the ring as a Graphviz DOT graph to w.
+func writeRingDot(w io.Writer, hr hashing.HashRing) error {
+	ring, err := ringEntries(hr)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "graph ring {")
+	fmt.Fprintln(w, "  layout=circo;")
+	fmt.Fprintln(w, "  node [shape=point];")
+	for _, n := range hr.Nodes() {
+		fmt.Fprintf(w, "  %q [shape=box];\n", n.String())
+	}
+	for i, e := range ring {
+		fmt.Fprintf(w, "  p%d [xlabel=\"%d\"];\n", i, e.Position())
+		fmt.Fprintf(w, "  p%d -- %q [style=dotted];\n", i, e.Node().String())
+	}
+	for i := range ring {
+		fmt.Fprintf(w, "  p%d -- p%d;\n", i, (i+1)%len(ring))
+	}
+	_, err = fmt.Fprintln(w, "}")
+	return err
+}
+
+// ringOwners returns, for each of the ring positions, the Node that owns
+// it as a metric at that position would be placed.
+func ringOwners(ring []hashing.RingEntry) []string {
+	owners := make([]string, ringSize)
+	j := 0
+	for p := 0; p < ringSize; p++ {
+		for j < len(ring) && ring[j].Position() < p {
+			j++
+		}
+		owners[p] = ring[j%len(ring)].Node().String()
+	}
+	return owners
+}
+
+// writeRingASCII writes the ring as a strip of width columns followed by
+// a legend to w.
+func writeRingASCII(w io.Writer, hr hashing.HashRing, width int) error {
+	ring, err := ringEntries(hr)
+	if err != nil {
+		return err
+	}
+
+	nodes := hr.Nodes()
+	label := make(map[string]byte, len(nodes))
+	legend := "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	for i, n := range nodes {
+		label[n.String()] = '?'
+		if i < len(legend) {
+			label[n.String()] = legend[i]
+		}
+	}
+
+	owners := ringOwners(ring)
+	share := make(map[string]int, len(nodes))
+	for _, o := range owners {
+		share[o]++
+	}
+	strip := make([]byte, width)
+	for c := 0; c < width; c++ {
+		counts := make(map[string]int)
+		for p := c * ringSize / width; p < (c+1)*ringSize/width; p++ {
+			counts[owners[p]]++
+		}
+		best := ""
+		for o, n := range counts {
+			if n > counts[best] || (n == counts[best] && o < best) {
+				best = o
+			}
+		}
+		strip[c] = label[best]
+	}
+
+	points := make(map[string]int, len(nodes))
+	for _, e := range ring {
+		points[e.Node().String()]++
+	}
+	fmt.Fprintf(w, "0%s%d\n", strings.Repeat(" ", width-len(fmt.Sprint(ringSize-1))-1), ringSize-1)
+	fmt.Fprintf(w, "%s\n\n", strip)
+	keys := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		keys = append(keys, n.String())
+	}
+	sort.Strings(keys)
+	for _, n := range keys {
+		fmt.Fprintf(w, "%c %s: %d points, %.2f%% of the ring\n", label[n], n,
+			points[n], 100*float64(share[n])/ringSize)
+	}
+	return nil
+}
+
+// ringVizCommand runs this subcommand.
+func ringVizCommand(c Command) int {
+	if ringVizFormat != "dot" && ringVizFormat != "ascii" {
+		log.Printf("Unknown --format %s, must be dot or ascii.", ringVizFormat)
+		return 1
+	}
+	if ringVizWidth < 8 {
+		log.Print("--width must be at least 8.")
+		return 1
+	}
+
+	_, err := GetClusterConfig(HostPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if !Cluster.Healthy {
+		log.Printf("Warning: Cluster is not healthy!")
+	}
+
+	if ringVizFormat == "dot" {
+		err = writeRingDot(os.Stdout, Cluster.Hash)
+	} else {
+		err = writeRingASCII(os.Stdout, Cluster.Hash, ringVizWidth)
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
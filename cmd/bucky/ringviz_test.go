@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestRingOwners(t *testing.T) {
+	hr := hashing.NewCarbonHashRing()
+	hr.AddNode(hashing.NewNode("graphite010", 2004, ""))
+	hr.AddNode(hashing.NewNode("graphite011", 2004, ""))
+	ring, err := ringEntries(hr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owners := ringOwners(ring)
+	for _, e := range ring {
+		if owners[e.Position()] != e.Node().String() {
+			t.Errorf("Position %d owned by %s rather than %s", e.Position(),
+				owners[e.Position()], e.Node())
+		}
+	}
+	last := ring[len(ring)-1]
+	if last.Position() < ringSize-1 && owners[ringSize-1] != ring[0].Node().String() {
+		t.Errorf("Ring does not wrap around to %s", ring[0].Node())
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeRingASCII(buf, hr, 40); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if len(lines[1]) != 40 || strings.Trim(lines[1], "AB") != "" {
+		t.Errorf("writeRingASCII() wrote strip %q", lines[1])
+	}
+
+	if _, err := ringEntries(hashing.NewJumpHashRing(1)); err == nil {
+		t.Errorf("ringEntries() of a jump hash ring did not fail")
+	}
+}
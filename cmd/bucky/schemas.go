@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// StorageSchema is a section of carbon's storage-schemas.conf.  Whisper DBs
+// of the metrics it matches are created with its retentions.
+type StorageSchema struct {
+	Name string
+
+	// Pattern matches the metrics the schema applies to.  A nil Pattern
+	// is a match-all schema.
+	Pattern *regexp.Regexp
+
+	Retentions string
+}
+
+// SchemaLocation is a metric's host and the storage schema carbon creates
+// its Whisper DB with.  Schema and Retentions are empty if no schema matches.
+type SchemaLocation struct {
+	Host       string `json:"host"`
+	Schema     string `json:"schema"`
+	Retentions string `json:"retentions"`
+}
+
+// Matches returns true if the schema applies to the metric.
+func (s *StorageSchema) Matches(metric string) bool {
+	return s.Pattern == nil || s.Pattern.MatchString(metric)
+}
+
+// ReadStorageSchemas reads the carbon storage-schemas.conf file at path.
+func ReadStorageSchemas(path string) ([]*StorageSchema, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	schemas, err := parseStorageSchemas(fd)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing storage schemas %s: %s", path, err)
+	}
+	return schemas, nil
+}
+
+// parseStorageSchemas parses the INI style sections of a storage-schemas.conf
+// in file order.  Each section needs a pattern, or match-all = true, and
+// retentions.  Other keys are ignored as carbon does not use them to match.
+func parseStorageSchemas(r io.Reader) ([]*StorageSchema, error) {
+	schemas := make([]*StorageSchema, 0)
+	var s *StorageSchema
+	matchAll := false
+	check := func() error {
+		if s == nil {
+			return nil
+		}
+		if s.Pattern == nil && !matchAll {
+			return fmt.Errorf("Schema %s has no pattern", s.Name)
+		}
+		if s.Retentions == "" {
+			return fmt.Errorf("Schema %s has no retentions", s.Name)
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			if err := check(); err != nil {
+				return nil, err
+			}
+			s = &StorageSchema{Name: strings.TrimSpace(line[1 : len(line)-1])}
+			matchAll = false
+			schemas = append(schemas, s)
+			continue
+		}
+
+		i := strings.IndexAny(line, "=:")
+		if i < 0 {
+			return nil, fmt.Errorf("Expected key = value: %s", line)
+		}
+		if s == nil {
+			return nil, fmt.Errorf("Key outside of a schema section: %s", line)
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		switch key {
+		case "pattern":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("Schema %s has an invalid pattern: %s", s.Name, err)
+			}
+			s.Pattern = re
+		case "match-all":
+			matchAll = strings.EqualFold(value, "true")
+		case "retentions":
+			s.Retentions = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := check(); err != nil {
+		return nil, err
+	}
+	if len(schemas) == 0 {
+		return nil, fmt.Errorf("No schemas found")
+	}
+	return schemas, nil
+}
+
+// MatchSchema returns the first of the schemas that applies to the metric,
+// as carbon chooses them, or nil if none does.
+func MatchSchema(schemas []*StorageSchema, metric string) *StorageSchema {
+	for _, s := range schemas {
+		if s.Matches(metric) {
+			return s
+		}
+	}
+	return nil
+}
+
+// AnnotateSchemas returns a map of metric => SchemaLocation for the map of
+// metric => host returned by LocateSliceMetrics().  The number of metrics
+// no schema matches is logged.
+func AnnotateSchemas(list map[string]string, schemas []*StorageSchema) map[string]SchemaLocation {
+	result := make(map[string]SchemaLocation, len(list))
+	unmatched := 0
+	for m, host := range list {
+		loc := SchemaLocation{Host: host}
+		if s := MatchSchema(schemas, m); s != nil {
+			loc.Schema, loc.Retentions = s.Name, s.Retentions
+		} else {
+			unmatched++
+		}
+		result[m] = loc
+	}
+	if unmatched > 0 {
+		log.Printf("Warning: %d metrics match no storage schema", unmatched)
+	}
+	return result
+}
+
+// writeSchemaLocations writes the map of metric => SchemaLocation to w in
+// the form "metric => host retentions", ordered as sortedLocations() orders
+// them by --sort-by.  JSON or YAML is written if JSONOutput or YAMLOutput is
+// set.
+func writeSchemaLocations(w io.Writer, list map[string]SchemaLocation, by string) error {
+	if JSONOutput {
+		return WriteJSON(w, list)
+	}
+	if YAMLOutput {
+		return WriteYAML(w, list)
+	}
+
+	hosts := make(map[string]string, len(list))
+	for m, loc := range list {
+		hosts[m] = loc.Host
+	}
+	for _, m := range sortedLocations(hosts, by) {
+		retentions := list[m].Retentions
+		if retentions == "" {
+			retentions = "(no schema)"
+		}
+		if _, err := fmt.Fprintf(w, "%s => %s %s\n", m, list[m].Host, retentions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
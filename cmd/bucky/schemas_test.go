@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testSchemas = `# Schema definitions for Whisper files.
+[carbon]
+pattern = ^carbon\.
+retentions = 60:90d
+
+[servers]
+pattern: ^servers\.
+retentions: 10s:7d,1m:30d
+
+[servers_cpu]
+pattern = ^servers\..*\.cpu\.
+retentions = 1s:1d
+
+[default]
+match-all = true
+retentions = 60s:1y
+`
+
+func TestParseStorageSchemas(t *testing.T) {
+	schemas, err := parseStorageSchemas(strings.NewReader(testSchemas))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schemas) != 4 {
+		t.Fatalf("parseStorageSchemas found %d schemas, rather than 4", len(schemas))
+	}
+
+	data := map[string]string{
+		"carbon.agents.foo.cpuUsage": "carbon",
+		// The first match wins
+		"servers.graphite010.cpu.user": "servers",
+		"collectd.graphite010.load":    "default",
+	}
+	for m, name := range data {
+		if s := MatchSchema(schemas, m); s == nil || s.Name != name {
+			t.Errorf("MatchSchema(%q) returned %v, rather than %s", m, s, name)
+		}
+	}
+
+	for _, conf := range []string{
+		"[nopattern]\nretentions = 60:90d\n",
+		"[noretentions]\npattern = .*\n",
+		"pattern = .*\n",
+		"",
+	} {
+		if _, err := parseStorageSchemas(strings.NewReader(conf)); err == nil {
+			t.Errorf("parseStorageSchemas accepted %q", conf)
+		}
+	}
+}
+
+func TestWriteSchemaLocations(t *testing.T) {
+	schemas, err := parseStorageSchemas(strings.NewReader(testSchemas[:strings.Index(testSchemas, "[default]")]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := AnnotateSchemas(map[string]string{
+		"servers.graphite010.load": "graphite011",
+		"collectd.graphite010":     "graphite010",
+	}, schemas)
+
+	var buf bytes.Buffer
+	if err := writeSchemaLocations(&buf, list, "metric"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "collectd.graphite010 => graphite010 (no schema)\n" +
+		"servers.graphite010.load => graphite011 10s:7d,1m:30d\n"
+	if buf.String() != expected {
+		t.Errorf("writeSchemaLocations wrote %q, rather than %q", buf.String(), expected)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+// selftestKeys is the number of synthetic keys hashed.
+var selftestKeys int
+
+// selftestMaxStddev is the relative standard deviation, in percent, of the
+// per node counts above which the distribution is flagged.
+var selftestMaxStddev float64
+
+// Distribution describes how evenly a set of keys is spread over the Nodes
+// of a hash ring compared to a uniform distribution.
+type Distribution struct {
+	// Keys is the number of keys hashed
+	Keys int `json:"keys"`
+
+	// Counts is the number of keys placed on each Node
+	Counts map[string]int `json:"counts"`
+
+	// Expected is the number of keys each Node would hold if the keys
+	// were uniformly distributed
+	Expected float64 `json:"expected"`
+
+	// Stddev is the standard deviation of the counts as a percentage of
+	// Expected
+	Stddev float64 `json:"stddev"`
+
+	// ChiSquare is Pearson's chi-square statistic of the counts against
+	// the uniform distribution
+	ChiSquare float64 `json:"chi_square"`
+}
+
+func init() {
+	usage := "[options]"
+	short := "Check that the hash ring distributes keys uniformly."
+	long := `Hash --keys synthetic metric keys against the cluster's hash ring and
+report how evenly they are spread over the nodes of the ring.  Each node is
+expected to hold an equal share of the keys.  We report the count for each
+node, the standard deviation of the counts as a percentage of the expected
+count, and the chi-square statistic against the uniform distribution.
+
+This catches a broken hash function or a ring that has lost virtual nodes
+and distributes metrics unevenly.  We exit non-zero if the relative
+standard deviation exceeds --max-stddev percent.
+
+Use -j for JSON output.  Use -s to query the hash ring only on the host given
+by -h or in the BUCKYHOST environment variable.  Use --ring-file to test the
+hash ring in a ring file rather than the cluster.`
+
+	c := NewCommand(selftestCommand, "selftest", usage, short, long)
+	SetupCommon(c)
+	SetupHostname(c)
+	SetupSingle(c)
+	SetupJSON(c)
+	SetupRingFile(c)
+
+	c.Flag.IntVar(&selftestKeys, "keys", 100000,
+		"Number of synthetic keys to hash.")
+	c.Flag.Float64Var(&selftestMaxStddev, "max-stddev", 15,
+		"Flag the ring if the relative standard deviation exceeds this percentage.")
+}
+
+// NewDistribution hashes keys synthetic metric keys against the given hash
+// ring and returns their Distribution over its Nodes.
+func NewDistribution(hr hashing.HashRing, keys int) *Distribution {
+	d := &Distribution{
+		Keys:   keys,
+		Counts: make(map[string]int),
+	}
+	for _, n := range hr.Nodes() {
+		d.Counts[n.String()] = 0
+	}
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("bucky.selftest.host%04d.metric%d", i%1000, i)
+		d.Counts[hr.GetNode(key).String()]++
+	}
+	if len(d.Counts) == 0 {
+		return d
+	}
+
+	d.Expected = float64(keys) / float64(len(d.Counts))
+	variance := 0.0
+	for _, c := range d.Counts {
+		diff := float64(c) - d.Expected
+		variance += diff * diff
+		d.ChiSquare += diff * diff / d.Expected
+	}
+	variance /= float64(len(d.Counts))
+	d.Stddev = 100 * math.Sqrt(variance) / d.Expected
+
+	return d
+}
+
+// selftestCommand runs this subcommand.
+func selftestCommand(c Command) int {
+	if selftestKeys <= 0 {
+		log.Print("--keys must be positive.")
+		return 1
+	}
+
+	_, err := GetClusterConfig(HostPort)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if !Cluster.Healthy {
+		log.Printf("Warning: Cluster is not healthy!")
+	}
+
+	d := NewDistribution(Cluster.Hash, selftestKeys)
+	if JSONOutput {
+		err = WriteJSON(os.Stdout, d)
+		if err != nil {
+			log.Printf("Error encoding JSON output: %s", err)
+			return 1
+		}
+	} else {
+		for _, n := range sortedHosts(d.Counts) {
+			fmt.Printf("%s: %d\n", n, d.Counts[n])
+		}
+		fmt.Printf("Keys: %d\n", d.Keys)
+		fmt.Printf("Expected per node: %.2f\n", d.Expected)
+		fmt.Printf("Standard deviation: %.2f%%\n", d.Stddev)
+		fmt.Printf("Chi-square: %.2f with %d degrees of freedom\n",
+			d.ChiSquare, len(d.Counts)-1)
+	}
+
+	if d.Stddev > selftestMaxStddev {
+		log.Printf("Distribution is uneven: standard deviation %.2f%% exceeds %.2f%%",
+			d.Stddev, selftestMaxStddev)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestNewDistribution(t *testing.T) {
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		// fnv1a places instances by name alone so they must be unique
+		ring := makeTestRing(algo, 8)
+		for i := range ring.Nodes {
+			ring.Nodes[i].Instance = fmt.Sprintf("%s-%s", ring.Nodes[i].Server, ring.Nodes[i].Instance)
+		}
+		hr, err := buildHashRing([]*hashing.JSONRingType{ring})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := NewDistribution(hr, 50000)
+		if len(d.Counts) != hr.Len() {
+			t.Errorf("%s: Distribution counted %d nodes, rather than %d",
+				algo, len(d.Counts), hr.Len())
+		}
+		total := 0
+		for _, c := range d.Counts {
+			total += c
+		}
+		if total != 50000 || d.Expected != 50000/float64(hr.Len()) {
+			t.Errorf("%s: Distribution placed %d keys expecting %.2f per node",
+				algo, total, d.Expected)
+		}
+		if d.Stddev > 15 {
+			t.Errorf("%s: Distribution standard deviation %.2f%% exceeds 15%%",
+				algo, d.Stddev)
+		}
+	}
+}
@@ -39,7 +39,7 @@ func serversCommand(c Command) int {
 	}
 	fmt.Printf("\nIs cluster healthy: %v\n", Cluster.Healthy)
 	if !Cluster.Healthy {
-		log.Printf("Cluster is inconsistent.")
+		log.Printf("Cluster is inconsistent:\n%s", Cluster.HealthReport())
 		return 1
 	}
 
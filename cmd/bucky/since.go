@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+import . "github.com/jjneely/buckytools/metrics"
+
+// sinceWindow limits results to metrics modified within this long.  Zero
+// disables the filter.
+var sinceWindow time.Duration
+
+// sinceIncludeMissing keeps metrics that could not be stat'd when
+// filtering with --since.
+var sinceIncludeMissing bool
+
+// SetupSince installs the --since and --include-missing flags in the given
+// Command.
+func SetupSince(c Command) {
+	c.Flag.DurationVar(&sinceWindow, "since", 0,
+		"Only include metrics modified within this duration, such as 24h.")
+	c.Flag.BoolVar(&sinceIncludeMissing, "include-missing", false,
+		"With --since, include metrics that do not exist yet.")
+}
+
+// statEach stats each metric in the map of server => metrics using
+// metricWorkers workers and calls f with the server, metric, and result of
+// each metric that could be stat'd.  Calls to f are made from a single
+// goroutine.  Errors, including metrics that don't exist, are logged.
+func statEach(metricMap map[string][]string, f func(server, metric string, stat *MetricData)) {
+	type result struct {
+		work *DeleteWork
+		stat *MetricData
+	}
+
+	wg := new(sync.WaitGroup)
+	workIn := make(chan *DeleteWork, 25)
+	workOut := make(chan result, 25)
+	wg.Add(metricWorkers)
+	for i := 0; i < metricWorkers; i++ {
+		go func() {
+			for work := range workIn {
+				stat, err := StatRemoteMetric(work.server, work.name)
+				if err == nil {
+					workOut <- result{work, stat}
+				}
+			}
+			wg.Done()
+		}()
+	}
+
+	done := make(chan bool)
+	go func() {
+		for r := range workOut {
+			f(r.work.server, r.work.name, r.stat)
+		}
+		done <- true
+	}()
+
+	for server, metrics := range metricMap {
+		for _, m := range metrics {
+			workIn <- &DeleteWork{server, m}
+		}
+	}
+	close(workIn)
+	wg.Wait()
+	close(workOut)
+	<-done
+}
+
+// statModTimes stats each metric in the map of server => metrics and
+// returns a map of metric => the latest modification time found on any
+// server.  Metrics that could not be stat'd are not included.
+func statModTimes(metricMap map[string][]string) map[string]int64 {
+	result := make(map[string]int64)
+	statEach(metricMap, func(server, metric string, stat *MetricData) {
+		if stat.ModTime > result[metric] {
+			result[metric] = stat.ModTime
+		}
+	})
+
+	return result
+}
+
+// FilterSince returns the set of metrics in the map of server => metrics
+// that were modified within the --since window on any server.  Metrics
+// that do not exist on any server are included if --include-missing is
+// set.
+func FilterSince(metricMap map[string][]string) map[string]bool {
+	modTimes := statModTimes(metricMap)
+	cutoff := time.Now().Add(-sinceWindow).Unix()
+
+	result := make(map[string]bool)
+	for _, metrics := range metricMap {
+		for _, m := range metrics {
+			t, ok := modTimes[m]
+			if (ok && t >= cutoff) || (!ok && sinceIncludeMissing) {
+				result[m] = true
+			}
+		}
+	}
+	log.Printf("%d metrics kept by --since %s", len(result), sinceWindow)
+
+	return result
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// RingAsOf is the date given to --as-of.  When --ring-file is a directory
+// of ring file snapshots the snapshot in effect on this date is used.
+var RingAsOf string
+
+// snapshotDate matches the date in a snapshot file name such as
+// ring-2024-03-01.json.
+var snapshotDate = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// ringSnapshot is a ring file in a snapshot directory and the time it
+// took effect.
+type ringSnapshot struct {
+	Path string
+	Time time.Time
+}
+
+// parseAsOf parses an --as-of date given as YYYY-MM-DD or an RFC3339 time.
+// A bare date refers to the end of that day so that any snapshot taken
+// on the day is in effect.
+func parseAsOf(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return t, fmt.Errorf("Invalid --as-of date %q, expected YYYY-MM-DD or RFC3339", s)
+	}
+	return t.Add(24*time.Hour - time.Nanosecond), nil
+}
+
+// snapshotTime returns the time the ring file at path took effect.  The
+// date in the file name is used if there is one, otherwise the file's
+// generated_at time.
+func snapshotTime(path string) (time.Time, error) {
+	if d := snapshotDate.FindString(filepath.Base(path)); d != "" {
+		if t, err := time.Parse("2006-01-02", d); err == nil {
+			return t, nil
+		}
+	}
+
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	rf := new(RingFileType)
+	if err := json.Unmarshal(blob, rf); err != nil || rf.GeneratedAt == "" {
+		return time.Time{}, fmt.Errorf("No date in file name or generated_at")
+	}
+	return time.Parse(time.RFC3339, rf.GeneratedAt)
+}
+
+// readSnapshots returns the dated ring files in dir sorted by the time
+// they took effect.  Files without a date are skipped with a warning.
+func readSnapshots(dir string) ([]ringSnapshot, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]ringSnapshot, 0, len(entries))
+	for _, e := range entries {
+		if !e.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		t, err := snapshotTime(path)
+		if err != nil {
+			log.Printf("Warning: Skipping ring snapshot %s: %s", path, err)
+			continue
+		}
+		snapshots = append(snapshots, ringSnapshot{path, t})
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+
+	return snapshots, nil
+}
+
+// SelectRingSnapshot returns the path of the ring file in the snapshot
+// directory dir that was in effect at asOf, which is the latest snapshot
+// taken at or before that time.  An empty asOf selects the latest
+// snapshot.
+func SelectRingSnapshot(dir, asOf string) (string, error) {
+	snapshots, err := readSnapshots(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(snapshots) == 0 {
+		return "", fmt.Errorf("No dated ring snapshots found in %s", dir)
+	}
+	if asOf == "" {
+		return snapshots[len(snapshots)-1].Path, nil
+	}
+
+	t, err := parseAsOf(asOf)
+	if err != nil {
+		return "", err
+	}
+	i := sort.Search(len(snapshots), func(i int) bool {
+		return snapshots[i].Time.After(t)
+	})
+	if i == 0 {
+		return "", fmt.Errorf("No ring snapshot in %s is as old as %s", dir, asOf)
+	}
+	return snapshots[i-1].Path, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelectRingSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ring-2024-01-15.json": `[]`,
+		"ring-2024-03-01.json": `[]`,
+		"nightly.json":         `{"generated_at": "2024-02-10T04:00:00Z", "rings": []}`,
+		"README":               `not a ring file`,
+	}
+	for name, body := range files {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		asOf, want string
+	}{
+		{"", "ring-2024-03-01.json"},
+		{"2024-01-15", "ring-2024-01-15.json"},
+		{"2024-02-10", "nightly.json"},
+		{"2024-02-10T03:00:00Z", "ring-2024-01-15.json"},
+		{"2024-02-29", "nightly.json"},
+		{"2024-03-01", "ring-2024-03-01.json"},
+		{"2025-01-01", "ring-2024-03-01.json"},
+	}
+	for _, tc := range tests {
+		path, err := SelectRingSnapshot(dir, tc.asOf)
+		if err != nil {
+			t.Errorf("As of %q returned an error: %s", tc.asOf, err)
+			continue
+		}
+		if filepath.Base(path) != tc.want {
+			t.Errorf("As of %q selected %s, expected %s", tc.asOf, path, tc.want)
+		}
+	}
+
+	if _, err := SelectRingSnapshot(dir, "2023-12-31"); err == nil {
+		t.Errorf("Expected an error for a date before every snapshot")
+	}
+	if _, err := SelectRingSnapshot(dir, "March 1st"); err == nil {
+		t.Errorf("Expected an error for an invalid date")
+	}
+}
+
+func TestReadRingFileAsOf(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ring-2024-01-15.json")
+	ring := `[{"name": "a", "algo": "carbon", "replicas": 1, "nodes": [{"server": "graphite010", "port": 2003, "instance": "a"}]}]`
+	if err := ioutil.WriteFile(path, []byte(ring), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { RingAsOf = "" }()
+	RingAsOf = "2024-01-15"
+	if _, err := ReadRingFile(path); err == nil {
+		t.Errorf("--as-of was ignored with a ring file that is not a directory")
+	}
+	if rings, err := ReadRingFile(dir); err != nil || len(rings) != 1 {
+		t.Errorf("Reading the directory as of %s returned %v, %v", RingAsOf, rings, err)
+	}
+
+	RingAsOf = ""
+	if rings, err := ReadRingFile(path); err != nil || len(rings) != 1 {
+		t.Errorf("Reading %s returned %v, %v", path, rings, err)
+	}
+}
@@ -1,10 +1,8 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"sync"
@@ -20,7 +18,7 @@ func init() {
 
 The default mode is to work with lists.  The arguments are a series of one or
 more metric key names.  If the first argument is a "-" then read a JSON array
-from STDIN as our list of metrics.
+or a newline separated list from STDIN as our list of metrics.
 
 Use -r to enable regular expression mode.  The first argument is a regular
 expression.  If metrics names match they will be included in the output.
@@ -127,13 +125,9 @@ func StatSliceMetrics(servers []string, metrics []string, force bool) error {
 }
 
 func StatJSONMetrics(servers []string, fd io.Reader, force bool) error {
-	// Read the JSON from the file-like object
-	blob, err := ioutil.ReadAll(fd)
-	metrics := make([]string, 0)
-
-	err = json.Unmarshal(blob, &metrics)
+	metrics, err := readMetrics(fd, 0, 0)
 	if err != nil {
-		log.Printf("Error unmarshalling JSON data: %s", err)
+		log.Printf("Error reading metrics: %s", err)
 		return err
 	}
 
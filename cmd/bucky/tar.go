@@ -2,10 +2,8 @@ package main
 
 import (
 	"archive/tar"
-	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"sort"
@@ -31,7 +29,7 @@ func init() {
 
 The default mode is to work with lists.  The arguments are a series of one or
 more metric key names.  If the first argument is a "-" then read a JSON array
-from STDIN as our list of metrics.
+or a newline separated list from STDIN as our list of metrics.
 
 Use -r to enable regular expression mode.  The first argument is a regular
 expression.  If metrics names match they will be included in the output.
@@ -42,6 +40,12 @@ BUCKYSERVER environment variable.
 Set -w to change the number of worker threads used to download the Whisper
 DBs from the remote servers.
 
+Use --manifest to write a JSON manifest of the archive to the given file.  It
+is an array with the stat of each Whisper DB written, as the buckyd daemon
+reports it, where Name is the metric, together with the SHA-256 checksum of
+its data.  Give the manifest to restore --manifest to verify the archive is
+complete and intact before anything is restored.
+
 The tar archive is written to STDOUT and will not be written to a
 terminal.`
 
@@ -59,9 +63,13 @@ terminal.`
 		"Downloader threads.")
 	c.Flag.IntVar(&metricWorkers, "workers", 5,
 		"Downloader threads.")
+	c.Flag.StringVar(&manifestFile, "manifest", "",
+		"Write a JSON manifest of the archive to this file.")
 }
 
-func writeTar(workOut chan *metrics.MetricData, wg *sync.WaitGroup) {
+// writeTar writes each metric received to the tar archive on STDOUT.  If
+// manifest is non-nil the manifest entry of each is appended to it.
+func writeTar(workOut chan *metrics.MetricData, manifest *[]*metrics.MetricData, wg *sync.WaitGroup) {
 	tw := tar.NewWriter(os.Stdout)
 	for work := range workOut {
 		if Verbose {
@@ -86,6 +94,9 @@ func writeTar(workOut chan *metrics.MetricData, wg *sync.WaitGroup) {
 		if err != nil {
 			log.Fatalf("Error writing data to tar file: %s", err)
 		}
+		if manifest != nil {
+			*manifest = append(*manifest, manifestEntry(work, data))
+		}
 	}
 
 	err := tw.Close()
@@ -139,8 +150,12 @@ func multiplexTar(metricMap map[string][]string) error {
 	log.Printf("Total metrics selected for tar: %d", len(sorted))
 
 	// Start writers and workers
+	var manifest *[]*metrics.MetricData
+	if manifestFile != "" {
+		manifest = &[]*metrics.MetricData{}
+	}
 	wgTar.Add(1)
-	go writeTar(workOut, wgTar)
+	go writeTar(workOut, manifest, wgTar)
 
 	wgWork.Add(metricWorkers)
 	for i := 0; i < metricWorkers; i++ {
@@ -180,6 +195,13 @@ func multiplexTar(metricMap map[string][]string) error {
 	wgTar.Wait() // Wait for tar writer to complete
 
 	log.Printf("Archive complete.")
+	if manifest != nil {
+		if err := WriteManifest(manifestFile, *manifest); err != nil {
+			log.Printf("Error writing manifest %s: %s", manifestFile, err)
+			return err
+		}
+		log.Printf("Wrote manifest of %d metrics to %s", len(*manifest), manifestFile)
+	}
 	if workerErrors {
 		return fmt.Errorf("Errors building tar file are present.")
 	}
@@ -205,15 +227,9 @@ func TarSliceMetrics(servers []string, metrics []string, force bool) error {
 }
 
 func TarJSONMetrics(servers []string, fd io.Reader, force bool) error {
-	// Read the JSON from the file-like object
-	blob, err := ioutil.ReadAll(fd)
-	metrics := make([]string, 0)
-
-	err = json.Unmarshal(blob, &metrics)
-	// We could just package this up and query the server, but lets check the
-	// JSON is valid first.
+	metrics, err := readMetrics(fd, 0, 0)
 	if err != nil {
-		log.Printf("Error unmarshalling JSON data: %s", err)
+		log.Printf("Error reading metrics: %s", err)
 		return err
 	}
 
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strings"
+)
+
+// VerifiedLocation records where the hash ring places a metric and the
+// servers the metric was actually found on.
+type VerifiedLocation struct {
+	// Expected is the host the hash ring places the metric on
+	Expected string `json:"expected"`
+
+	// Found are the servers the metric is stored on, sorted
+	Found []string `json:"found"`
+
+	// server is the server part of the expected Node
+	server string
+}
+
+// Misplaced returns true if the metric was not found only on the server
+// the hash ring expects.
+func (v *VerifiedLocation) Misplaced() bool {
+	return len(v.Found) != 1 || v.Found[0] != v.server
+}
+
+// VerifiedMetric is a VerifiedLocation with its metric name as streamed
+// by --verify --stream with -j.
+type VerifiedMetric struct {
+	Metric string `json:"metric"`
+	*VerifiedLocation
+}
+
+// verifyBatchSize is the number of metrics verified at a time when
+// streaming results.
+const verifyBatchSize = 1000
+
+// VerifyMetrics queries each server in the cluster for the metrics in the
+// map of metric => expected host and returns a map of metric =>
+// VerifiedLocation.
+func VerifyMetrics(list map[string]string) (map[string]*VerifiedLocation, error) {
+	result, err := verifyLocations(list)
+	if err != nil {
+		return nil, err
+	}
+	logMisplaced(countMisplaced(result), len(result))
+	return result, nil
+}
+
+// StreamVerifyMetrics verifies the metrics in the map of metric =>
+// expected host in batches of verifyBatchSize using metricWorkers worker
+// threads.  The VerifiedLocations of each batch are passed to emit as the
+// batch completes, so batches arrive in no particular order.  Emit is
+// only ever called from the calling goroutine.  We stop at the first
+// error from a batch or from emit.
+func StreamVerifyMetrics(list map[string]string, emit func(map[string]*VerifiedLocation) error) error {
+	metrics := make([]string, 0, len(list))
+	for m := range list {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+
+	type result struct {
+		verified map[string]*VerifiedLocation
+		err      error
+	}
+	batches := make(chan map[string]string)
+	results := make(chan result)
+	done := make(chan struct{})
+	defer close(done)
+
+	workers := metricWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for b := range batches {
+				v, err := verifyLocations(b)
+				select {
+				case results <- result{v, err}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	count := (len(metrics) + verifyBatchSize - 1) / verifyBatchSize
+	go func() {
+		defer close(batches)
+		for i := 0; i < len(metrics); i += verifyBatchSize {
+			end := i + verifyBatchSize
+			if end > len(metrics) {
+				end = len(metrics)
+			}
+			b := make(map[string]string, verifyBatchSize)
+			for _, m := range metrics[i:end] {
+				b[m] = list[m]
+			}
+			select {
+			case batches <- b:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	misplaced := 0
+	for i := 0; i < count; i++ {
+		r := <-results
+		if r.err != nil {
+			return r.err
+		}
+		misplaced += countMisplaced(r.verified)
+		if err := emit(r.verified); err != nil {
+			return err
+		}
+	}
+	logMisplaced(misplaced, len(metrics))
+	return nil
+}
+
+// verifyLocations does the work of VerifyMetrics without logging.
+func verifyLocations(list map[string]string) (map[string]*VerifiedLocation, error) {
+	metrics := make([]string, 0, len(list))
+	result := make(map[string]*VerifiedLocation, len(list))
+	for m, host := range list {
+		metrics = append(metrics, m)
+		result[m] = &VerifiedLocation{
+			Expected: host,
+			Found:    make([]string, 0),
+			server:   Cluster.Hash.GetNode(locateKey(m)).Server,
+		}
+	}
+
+	found, err := ListSliceMetrics(Cluster.HostPorts(), metrics, false)
+	if err != nil {
+		return nil, err
+	}
+	for hostport, ms := range found {
+		server, _, err := net.SplitHostPort(hostport)
+		if err != nil {
+			server = hostport
+		}
+		for _, m := range ms {
+			if v, ok := result[m]; ok {
+				v.Found = append(v.Found, server)
+			}
+		}
+	}
+
+	for _, v := range result {
+		sort.Strings(v.Found)
+	}
+
+	return result, nil
+}
+
+// countMisplaced returns the number of misplaced verified locations.
+func countMisplaced(verified map[string]*VerifiedLocation) int {
+	misplaced := 0
+	for _, v := range verified {
+		if v.Misplaced() {
+			misplaced++
+		}
+	}
+	return misplaced
+}
+
+// logMisplaced logs the number of misplaced metrics of the total.
+func logMisplaced(misplaced, total int) {
+	log.Printf("%d of %d metrics are not stored only on their ring host",
+		misplaced, total)
+}
+
+// filterVerifiedSince removes the verified locations of metrics that were
+// not modified within the --since window.  Metrics are stat'd on each
+// server they were found on, or their ring host if not found.
+func filterVerifiedSince(verified map[string]*VerifiedLocation) {
+	metricMap := make(map[string][]string)
+	for m, v := range verified {
+		servers := v.Found
+		if len(servers) == 0 {
+			servers = []string{v.server}
+		}
+		for _, s := range servers {
+			hostport := net.JoinHostPort(s, Cluster.Port)
+			metricMap[hostport] = append(metricMap[hostport], m)
+		}
+	}
+
+	keep := FilterSince(metricMap)
+	for m := range verified {
+		if !keep[m] {
+			delete(verified, m)
+		}
+	}
+}
+
+// writeVerifiedStream writes a batch of verified locations to w sorted by
+// metric.  Text is as for writeVerified() and with JSONOutput set each
+// metric is written as a VerifiedMetric JSON object on its own line.
+func writeVerifiedStream(w io.Writer, verified map[string]*VerifiedLocation) error {
+	metrics := make([]string, 0, len(verified))
+	for m := range verified {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+
+	for _, m := range metrics {
+		var err error
+		if JSONOutput {
+			err = json.NewEncoder(w).Encode(VerifiedMetric{m, verified[m]})
+		} else {
+			err = writeVerified(w, map[string]*VerifiedLocation{m: verified[m]})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeVerified writes the verified locations to w.  Metrics stored only
+// on their ring host are written as "metric => host".  Otherwise we write
+// "metric => host (found on actualhost)" or "metric => host (not found)",
+// sorted by metric.  JSON is written if JSONOutput is set.
+func writeVerified(w io.Writer, verified map[string]*VerifiedLocation) error {
+	if JSONOutput {
+		return WriteJSON(w, verified)
+	}
+
+	metrics := make([]string, 0, len(verified))
+	for m := range verified {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+	for _, m := range metrics {
+		v := verified[m]
+		switch {
+		case len(v.Found) == 0:
+			fmt.Fprintf(w, "%s => %s (not found)\n", m, v.Expected)
+		case v.Misplaced():
+			fmt.Fprintf(w, "%s => %s (found on %s)\n", m, v.Expected,
+				strings.Join(v.Found, ", "))
+		default:
+			fmt.Fprintf(w, "%s => %s\n", m, v.Expected)
+		}
+	}
+	return nil
+}
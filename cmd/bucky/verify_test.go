@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+import "github.com/jjneely/buckytools/hashing"
+
+func TestWriteVerified(t *testing.T) {
+	data := map[string]*VerifiedLocation{
+		"foo.bar": {"graphite010", []string{"graphite010"}, "graphite010"},
+		"foo.baz": {"graphite010:a", []string{"graphite011"}, "graphite010"},
+		"foo.qux": {"graphite011", []string{}, "graphite011"},
+	}
+	expected := map[string]string{
+		"foo.bar": "foo.bar => graphite010\n",
+		"foo.baz": "foo.baz => graphite010:a (found on graphite011)\n",
+		"foo.qux": "foo.qux => graphite011 (not found)\n",
+	}
+
+	for m, v := range data {
+		buf := new(bytes.Buffer)
+		writeVerified(buf, map[string]*VerifiedLocation{m: v})
+		if buf.String() != expected[m] {
+			t.Errorf("writeVerified wrote %q, rather than %q", buf.String(), expected[m])
+		}
+	}
+}
+
+func TestWriteVerifiedJSON(t *testing.T) {
+	data := map[string]*VerifiedLocation{
+		"foo.bar": {"graphite010", []string{"graphite010"}, "graphite010"},
+	}
+	expected := map[bool]string{
+		false: `{"foo.bar":{"expected":"graphite010","found":["graphite010"]}}` + "\n",
+		true: `{
+  "foo.bar": {
+    "expected": "graphite010",
+    "found": [
+      "graphite010"
+    ]
+  }
+}
+`,
+	}
+
+	JSONOutput = true
+	defer func() { JSONOutput, JSONIndent = false, false }()
+	for _, indent := range []bool{false, true} {
+		JSONIndent = indent
+		buf := new(bytes.Buffer)
+		writeVerified(buf, data)
+		if buf.String() != expected[indent] {
+			t.Errorf("writeVerified with indent %t wrote %q, rather than %q",
+				indent, buf.String(), expected[indent])
+		}
+	}
+}
+
+func TestStreamVerifyMetrics(t *testing.T) {
+	stored := make([]string, 0)
+	list := make(map[string]string)
+	for i := 0; i < 2500; i++ {
+		m := fmt.Sprintf("foo.bar.metric%04d", i)
+		list[m] = "127.0.0.1"
+		if i%2 == 0 {
+			stored = append(stored, m)
+		}
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(stored)
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	_, port, _ := net.SplitHostPort(u.Host)
+	ring := &hashing.JSONRingType{
+		Name:     "127.0.0.1",
+		Algo:     "carbon",
+		Replicas: 1,
+		Nodes:    []hashing.Node{hashing.NewNode("127.0.0.1", 2004, "")},
+	}
+	c, err := NewClusterConfig(port, []*hashing.JSONRingType{ring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Healthy = true
+	Cluster = c
+	defer func() { Cluster = nil }()
+
+	batches := 0
+	total := 0
+	found := 0
+	err = StreamVerifyMetrics(list, func(batch map[string]*VerifiedLocation) error {
+		batches++
+		total += len(batch)
+		for _, v := range batch {
+			if !v.Misplaced() {
+				found++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batches != 3 || total != len(list) || found != len(stored) {
+		t.Errorf("StreamVerifyMetrics() emitted %d batches of %d metrics with %d found",
+			batches, total, found)
+	}
+
+	stop := errors.New("stop")
+	err = StreamVerifyMetrics(list, func(batch map[string]*VerifiedLocation) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("StreamVerifyMetrics() returned %v rather than the emit error", err)
+	}
+}
+
+func TestWriteVerifiedStream(t *testing.T) {
+	data := map[string]*VerifiedLocation{
+		"foo.baz": {"graphite010", []string{}, "graphite010"},
+		"foo.bar": {"graphite010", []string{"graphite010"}, "graphite010"},
+	}
+	expected := `{"metric":"foo.bar","expected":"graphite010","found":["graphite010"]}
+{"metric":"foo.baz","expected":"graphite010","found":[]}
+`
+
+	JSONOutput = true
+	defer func() { JSONOutput = false }()
+	buf := new(bytes.Buffer)
+	if err := writeVerifiedStream(buf, data); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("writeVerifiedStream wrote %q, rather than %q", buf.String(), expected)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// YAMLOutput is set by --yaml to write results as a YAML document.
+var YAMLOutput bool
+
+// SetupYAML installs the --yaml flag.  It is an alternative to -j for the
+// commands that support it and is mutually exclusive with it.
+func SetupYAML(c Command) {
+	c.Flag.BoolVar(&YAMLOutput, "yaml", false,
+		"Instead of text output YAML encoded data.")
+}
+
+// WriteYAML writes v as a YAML document to w.  The value is first encoded
+// as JSON so that it is represented with the same field names and values
+// as with -j.  Maps are written in sorted key order and strings are quoted
+// whenever YAML might read them as anything else.
+func WriteYAML(w io.Writer, v interface{}) error {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(blob))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("---\n")
+	writeYAMLValue(buf, doc, 0)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// writeYAMLValue writes the JSON decoded value v at the given indentation
+// level.  Scalars and empty collections are written inline and end the
+// current line, otherwise a block is started on the next line.
+func writeYAMLValue(buf *bytes.Buffer, v interface{}, indent int) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if len(t) == 0 {
+			buf.WriteString("{}\n")
+			return
+		}
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf.WriteString(strings.Repeat("  ", indent))
+			buf.WriteString(yamlScalar(k))
+			buf.WriteString(":")
+			writeYAMLChild(buf, t[k], indent+1)
+		}
+	case []interface{}:
+		if len(t) == 0 {
+			buf.WriteString("[]\n")
+			return
+		}
+		for _, e := range t {
+			buf.WriteString(strings.Repeat("  ", indent))
+			buf.WriteString("-")
+			writeYAMLChild(buf, e, indent+1)
+		}
+	default:
+		buf.WriteString(yamlScalar(t))
+		buf.WriteString("\n")
+	}
+}
+
+// writeYAMLChild writes a map value or list element following its key or
+// "-" marker.  Non-empty collections go on the following lines.
+func writeYAMLChild(buf *bytes.Buffer, v interface{}, indent int) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if len(t) > 0 {
+			buf.WriteString("\n")
+			writeYAMLValue(buf, t, indent)
+			return
+		}
+	case []interface{}:
+		if len(t) > 0 {
+			buf.WriteString("\n")
+			writeYAMLValue(buf, t, indent)
+			return
+		}
+	}
+	buf.WriteString(" ")
+	writeYAMLValue(buf, v, indent)
+}
+
+// yamlScalar returns the YAML representation of a JSON decoded scalar.
+func yamlScalar(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(t)
+	case json.Number:
+		return t.String()
+	case string:
+		if yamlPlain(t) {
+			return t
+		}
+		// JSON strings are valid YAML double quoted strings
+		blob, _ := json.Marshal(t)
+		return string(blob)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// yamlPlain returns true if s can be written as a plain unquoted YAML
+// scalar and read back as the same string.  This is deliberately
+// conservative and covers metric names and host names.
+func yamlPlain(s string) bool {
+	if s == "" {
+		return false
+	}
+	switch strings.ToLower(s) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off", "y", "n":
+		return false
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return false
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("._/=;", r):
+		case i > 0 && strings.ContainsRune("-:+", r):
+		default:
+			return false
+		}
+	}
+	return !strings.HasSuffix(s, ":")
+}
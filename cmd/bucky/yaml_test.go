@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteYAML(t *testing.T) {
+	v := map[string]interface{}{
+		"foo.bar":  "graphite010",
+		"foo.baz":  NodeLocation{"graphite011", "a"},
+		"true":     "1.5",
+		"list":     []string{"a b", "c"},
+		"empty":    []string{},
+		"host:123": "-x",
+	}
+	expected := `---
+empty: []
+foo.bar: graphite010
+foo.baz:
+  instance: a
+  server: graphite011
+host:123: "-x"
+list:
+  - "a b"
+  - c
+"true": "1.5"
+`
+
+	buf := new(bytes.Buffer)
+	if err := WriteYAML(buf, v); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("WriteYAML() returned:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestYAMLPlain(t *testing.T) {
+	plain := []string{"foo.bar", "graphite010:a", "name;tag=value", "a-b_c"}
+	quoted := []string{"", "yes", "No", "~", "12", "1e3", "-x", "a: b", "a #b", "a:", "a b", "[x]"}
+	for _, s := range plain {
+		if !yamlPlain(s) {
+			t.Errorf("yamlPlain(%q) returned false", s)
+		}
+	}
+	for _, s := range quoted {
+		if yamlPlain(s) {
+			t.Errorf("yamlPlain(%q) returned true", s)
+		}
+	}
+}
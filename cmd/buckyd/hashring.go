@@ -20,7 +20,6 @@ func listHashring(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		log.Printf("Error marshalling data: %s", err)
 	} else {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(blob)
+		writeJSON(w, r, blob)
 	}
 }
@@ -32,7 +32,7 @@ func usage() {
 		"\tconsistent hashring as found in your carbon-relay configuration\n.",
 		"\tAll of the daemons in your cluster need to be able to build\n",
 		"\tthe same hashring.  You may specify nodes in the following\n",
-		"\tformat: HOST[:PORT][=INSTANCE]\n\n",
+		"\tformat: HOST[:PORT][=INSTANCE][:dc=DC]\n\n",
 	}
 
 	fmt.Printf(strings.Join(t, ""), os.Args[0], Version)
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
@@ -78,8 +79,7 @@ func listMetrics(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		log.Printf("Error marshaling data: %s", err)
 	} else {
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(blob)
+		writeJSON(w, r, blob)
 	}
 }
 
@@ -182,7 +182,8 @@ func deleteMetric(w http.ResponseWriter, path string, fatal bool) error {
 // healMetric will use the Whisper DB in the body of the request to
 // backfill the metric found at the given filesystem path.  If the metric
 // doesn't exist it will be created as an identical copy of the DB found
-// in the request.
+// in the request.  If the X-Metric-Stat header holds a Checksum the data
+// received is verified against it and rejected if truncated or corrupt.
 func healMetric(w http.ResponseWriter, r *http.Request, path string) {
 	var err error
 	var data io.Reader
@@ -254,6 +255,14 @@ func healMetric(w http.ResponseWriter, r *http.Request, path string) {
 			return
 		}
 
+		if stat.Checksum != "" {
+			if err := checkReceived(srcName, stat.Checksum); err != nil {
+				log.Printf("Error verifying whisper data for %s: %s", path, err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
 		// XXX: How can we check the tmpfile for sanity?
 		err = fill.All(srcName, path)
 		if err != nil {
@@ -294,7 +303,34 @@ func healMetric(w http.ResponseWriter, r *http.Request, path string) {
 			defer os.Remove(dst.Name()) // not concerned with errors here
 			return
 		}
+		if stat.Checksum != "" {
+			if err := checkReceived(dst.Name(), stat.Checksum); err != nil {
+				log.Printf("Error verifying whisper data for %s: %s", path, err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				defer os.Remove(dst.Name()) // not concerned with errors here
+				return
+			}
+		}
+	}
+}
+
+// checkReceived returns an error unless the Whisper DB written to the file
+// at path has the given MetricData checksum.
+func checkReceived(path, checksum string) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	sum, err := ReaderChecksum(fd)
+	if err != nil {
+		return err
+	}
+	if sum != checksum {
+		return fmt.Errorf("Checksum of whisper data written %s does not match %s", sum, checksum)
 	}
+	return nil
 }
 
 // serveMetric will serve a GET request for the metric that path
@@ -324,6 +360,17 @@ func serveMetric(w http.ResponseWriter, r *http.Request, path, metric string) {
 		return
 	}
 
+	// The client verifies the data it receives against the checksum
+	stat.Checksum, err = ReaderChecksum(fd)
+	if err == nil {
+		_, err = fd.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		log.Printf("Error reading metric file %s: %s", path, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	if r.Header.Get("accept-encoding") == "snappy" {
 		blob, err := copySnappy(fd)
 		if err != nil {
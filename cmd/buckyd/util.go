@@ -2,11 +2,13 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 )
 
 import "github.com/golang/snappy"
@@ -105,3 +107,26 @@ func unmarshalList(encoded string) ([]string, error) {
 
 	return data, nil
 }
+
+// gzipMinSize is the smallest response body worth compressing with gzip.
+const gzipMinSize = 1024
+
+// writeJSON sends the JSON encoded blob to the client.  Large responses
+// are gzip compressed if the client accepts it.
+func writeJSON(w http.ResponseWriter, r *http.Request, blob []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Add("Vary", "Accept-Encoding")
+	if len(blob) < gzipMinSize || !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Write(blob)
+		return
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(blob); err != nil {
+		log.Printf("Error writing gzip response: %s", err)
+	}
+	if err := gz.Close(); err != nil {
+		log.Printf("Error writing gzip response: %s", err)
+	}
+}
@@ -95,37 +95,51 @@ func printAnalysis(hr *hashing.CarbonHashRing) {
 	fmt.Printf("Deviation: %.4f\n", math.Sqrt(v))
 }
 
-func makeRing(config []string) *hashing.CarbonHashRing {
-	hr := hashing.NewCarbonHashRing()
-	for _, n := range config {
-		fields := strings.Split(n, ":")
-		if len(fields) == 1 {
-			fields = append(fields, "2003")
-			fields = append(fields, uuid.New())
-		} else if len(fields) == 2 {
-			_, err := strconv.Atoi(fields[1])
+// nodeFormats are the supported --node-format values.  Each names the
+// colon separated fields of a node in the hash ring configuration.
+var nodeFormats = []string{"server:instance", "server:port", "server:port:instance"}
+
+// parseNode parses a node from the hash ring configuration using the
+// given format.  Missing ports default to 2003 and missing instances are
+// given a random UUID.
+func parseNode(n, format string) (hashing.Node, error) {
+	fields := strings.Split(n, ":")
+	names := strings.Split(format, ":")
+	if len(fields) > len(names) {
+		return hashing.Node{}, fmt.Errorf("Node %q has more fields than %s", n, format)
+	}
+
+	server, port, instance := fields[0], uint64(2003), ""
+	for i, f := range fields[1:] {
+		switch names[i+1] {
+		case "port":
+			if f == "" {
+				continue
+			}
+			var err error
+			port, err = strconv.ParseUint(f, 10, 16)
 			if err != nil {
-				// assume instance
-				fields = append(fields, fields[1])
-				fields[1] = "2003"
-			} else {
-				fields = append(fields, uuid.New())
+				return hashing.Node{}, fmt.Errorf("Node %q has an invalid port: %s", n, err)
 			}
-		} else {
-			// 3 or more fields
-			fields = fields[:3]
-		}
-		if fields[1] == "" {
-			fields[1] = "2003"
+		case "instance":
+			instance = f
 		}
-		if fields[2] == "" {
-			fields[2] = uuid.New()
-		}
-		port, err := strconv.ParseUint(fields[1], 10, 16)
+	}
+	if instance == "" {
+		instance = uuid.New()
+	}
+
+	return hashing.NewNode(server, int(port), instance), nil
+}
+
+func makeRing(config []string, format string) *hashing.CarbonHashRing {
+	hr := hashing.NewCarbonHashRing()
+	for _, n := range config {
+		node, err := parseNode(n, format)
 		if err != nil {
-			port = 2003
+			log.Fatalf("Error: %s", err)
 		}
-		hr.AddNode(hashing.NewNode(fields[0], int(port), fields[2]))
+		hr.AddNode(node)
 	}
 
 	return hr
@@ -162,15 +176,22 @@ func main() {
 		"Print Hashring analysis of given configuration")
 	keys := flag.String("keys", "",
 		"Print analysis of key distribution using keys from the newline delimited file")
+	format := flag.String("node-format", "server:instance",
+		fmt.Sprintf("How to interpret nodes in the configuration: %v", nodeFormats))
 	flag.Parse()
 
+	i := sort.SearchStrings(nodeFormats, *format)
+	if i == len(nodeFormats) || nodeFormats[i] != *format {
+		log.Fatalf("Invalid node format.  Supported formats: %v", nodeFormats)
+	}
+
 	if flag.NArg() != 1 {
 		log.Fatalf("Filename containing hash ring configuration is required")
 	}
 
 	config := getConfig(flag.Arg(0))
 	if *analyze {
-		hr := makeRing(config)
+		hr := makeRing(config, *format)
 		printAnalysis(hr)
 		if *keys != "" {
 			printKeyAnalysis(hr, *keys)
@@ -180,7 +201,7 @@ func main() {
 
 	spread := *bestMax - *bestMin
 	for {
-		hr := makeRing(config)
+		hr := makeRing(config, *format)
 		buckets := hr.BucketsPerNode()
 
 		maximum := max(buckets)
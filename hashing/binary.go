@@ -0,0 +1,153 @@
+package hashing
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"fmt"
+)
+
+// ringBinaryVersion is the version of the binary hash ring format written
+// by MarshalBinary.  Other versions are refused.
+const ringBinaryVersion = 1
+
+// ringBinary is the gob encoded form of a built hash ring.  Points holds
+// the ring positions in ring order with the index into Nodes each belongs
+// to so that a ring is reloaded without rehashing or sorting.
+type ringBinary struct {
+	Version   int
+	Algo      string
+	Replicas  int
+	Nodes     []Node
+	Positions []int
+	Points    []int
+}
+
+// encodeRing returns the gob encoding of the given ring data.  The ring
+// entries are stored by position and index into nodes.
+func encodeRing(algo string, replicas int, nodes []Node, ring []RingEntry) ([]byte, error) {
+	b := ringBinary{
+		Version:   ringBinaryVersion,
+		Algo:      algo,
+		Replicas:  replicas,
+		Nodes:     nodes,
+		Positions: make([]int, 0, len(ring)),
+		Points:    make([]int, 0, len(ring)),
+	}
+	index := make(map[string]int, len(nodes))
+	for i, n := range nodes {
+		index[n.String()] = i
+	}
+	for _, e := range ring {
+		b.Positions = append(b.Positions, e.position)
+		b.Points = append(b.Points, index[e.node.String()])
+	}
+
+	buf := new(bytes.Buffer)
+	err := gob.NewEncoder(buf).Encode(b)
+	return buf.Bytes(), err
+}
+
+// decodeRing decodes data written by encodeRing for the given algorithm
+// and returns the ring data and its entries.
+func decodeRing(algo string, data []byte) (*ringBinary, []RingEntry, error) {
+	b := new(ringBinary)
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b.Version != ringBinaryVersion {
+		return nil, nil, fmt.Errorf("Unsupported hash ring version %d, expected %d",
+			b.Version, ringBinaryVersion)
+	}
+	if b.Algo != algo {
+		return nil, nil, fmt.Errorf("Hash ring algorithm %s does not match %s", b.Algo, algo)
+	}
+	if len(b.Positions) != len(b.Points) {
+		return nil, nil, fmt.Errorf("Corrupt hash ring: %d positions for %d points",
+			len(b.Positions), len(b.Points))
+	}
+
+	ring := make([]RingEntry, len(b.Points))
+	for i, p := range b.Points {
+		if p < 0 || p >= len(b.Nodes) {
+			return nil, nil, fmt.Errorf("Corrupt hash ring: no node %d", p)
+		}
+		ring[i] = RingEntry{b.Positions[i], b.Nodes[p]}
+	}
+	return b, ring, nil
+}
+
+// MarshalBinary encodes the built ring, including its ring positions, so
+// that it can be cached and reloaded with UnmarshalBinary or LoadHashRing.
+func (t *CarbonHashRing) MarshalBinary() ([]byte, error) {
+	return encodeRing("carbon", t.replicas, t.nodes, t.ring)
+}
+
+// UnmarshalBinary replaces the ring with one encoded by MarshalBinary.
+func (t *CarbonHashRing) UnmarshalBinary(data []byte) error {
+	b, ring, err := decodeRing("carbon", data)
+	if err != nil {
+		return err
+	}
+	t.replicas, t.nodes, t.ring = b.Replicas, b.Nodes, ring
+	return nil
+}
+
+// MarshalBinary encodes the built ring, including its ring positions, so
+// that it can be cached and reloaded with UnmarshalBinary or LoadHashRing.
+func (t *FNV1aHashRing) MarshalBinary() ([]byte, error) {
+	return encodeRing("fnv1a", t.replicas, t.nodes, t.ring)
+}
+
+// UnmarshalBinary replaces the ring with one encoded by MarshalBinary.
+func (t *FNV1aHashRing) UnmarshalBinary(data []byte) error {
+	b, ring, err := decodeRing("fnv1a", data)
+	if err != nil {
+		return err
+	}
+	t.replicas, t.nodes, t.ring = b.Replicas, b.Nodes, ring
+	return nil
+}
+
+// MarshalBinary encodes the ordered buckets and replicas of the ring so
+// that it can be reloaded with UnmarshalBinary or LoadHashRing.
+func (chr *JumpHashRing) MarshalBinary() ([]byte, error) {
+	return encodeRing("jump_fnv1a", chr.replicas, chr.ring, nil)
+}
+
+// UnmarshalBinary replaces the ring with one encoded by MarshalBinary.
+func (chr *JumpHashRing) UnmarshalBinary(data []byte) error {
+	b, _, err := decodeRing("jump_fnv1a", data)
+	if err != nil {
+		return err
+	}
+	chr.replicas, chr.ring = b.Replicas, b.Nodes
+	return nil
+}
+
+// LoadHashRing returns the HashRing encoded in data by the MarshalBinary
+// method of one of the built in hash rings.  The algorithm is read from
+// data and the ring is created with NewHashRing, so an error is returned
+// if that algorithm has been replaced by a HashRing that does not
+// implement encoding.BinaryUnmarshaler.
+func LoadHashRing(data []byte) (HashRing, error) {
+	b := new(ringBinary)
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	hr, err := NewHashRing(b.Algo, b.Replicas)
+	if err != nil {
+		return nil, err
+	}
+	u, ok := hr.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return nil, fmt.Errorf("Hash ring algorithm %s cannot be loaded", b.Algo)
+	}
+	if err = u.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return hr, nil
+}
@@ -0,0 +1,51 @@
+package hashing
+
+import (
+	"encoding"
+	"fmt"
+	"testing"
+)
+
+func TestLoadHashRing(t *testing.T) {
+	nodes := makeRing().Nodes()
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		hr, err := NewHashRing(algo, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hr.AddNodes(nodes)
+
+		data, err := hr.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: MarshalBinary returned error: %s", algo, err)
+		}
+		loaded, err := LoadHashRing(data)
+		if err != nil {
+			t.Fatalf("%s: LoadHashRing returned error: %s", algo, err)
+		}
+
+		if loaded.Replicas() != hr.Replicas() || loaded.Len() != hr.Len() {
+			t.Errorf("%s: Loaded ring has %d replicas and %d nodes, rather than %d and %d",
+				algo, loaded.Replicas(), loaded.Len(), hr.Replicas(), hr.Len())
+		}
+		for i, n := range loaded.Nodes() {
+			if !NodeCmp(n, hr.Nodes()[i]) {
+				t.Errorf("%s: Loaded node %d is %s, rather than %s", algo, i, n, hr.Nodes()[i])
+			}
+		}
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("foo.bar.metric%d", i)
+			if !NodeCmp(loaded.GetNode(key), hr.GetNode(key)) {
+				t.Errorf("%s: Loaded ring places %s on %s, rather than %s",
+					algo, key, loaded.GetNode(key), hr.GetNode(key))
+				break
+			}
+		}
+	}
+
+	carbon := makeRing()
+	data, _ := carbon.MarshalBinary()
+	if err := NewFNV1aHashRing().UnmarshalBinary(data); err == nil {
+		t.Errorf("FNV1aHashRing loaded a carbon ring")
+	}
+}
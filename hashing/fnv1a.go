@@ -67,6 +67,22 @@ func (t *FNV1aHashRing) AddNode(node Node) {
 	}
 }
 
+// AddNodes adds all of the given Nodes to the hash ring and sorts the
+// ring once rather than inserting each replica into place.
+func (t *FNV1aHashRing) AddNodes(nodes []Node) {
+	for _, node := range nodes {
+		t.nodes = append(t.nodes, node)
+		for i := 0; i < t.replicas; i++ {
+			var e RingEntry
+			replica_key := fmt.Sprintf("%d-%s", i, node.FNV1aKeyValue())
+			e.position = computeFNV1aRingPosition(replica_key)
+			e.node = node
+			t.ring = append(t.ring, e)
+		}
+	}
+	sortRing(t.ring)
+}
+
 func (t *FNV1aHashRing) RemoveNode(node Node) {
 	var i int
 
@@ -99,27 +115,13 @@ func (t *FNV1aHashRing) GetNode(key string) Node {
 	return t.ring[i].node
 }
 
-func (t *FNV1aHashRing) GetNodes(key string) []Node {
+func (t *FNV1aHashRing) GetNodes(key string, n int) []Node {
 	if len(t.ring) == 0 {
 		panic("HashRing is empty")
 	}
 
-	result := make([]Node, 0)
-	seen := make(map[string]bool)
 	e := RingEntry{computeFNV1aRingPosition(key), NewNode(key, 0, "")}
-	index := mod(bisectLeft(t.ring, e), len(t.ring))
-	last := index - 1
-
-	for len(seen) < len(t.nodes) && index != last {
-		next := t.ring[index]
-		if !seen[next.node.String()] {
-			seen[next.node.String()] = true
-			result = append(result, next.node)
-		}
-		index = mod((index + 1), len(t.ring))
-	}
-
-	return result
+	return walkRing(t.ring, bisectLeft(t.ring, e), len(t.nodes), n)
 }
 
 func (t *FNV1aHashRing) BucketsPerNode() map[string]int {
@@ -149,6 +151,17 @@ func (t *FNV1aHashRing) Len() int {
 	return len(t.nodes)
 }
 
+// Nodes returns the nodes in the fnv1a hash ring sorted by SortNodes()
 func (t *FNV1aHashRing) Nodes() []Node {
-	return t.nodes
+	return sortedNodes(t.nodes)
+}
+
+// Ring returns the entries of the fnv1a hash ring in position order.
+func (t *FNV1aHashRing) Ring() []RingEntry {
+	return copyRing(t.ring)
+}
+
+// KeyPosition returns the position of key in the fnv1a hash ring.
+func (t *FNV1aHashRing) KeyPosition(key string) int {
+	return computeFNV1aRingPosition(key)
 }
@@ -5,28 +5,28 @@ import (
 )
 
 var FNV1aHashTestNodesWithInstanceName = []Node{
-	{"graphite010-g5", 2003, "5"},
-	{"graphite011-g5", 2003, "1"},
-	{"graphite012-g5", 2003, "4"},
-	{"graphite013-g5", 2003, "3"},
-	{"graphite-data019-g5", 2003, "2"},
-	{"graphite-data020-g5", 2003, "6"},
-	{"graphite-data021-g5", 2003, "0"},
+	{Server: "graphite010-g5", Port: 2003, Instance: "5"},
+	{Server: "graphite011-g5", Port: 2003, Instance: "1"},
+	{Server: "graphite012-g5", Port: 2003, Instance: "4"},
+	{Server: "graphite013-g5", Port: 2003, Instance: "3"},
+	{Server: "graphite-data019-g5", Port: 2003, Instance: "2"},
+	{Server: "graphite-data020-g5", Port: 2003, Instance: "6"},
+	{Server: "graphite-data021-g5", Port: 2003, Instance: "0"},
 }
 
 var FNV1aHashTestNodes = []Node{
-	{"graphite010-g5", 2003, ""},
-	{"graphite011-g5", 2003, ""},
-	{"graphite012-g5", 2003, ""},
-	{"graphite013-g5", 2003, ""},
-	{"graphite014-g5", 2003, ""},
-	{"graphite015-g5", 2003, ""},
-	{"graphite016-g5", 2003, ""},
-	{"graphite017-g5", 2003, ""},
-	{"graphite018-g5", 2003, ""},
-	{"graphite-data019-g5", 2003, ""},
-	{"graphite-data020-g5", 2003, ""},
-	{"graphite-data021-g5", 2003, ""},
+	{Server: "graphite010-g5", Port: 2003, Instance: ""},
+	{Server: "graphite011-g5", Port: 2003, Instance: ""},
+	{Server: "graphite012-g5", Port: 2003, Instance: ""},
+	{Server: "graphite013-g5", Port: 2003, Instance: ""},
+	{Server: "graphite014-g5", Port: 2003, Instance: ""},
+	{Server: "graphite015-g5", Port: 2003, Instance: ""},
+	{Server: "graphite016-g5", Port: 2003, Instance: ""},
+	{Server: "graphite017-g5", Port: 2003, Instance: ""},
+	{Server: "graphite018-g5", Port: 2003, Instance: ""},
+	{Server: "graphite-data019-g5", Port: 2003, Instance: ""},
+	{Server: "graphite-data020-g5", Port: 2003, Instance: ""},
+	{Server: "graphite-data021-g5", Port: 2003, Instance: ""},
 }
 
 func makeFNV1aTestCHR() *FNV1aHashRing {
@@ -132,3 +132,87 @@ func TestFNV1aNodeFormat(t *testing.T) {
 		t.Logf("Expected \"%s\", returned \"%s\"", "a", r)
 	}
 }
+
+/*
+cluster test fnv1a_ch replication 3
+  graphite010-g5:2003
+  graphite011-g5:2003
+  graphite012-g5:2003
+  graphite013-g5:2003
+  graphite014-g5:2003
+  graphite015-g5:2003
+  graphite016-g5:2003
+  graphite017-g5:2003
+  graphite018-g5:2003
+  graphite-data019-g5:2003
+  graphite-data020-g5:2003
+  graphite-data021-g5:2003
+;
+
+These vectors were not produced by a carbon-c-relay run.  They come from a
+standalone C transcription of carbon-c-relay's fnv1a_ch ring building and
+ch_get_nodes() walk, written without reference to this package, which
+reproduces the replication 1 vectors above that were taken from the relay.
+None of the keys land on a ring position shared by two servers.  Replace
+them with the output of a real relay run when one is available.  For
+replication 2 the first two servers of each key are expected.
+*/
+func TestFNV1aGetNodes(t *testing.T) {
+	chr := makeFNV1aTestCHR()
+	data := map[string][]string{
+		"foobar": {"graphite010-g5", "graphite015-g5", "graphite018-g5"},
+		"suebob.foo.honey.i.shrunk.the.kids": {
+			"graphite-data021-g5", "graphite-data020-g5", "graphite-data019-g5"},
+		"5min.prod.dc06.graphite-web006-g6.kernel.net.netfilter.nf_conntrack_max": {
+			"graphite012-g5", "graphite-data021-g5", "graphite-data020-g5"},
+	}
+
+	checkFNV1aGetNodes(t, chr, data)
+}
+
+/*
+cluster test fnv1a_ch replication 3
+  graphite010-g5:2003=5
+  graphite011-g5:2003=1
+  graphite012-g5:2003=4
+  graphite013-g5:2003=3
+  graphite-data019-g5:2003=2
+  graphite-data020-g5:2003=6
+  graphite-data021-g5:2003=0
+;
+
+These vectors come from the same C transcription as TestFNV1aGetNodes,
+not from a relay run.
+*/
+func TestFNV1aGetNodesInstance(t *testing.T) {
+	chr := makeFNV1aTestCHRWithInstanceName()
+	data := map[string][]string{
+		"foobar": {"graphite013-g5", "graphite012-g5", "graphite010-g5"},
+		"suebob.foo.honey.i.shrunk.the.kids": {
+			"graphite-data021-g5", "graphite-data019-g5", "graphite011-g5"},
+		"5min.prod.dc06.graphite-web006-g6.kernel.net.netfilter.nf_conntrack_max": {
+			"graphite-data019-g5", "graphite012-g5", "graphite-data021-g5"},
+	}
+
+	checkFNV1aGetNodes(t, chr, data)
+}
+
+// checkFNV1aGetNodes compares GetNodes() for replication 2 and 3 with the
+// expected servers for each key.
+func checkFNV1aGetNodes(t *testing.T, chr *FNV1aHashRing, data map[string][]string) {
+	for key, servers := range data {
+		for r := 2; r <= len(servers); r++ {
+			nodes := chr.GetNodes(key, r)
+			if len(nodes) != r {
+				t.Errorf("GetNodes(%s, %d) returned %d nodes", key, r, len(nodes))
+				continue
+			}
+			for i, n := range nodes {
+				if n.Server != servers[i] {
+					t.Errorf("Replication %d does not match the reference walk: %s replica %d => %s  Should be %s",
+						r, key, i+1, n.Server, servers[i])
+				}
+			}
+		}
+	}
+}
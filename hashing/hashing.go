@@ -2,20 +2,28 @@ package hashing
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	//"log"
 	//"os"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 // Node is a server and instance value used in the hash ring.  A key is
 // mapped to one or more of the configured Node structs in the hash ring.
+// DC is the optional datacenter the server is in.  It records the failure
+// domain topology for tools choosing replicas but plays no part in where
+// the hash ring places keys, so it is not part of the Node's String().
+// Build Nodes with NewNode(), NewNodeParser(), or keyed literals, as
+// unkeyed literals break when fields are added.
 type Node struct {
 	Server   string
 	Port     int
 	Instance string
+	DC       string `json:",omitempty"`
 }
 
 // JSONRingType is a datastructure that identifies the name of the server
@@ -39,25 +47,87 @@ type HashRing interface {
 	// provided key.
 	GetNode(key string) Node
 
-	// GetNodes is similar to GetNode but returns a slice of Nodes who's
-	// length is the smaller of the number of nodes in the ring or
-	// the replication factor.
-	GetNodes(key string) []Node
+	// GetNodes is similar to GetNode but returns up to n distinct Nodes
+	// walking the ring from the key's position, the first being the Node
+	// GetNode returns.  The length is the smaller of n and the number of
+	// Nodes in the ring.  To find each replica of a key pass the replica
+	// count of the cluster, the Replicas of its JSONRingType, for n.
+	GetNodes(key string, n int) []Node
 
 	// AddNode adds a new Node to the hash ring.  This should not be used
 	// after you have begun calling GetNode or GetNodes.
 	AddNode(node Node)
 
+	// AddNodes adds each of the given Nodes to the hash ring in order.
+	// The result is the same as calling AddNode for each Node, but
+	// implementations may build the ring more efficiently.
+	AddNodes(nodes []Node)
+
 	// Replicas returns the number of replicas the hash ring is configured
 	// for.  This is the number of shards that each key should be stored
-	// on.
+	// on.  The carbon and fnv1a rings instead use this for the number of
+	// points each Node has on the ring, so this is not a replica count
+	// for GetNodes.
 	Replicas() int
 
 	// Nodes returns a slice of Node detailing all the servers in the hash
-	// ring.
+	// ring.  The Nodes are sorted canonically by SortNodes() so that every
+	// enumeration of the ring's Nodes agrees however the ring was built.
+	// The slice is a copy and may be modified by the caller.
 	Nodes() []Node
 }
 
+// Servers returns the distinct servers of the Nodes in the hash ring in
+// the order they appear in Nodes(), which is sorted.  Multiple instances
+// on the same server are reported once.
+func Servers(hr HashRing) []string {
+	return NodeServers(hr.Nodes())
+}
+
+// NodeServers returns the distinct Server fields of the given Nodes in the
+// order they first appear.  This is how instances collapse to servers.
+func NodeServers(nodes []Node) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0)
+	for _, n := range nodes {
+		if !seen[n.Server] {
+			seen[n.Server] = true
+			result = append(result, n.Server)
+		}
+	}
+
+	return result
+}
+
+// copyNodes returns a copy of the given slice of Nodes.
+func copyNodes(nodes []Node) []Node {
+	result := make([]Node, len(nodes))
+	copy(result, nodes)
+	return result
+}
+
+// SortNodes sorts the given Nodes canonically by server, then instance,
+// then port.
+func SortNodes(nodes []Node) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.Server != b.Server {
+			return a.Server < b.Server
+		}
+		if a.Instance != b.Instance {
+			return a.Instance < b.Instance
+		}
+		return a.Port < b.Port
+	})
+}
+
+// sortedNodes returns a sorted copy of the given Nodes.
+func sortedNodes(nodes []Node) []Node {
+	result := copyNodes(nodes)
+	SortNodes(result)
+	return result
+}
+
 // RingEntry is used to record the position of Nodes in the ring.  Not used
 // in all implementations.
 type RingEntry struct {
@@ -65,6 +135,32 @@ type RingEntry struct {
 	node     Node
 }
 
+// Position returns the position of the ring entry in the 16bit wide ring.
+func (e RingEntry) Position() int {
+	return e.position
+}
+
+// Node returns the Node that owns the ring entry.
+func (e RingEntry) Node() Node {
+	return e.node
+}
+
+// RingPositions is implemented by HashRings that place Nodes at points on
+// a ring.  Ring returns a copy of the ring entries in position order and
+// KeyPosition returns the position on the ring a key hashes to.  A key is
+// placed on the Node of the first ring entry at or after its position.
+type RingPositions interface {
+	Ring() []RingEntry
+	KeyPosition(key string) int
+}
+
+// copyRing returns a copy of the given ring entries.
+func copyRing(ring []RingEntry) []RingEntry {
+	result := make([]RingEntry, len(ring))
+	copy(result, ring)
+	return result
+}
+
 // CarbonHashRing represents Graphite's carbon-cache.py hashing algorithm.
 type CarbonHashRing struct {
 	ring     []RingEntry
@@ -81,6 +177,29 @@ func (j *JSONRingType) String() string {
 	return string(blob)
 }
 
+// Fingerprint returns a hex encoded SHA-256 hash identifying the placement
+// this ring produces.  The inputs are the hashing algorithm, the number of
+// replicas, and the nodes.  The nodes are sorted first unless the algorithm
+// is jump_fnv1a, where their order determines placement.  The ring's Name
+// is not included so the rings reported by each buckyd daemon in a healthy
+// cluster share a fingerprint.
+func (j *JSONRingType) Fingerprint() string {
+	nodes := make([]string, 0, len(j.Nodes))
+	for _, n := range j.Nodes {
+		nodes = append(nodes, n.String())
+	}
+	if j.Algo != "jump_fnv1a" {
+		sort.Strings(nodes)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n", j.Algo, j.Replicas)
+	for _, n := range nodes {
+		fmt.Fprintf(h, "%s\n", n)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
 // NewCarbonHashRing sets up a new CarbonHashRing and returns it.
 func NewCarbonHashRing() *CarbonHashRing {
 	var chr = new(CarbonHashRing)
@@ -100,10 +219,19 @@ func NewNode(server string, port int, instance string) (n Node) {
 	return n
 }
 
-// NewNodeParser parses a HOST[:PORT][=INSTANCE] format string and builds a
-// Node object which is returned.  An error is returned if the string could
-// not be parsed.
+// NewNodeParser parses a HOST[:PORT][=INSTANCE][:dc=DC] format string and
+// builds a Node object which is returned.  An error is returned if the
+// string could not be parsed.
 func NewNodeParser(s string) (Node, error) {
+	dc := ""
+	if i := strings.LastIndex(s, ":dc="); i >= 0 {
+		dc = s[i+len(":dc="):]
+		if dc == "" || strings.ContainsAny(dc, ":=") {
+			return Node{}, fmt.Errorf("Error parsing dc tag in %s", s)
+		}
+		s = s[:i]
+	}
+
 	var (
 		state    int
 		hostname []rune
@@ -155,7 +283,7 @@ func NewNodeParser(s string) (Node, error) {
 		}
 	}
 
-	return Node{string(hostname), int(parsedPort), string(instance)}, nil
+	return Node{Server: string(hostname), Port: int(parsedPort), Instance: string(instance), DC: dc}, nil
 }
 
 func NodeCmp(a, b Node) bool {
@@ -185,17 +313,37 @@ func computeCarbonRingPosition(key string) (result int) {
 	return
 }
 
+// walkRing returns up to n distinct Nodes from the ring points starting
+// at index and wrapping around, skipping the points of Nodes already
+// chosen.  This is how carbon-c-relay picks replicas.  The ring holds the
+// points of the given number of distinct Nodes.
+func walkRing(ring []RingEntry, index, nodes, n int) []Node {
+	if n > nodes {
+		n = nodes
+	}
+
+	result := make([]Node, 0, n)
+	seen := make(map[string]bool)
+	index = mod(index, len(ring))
+	for i := 0; len(result) < n && i < len(ring); i++ {
+		next := ring[index]
+		if !seen[next.node.String()] {
+			seen[next.node.String()] = true
+			result = append(result, next.node)
+		}
+		index = mod(index+1, len(ring))
+	}
+
+	return result
+}
+
 // bisectLeft returns the insertion index where e should be inserted into ring
 // if duplicate e's are already in the list the insertion point will be to the
 // left or before the equal entries.
 func bisectLeft(ring []RingEntry, e RingEntry) (i int) {
-	for i = 0; i < len(ring); i++ {
-		if ring[i].position >= e.position {
-			break
-		}
-	}
-
-	return i
+	return sort.Search(len(ring), func(i int) bool {
+		return ring[i].position >= e.position
+	})
 }
 
 // cmp compares two RingEntry variables similar to the way that the Python
@@ -234,13 +382,19 @@ func cmp(a, b RingEntry) int {
 // This is only used for ring insertion and the Python version compares tuples
 // so we use a custom cmp function to mimic what the Python code does.
 func bisectRight(ring []RingEntry, e RingEntry) (i int) {
-	for i = 0; i < len(ring); i++ {
-		if cmp(ring[i], e) > 0 {
-			break
-		}
-	}
+	return sort.Search(len(ring), func(i int) bool {
+		return cmp(ring[i], e) > 0
+	})
+}
 
-	return i
+// sortRing sorts the ring into the same order that inserting each entry
+// with insertRing() would produce.  Entries that compare equal keep their
+// relative order, just as bisectRight() places a new entry after any
+// equal entries already present.
+func sortRing(ring []RingEntry) {
+	sort.SliceStable(ring, func(i, j int) bool {
+		return cmp(ring[i], ring[j]) < 0
+	})
 }
 
 // insertRing inserts a RingEntry e into the slice ring in the correct
@@ -311,6 +465,22 @@ func (t *CarbonHashRing) AddNode(node Node) {
 	}
 }
 
+// AddNodes adds all of the given Nodes to the hash ring and sorts the
+// ring once rather than inserting each replica into place.
+func (t *CarbonHashRing) AddNodes(nodes []Node) {
+	for _, node := range nodes {
+		t.nodes = append(t.nodes, node)
+		for i := 0; i < t.replicas; i++ {
+			var e RingEntry
+			replica_key := fmt.Sprintf("%s:%d", node.CarbonKeyValue(), i)
+			e.position = computeCarbonRingPosition(replica_key)
+			e.node = node
+			t.ring = append(t.ring, e)
+		}
+	}
+	sortRing(t.ring)
+}
+
 func (t *CarbonHashRing) RemoveNode(node Node) {
 	var i int
 
@@ -351,27 +521,13 @@ func (t *CarbonHashRing) GetNode(key string) Node {
 	return t.ring[i].node
 }
 
-func (t *CarbonHashRing) GetNodes(key string) []Node {
+func (t *CarbonHashRing) GetNodes(key string, n int) []Node {
 	if len(t.ring) == 0 {
 		panic("HashRing is empty")
 	}
 
-	result := make([]Node, 0)
-	seen := make(map[string]bool)
 	e := RingEntry{computeCarbonRingPosition(key), NewNode(key, 0, "")}
-	index := mod(bisectLeft(t.ring, e), len(t.ring))
-	last := index - 1
-
-	for len(seen) < len(t.nodes) && index != last {
-		next := t.ring[index]
-		if !seen[next.node.String()] {
-			seen[next.node.String()] = true
-			result = append(result, next.node)
-		}
-		index = mod((index + 1), len(t.ring))
-	}
-
-	return result
+	return walkRing(t.ring, bisectLeft(t.ring, e), len(t.nodes), n)
 }
 
 func (t *CarbonHashRing) BucketsPerNode() map[string]int {
@@ -402,9 +558,19 @@ func (t *CarbonHashRing) Len() int {
 	return len(t.nodes)
 }
 
-// Nodes returns the nodes in the carbon hash ring
+// Nodes returns the nodes in the carbon hash ring sorted by SortNodes()
 func (t *CarbonHashRing) Nodes() []Node {
-	return t.nodes
+	return sortedNodes(t.nodes)
+}
+
+// Ring returns the entries of the carbon hash ring in position order.
+func (t *CarbonHashRing) Ring() []RingEntry {
+	return copyRing(t.ring)
+}
+
+// KeyPosition returns the position of key in the carbon hash ring.
+func (t *CarbonHashRing) KeyPosition(key string) int {
+	return computeCarbonRingPosition(key)
 }
 
 // mod returns a modulo b which is not the same as Go's a % b operator.
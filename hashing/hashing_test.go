@@ -2,6 +2,7 @@ package hashing
 
 import (
 	"fmt"
+	"sort"
 	"testing"
 )
 
@@ -106,6 +107,30 @@ func TestNewNode(t *testing.T) {
 	}
 }
 
+func TestNewNodeParserDC(t *testing.T) {
+	data := map[string]Node{
+		"graphite010:2003=a:dc=us-east": {Server: "graphite010", Port: 2003, Instance: "a", DC: "us-east"},
+		"graphite010=a:dc=us-east":      {Server: "graphite010", Instance: "a", DC: "us-east"},
+		"graphite010:dc=eu-west":        {Server: "graphite010", DC: "eu-west"},
+		"graphite010:2003=a":            {Server: "graphite010", Port: 2003, Instance: "a"},
+	}
+	for s, expected := range data {
+		n, err := NewNodeParser(s)
+		if err != nil || n != expected {
+			t.Errorf("NewNodeParser(%q) returned %#v, %v rather than %#v", s, n, err, expected)
+		}
+		if n.String() != NewNode(expected.Server, expected.Port, expected.Instance).String() {
+			t.Errorf("The dc tag of %q changed its String() to %s", s, n.String())
+		}
+	}
+
+	for _, s := range []string{"graphite010:dc=", "graphite010:dc=us:east"} {
+		if _, err := NewNodeParser(s); err == nil {
+			t.Errorf("NewNodeParser(%q) accepted an invalid dc tag", s)
+		}
+	}
+}
+
 func TestNewHashRing(t *testing.T) {
 	hr := NewCarbonHashRing()
 	hr.SetReplicas(5)
@@ -150,3 +175,283 @@ func TestGraphiteCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestAddNodes(t *testing.T) {
+	// The nodes in the order added, Nodes() sorts them
+	nodes := copyNodes(makeRing().nodes)
+
+	hr := NewCarbonHashRing()
+	hr.AddNodes(nodes)
+	expected := makeRing()
+	if hr.String() != expected.String() || len(hr.ring) != len(expected.ring) {
+		t.Fatalf("AddNodes() built a different carbon ring: %s", hr)
+	}
+	for i := range hr.ring {
+		if hr.ring[i] != expected.ring[i] {
+			t.Fatalf("AddNodes() carbon ring differs at %d: %v != %v",
+				i, hr.ring[i], expected.ring[i])
+		}
+	}
+
+	fnv := NewFNV1aHashRing()
+	fnv.AddNodes(nodes)
+	fnvExpected := NewFNV1aHashRing()
+	for _, n := range nodes {
+		fnvExpected.AddNode(n)
+	}
+	for i := range fnv.ring {
+		if fnv.ring[i] != fnvExpected.ring[i] {
+			t.Fatalf("AddNodes() fnv1a ring differs at %d: %v != %v",
+				i, fnv.ring[i], fnvExpected.ring[i])
+		}
+	}
+}
+
+func TestNodes(t *testing.T) {
+	hr := makeRing()
+	nodes := hr.Nodes()
+	if len(nodes) != hr.Len() {
+		t.Fatalf("Nodes() returned %d nodes for a ring of %d", len(nodes), hr.Len())
+	}
+	if !NodeCmp(nodes[0], NewNode("graphite-data019-g5", 0, "a")) ||
+		!NodeCmp(nodes[3], NewNode("graphite-data020-g5", 0, "a")) ||
+		!NodeCmp(nodes[12], NewNode("graphite010-g5", 0, "a")) {
+		t.Errorf("Nodes() did not return nodes sorted: %v", nodes)
+	}
+
+	nodes[0].Server = "modified"
+	if hr.Nodes()[0].Server == "modified" {
+		t.Errorf("Nodes() returned the ring's internal slice")
+	}
+
+	servers := Servers(hr)
+	if len(servers) != 13 || servers[0] != "graphite-data019-g5" || servers[12] != "graphite018-g5" {
+		t.Errorf("Servers() returned %v", servers)
+	}
+}
+
+func TestNodesOrder(t *testing.T) {
+	nodes := copyNodes(makeRing().nodes)
+	reversed := make([]Node, 0, len(nodes))
+	for i := len(nodes) - 1; i >= 0; i-- {
+		reversed = append(reversed, nodes[i])
+	}
+
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		var expected []Node
+		for _, input := range [][]Node{nodes, nodes, reversed} {
+			hr, err := NewHashRing(algo, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hr.AddNodes(input)
+			result := hr.Nodes()
+			if expected == nil {
+				expected = result
+			}
+			for i := range result {
+				if !NodeCmp(result[i], expected[i]) {
+					t.Fatalf("%s: Nodes() order differs at %d: %s != %s",
+						algo, i, result[i], expected[i])
+				}
+				if i > 0 && result[i].String() < result[i-1].String() &&
+					result[i].Server == result[i-1].Server {
+					t.Errorf("%s: Nodes() is not sorted at %d", algo, i)
+				}
+			}
+		}
+	}
+}
+
+func TestGetNodes(t *testing.T) {
+	nodes := makeRing().Nodes()
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		hr, err := NewHashRing(algo, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hr.AddNodes(nodes)
+
+		for _, n := range []int{0, 1, 3, len(nodes), len(nodes) + 5} {
+			key := "suebob.foo.honey.i.shrunk.the.kids"
+			result := hr.GetNodes(key, n)
+			expected := n
+			if n > len(nodes) {
+				expected = len(nodes)
+			}
+			if len(result) != expected {
+				t.Errorf("%s: GetNodes(%s, %d) returned %d nodes, rather than %d",
+					algo, key, n, len(result), expected)
+				continue
+			}
+			if n > 0 && !NodeCmp(result[0], hr.GetNode(key)) {
+				t.Errorf("%s: GetNodes(%s, %d) primary %s does not match GetNode() %s",
+					algo, key, n, result[0], hr.GetNode(key))
+			}
+			seen := make(map[string]bool)
+			for _, node := range result {
+				if seen[node.String()] {
+					t.Errorf("%s: GetNodes(%s, %d) returned %s more than once",
+						algo, key, n, node)
+				}
+				seen[node.String()] = true
+			}
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := &JSONRingType{
+		Name:     "graphite010-g5",
+		Algo:     "carbon",
+		Replicas: 1,
+		Nodes:    makeRing().Nodes(),
+	}
+	b := *a
+	b.Name = "graphite011-g5"
+	b.Nodes = append([]Node{}, a.Nodes...)
+	b.Nodes[0], b.Nodes[1] = b.Nodes[1], b.Nodes[0]
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Errorf("Fingerprint() differs for reordered nodes")
+	}
+
+	b.Replicas = 2
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Errorf("Fingerprint() ignores replicas")
+	}
+
+	b.Replicas = 1
+	b.Algo = "jump_fnv1a"
+	c := b
+	c.Nodes = append([]Node{}, a.Nodes...)
+	if b.Fingerprint() == c.Fingerprint() {
+		t.Errorf("Fingerprint() ignores node order for jump_fnv1a")
+	}
+	if a.Fingerprint() == c.Fingerprint() {
+		t.Errorf("Fingerprint() ignores the algorithm")
+	}
+}
+
+func TestRingPositions(t *testing.T) {
+	nodes := makeRing().Nodes()
+	for _, algo := range []string{"carbon", "fnv1a"} {
+		hr, err := NewHashRing(algo, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hr.AddNodes(nodes)
+
+		// Each node is placed at 100 points on the ring
+		ring := hr.(RingPositions).Ring()
+		if len(ring) != 100*len(nodes) {
+			t.Errorf("%s: Ring() returned %d entries for %d nodes", algo, len(ring), len(nodes))
+		}
+		for i, e := range ring {
+			if i > 0 && e.Position() < ring[i-1].Position() {
+				t.Errorf("%s: Ring() is not in position order at %d", algo, i)
+				break
+			}
+		}
+		// Keys belong to the first entry at or after their position
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("bucky.test.metric%d", i)
+			p := hr.(RingPositions).KeyPosition(key)
+			j := sort.Search(len(ring), func(j int) bool { return ring[j].Position() >= p })
+			if owner := ring[j%len(ring)].Node(); !NodeCmp(owner, hr.GetNode(key)) {
+				t.Errorf("%s: %s at position %d belongs to %s, but GetNode() returned %s",
+					algo, key, p, owner, hr.GetNode(key))
+				break
+			}
+		}
+
+		ring[0] = RingEntry{}
+		if hr.(RingPositions).Ring()[0].Node().Server == "" {
+			t.Errorf("%s: Ring() returned the ring's internal slice", algo)
+		}
+	}
+
+	if _, ok := interface{}(NewJumpHashRing(1)).(RingPositions); ok {
+		t.Errorf("JumpHashRing implements RingPositions")
+	}
+}
+
+func TestSingleNode(t *testing.T) {
+	node := NewNode("graphite010-g5", 2003, "a")
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		hr, err := NewHashRing(algo, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hr.AddNode(node)
+
+		for _, key := range []string{"foo.bar", "suebob.foo.honey.i.shrunk.the.kids", ""} {
+			if n := hr.GetNode(key); !NodeCmp(n, node) {
+				t.Errorf("%s: GetNode(%q) returned %s, rather than %s", algo, key, n, node)
+			}
+			result := hr.GetNodes(key, hr.Replicas())
+			if len(result) != 1 || !NodeCmp(result[0], node) {
+				t.Errorf("%s: GetNodes(%q, %d) returned %v, rather than only %s",
+					algo, key, hr.Replicas(), result, node)
+			}
+		}
+
+		b, ok := hr.(interface{ BucketsPerNode() map[string]int })
+		if !ok {
+			continue
+		}
+		buckets := b.BucketsPerNode()
+		if len(buckets) != 1 || buckets[node.String()] != 0xFFFF {
+			t.Errorf("%s: Single node does not own the whole ring: %v", algo, buckets)
+		}
+	}
+}
+
+func TestRemoveNodeOwnership(t *testing.T) {
+	nodes := make([]Node, 0)
+	for i := 0; i < 4; i++ {
+		server := fmt.Sprintf("graphite%03d", i)
+		nodes = append(nodes, NewNode(server, 2003, server+"-a"), NewNode(server, 2004, server+"-b"))
+	}
+	keys := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, fmt.Sprintf("foo.bar%d.baz", i))
+	}
+
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		hr, err := NewHashRing(algo, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hr.AddNodes(nodes)
+		before := make(map[string]Node, len(keys))
+		for _, k := range keys {
+			before[k] = hr.GetNode(k)
+		}
+
+		// Jump rings can only remove their last node
+		removed := nodes[2]
+		if algo == "jump_fnv1a" {
+			removed = nodes[len(nodes)-1]
+		}
+		hr.(interface{ RemoveNode(Node) }).RemoveNode(removed)
+		if hr.Len() != len(nodes)-1 {
+			t.Errorf("%s: %d nodes remain after RemoveNode(), rather than %d", algo, hr.Len(), len(nodes)-1)
+		}
+
+		for _, k := range keys {
+			n := hr.GetNode(k)
+			owned := false
+			for _, r := range nodes {
+				if NodeCmp(n, r) && !NodeCmp(n, removed) {
+					owned = true
+				}
+			}
+			if !owned {
+				t.Errorf("%s: %q resolves to %s after removing %s", algo, k, n, removed)
+			}
+			if !NodeCmp(before[k], removed) && !NodeCmp(before[k], n) {
+				t.Errorf("%s: %q moved from %s to %s though %s was removed", algo, k, before[k], n, removed)
+			}
+		}
+	}
+}
@@ -88,9 +88,10 @@ func (chr *JumpHashRing) Len() int {
 	return len(chr.ring)
 }
 
-// Nodes returns the Nodes in the hashring
+// Nodes returns the Nodes in the hashring sorted by SortNodes().  This is
+// not bucket order, which is instead determined by AddNode.
 func (chr *JumpHashRing) Nodes() []Node {
-	return chr.ring
+	return sortedNodes(chr.ring)
 }
 
 // AddNode adds a Node to the Jump Hash Ring.  Jump only operates on the
@@ -112,6 +113,14 @@ func (chr *JumpHashRing) AddNode(node Node) {
 	}
 }
 
+// AddNodes adds each of the given Nodes to the Jump Hash Ring as AddNode
+// does.
+func (chr *JumpHashRing) AddNodes(nodes []Node) {
+	for _, node := range nodes {
+		chr.AddNode(node)
+	}
+}
+
 // RemoveNode removes the last node in the ring regardless of the value of
 // the given node which is here to implement our interface.
 func (chr *JumpHashRing) RemoveNode(node Node) {
@@ -127,32 +136,29 @@ func (chr *JumpHashRing) GetNode(key string) Node {
 	return chr.ring[idx]
 }
 
-// GetNodes returns a slice of Node objects one for each replica where the
-// object is stored.
-func (chr *JumpHashRing) GetNodes(key string) []Node {
-	ring := make([]Node, 0)
-	ret := make([]Node, 0)
-	h := Fnv1a64([]byte(key))
-	i := len(chr.ring)
-	j := 0
-	r := chr.replicas
+// GetNodes returns up to n distinct Node objects for the given key.  The
+// first is the bucket GetNode returns.  Each further bucket is chosen by
+// jumping again with a new hash among the buckets not yet chosen.
+func (chr *JumpHashRing) GetNodes(key string, n int) []Node {
+	if n > len(chr.ring) {
+		n = len(chr.ring)
+	}
 
 	// We need to alter the ring as we go along, make a safe place
+	ring := make([]Node, len(chr.ring))
 	copy(ring, chr.ring)
-	for i > 0 {
-		j = Jump(h, i)
-		ret = append(ret, chr.ring[j])
 
-		if r--; r <= 0 {
-			break
-		}
+	ret := make([]Node, 0, n)
+	h := Fnv1a64([]byte(key))
+	for i := len(ring); len(ret) < n; i-- {
+		j := Jump(h, i)
+		ret = append(ret, ring[j])
 
 		// Generate a new unique hash
 		h = XorShift(h)
 
 		// Remove the previously selected bucket from our list
-		i--
-		ring[j] = ring[i]
+		ring[j] = ring[i-1]
 	}
 	return ret
 }
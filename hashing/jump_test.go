@@ -1,6 +1,7 @@
 package hashing
 
 import (
+	"fmt"
 	"sort"
 	"strings"
 	"testing"
@@ -74,7 +75,7 @@ var jumpHashTestNodes = []string{
 func makeJumpTestCHR(r int) *JumpHashRing {
 	chr := NewJumpHashRing(r)
 	for _, v := range jumpHashTestNodes {
-		chr.AddNode(Node{v, 0, ""})
+		chr.AddNode(Node{Server: v, Port: 0, Instance: ""})
 	}
 
 	return chr
@@ -83,7 +84,7 @@ func makeJumpTestCHR(r int) *JumpHashRing {
 func makeJumpTestCHRWithInstanceName(r int) *JumpHashRing {
 	chr := NewJumpHashRing(r)
 	for _, v := range jumpHashTestNodesWithInstanceName {
-		chr.AddNode(Node{v[0], 0, v[1]})
+		chr.AddNode(Node{Server: v[0], Port: 0, Instance: v[1]})
 	}
 	return chr
 }
@@ -172,3 +173,43 @@ func TestJumpCHRNoInstanceOrder(t *testing.T) {
 		}
 	}
 }
+
+// TestJumpCHRResize checks the remapping jump hash promises when buckets
+// are appended or the last is removed: keys only move to or from that
+// bucket, and about 1/n of the keys move.
+func TestJumpCHRResize(t *testing.T) {
+	chr := makeJumpTestCHR(1)
+	keys := make([]string, 0, 10000)
+	for i := 0; i < 10000; i++ {
+		keys = append(keys, fmt.Sprintf("foo.bar%d.baz", i))
+	}
+	before := make(map[string]Node, len(keys))
+	for _, k := range keys {
+		before[k] = chr.GetNode(k)
+	}
+
+	added := NewNode("graphite-data999-g5", 0, "")
+	chr.AddNode(added)
+	moved := 0
+	for _, k := range keys {
+		n := chr.GetNode(k)
+		if NodeCmp(n, before[k]) {
+			continue
+		}
+		moved++
+		if !NodeCmp(n, added) {
+			t.Errorf("%q moved from %s to %s rather than the added bucket", k, before[k], n)
+		}
+	}
+	expected := len(keys) / chr.Len()
+	if moved < expected/2 || moved > expected*2 {
+		t.Errorf("Adding a bucket to %d moved %d keys, expected about %d", chr.Len()-1, moved, expected)
+	}
+
+	chr.RemoveNode(added)
+	for _, k := range keys {
+		if n := chr.GetNode(k); !NodeCmp(n, before[k]) {
+			t.Errorf("%q is on %s after removing the added bucket, rather than %s", k, n, before[k])
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package hashing
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// HashRingFactory returns a new, empty HashRing for a cluster configured
+// with the given replication factor.
+type HashRingFactory func(replicas int) HashRing
+
+var registryLock sync.RWMutex
+var registry = map[string]HashRingFactory{
+	"carbon": func(replicas int) HashRing {
+		return NewCarbonHashRing()
+	},
+	"fnv1a": func(replicas int) HashRing {
+		return NewFNV1aHashRing()
+	},
+	"jump_fnv1a": func(replicas int) HashRing {
+		return NewJumpHashRing(replicas)
+	},
+}
+
+// RegisterHashRing makes a HashRing implementation available under the
+// algorithm name algo.  Embedders may use this to plug in their own
+// placement scheme or to replace a built in one.  Rings whose Algo field
+// names algo are then built with f.
+func RegisterHashRing(algo string, f HashRingFactory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry[algo] = f
+}
+
+// NewHashRing returns a new, empty HashRing that implements the named
+// hashing algorithm with the given replication factor.
+func NewHashRing(algo string, replicas int) (HashRing, error) {
+	registryLock.RLock()
+	f, ok := registry[algo]
+	registryLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown consistent hash algorithm: %s", algo)
+	}
+
+	return f(replicas), nil
+}
+
+// HashRingAlgorithms returns the sorted names of the registered hashing
+// algorithms.
+func HashRingAlgorithms() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	result := make([]string, 0, len(registry))
+	for algo := range registry {
+		result = append(result, algo)
+	}
+	sort.Strings(result)
+	return result
+}
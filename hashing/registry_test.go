@@ -0,0 +1,45 @@
+package hashing
+
+import (
+	"testing"
+)
+
+// staticHashRing places every key on the first Node added
+type staticHashRing struct {
+	CarbonHashRing
+}
+
+func (t *staticHashRing) GetNode(key string) Node {
+	return t.nodes[0]
+}
+
+func TestRegisterHashRing(t *testing.T) {
+	for _, algo := range []string{"carbon", "fnv1a", "jump_fnv1a"} {
+		if _, err := NewHashRing(algo, 1); err != nil {
+			t.Errorf("NewHashRing(%q) returned an error: %s", algo, err)
+		}
+	}
+	if _, err := NewHashRing("static", 1); err == nil {
+		t.Errorf("NewHashRing() built an unregistered algorithm")
+	}
+
+	RegisterHashRing("static", func(replicas int) HashRing {
+		return &staticHashRing{*NewCarbonHashRing()}
+	})
+	hr, err := NewHashRing("static", 1)
+	if err != nil {
+		t.Fatalf("NewHashRing() of a registered algorithm returned an error: %s", err)
+	}
+	hr.AddNodes([]Node{NewNode("graphite010", 0, ""), NewNode("graphite011", 0, "")})
+	if hr.GetNode("foo.bar").Server != "graphite010" {
+		t.Errorf("NewHashRing() did not use the registered implementation")
+	}
+
+	found := false
+	for _, algo := range HashRingAlgorithms() {
+		found = found || algo == "static"
+	}
+	if !found {
+		t.Errorf("HashRingAlgorithms() did not list the registered algorithm")
+	}
+}
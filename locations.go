@@ -0,0 +1,79 @@
+package buckytools
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// LocationsVersion is the version of the binary metric location stream
+// written by WriteLocations().  Streams of a different version are refused
+// by ReadLocations().
+const LocationsVersion = 1
+
+// LocationsHeader begins a binary metric location stream.
+type LocationsHeader struct {
+	// Version is the stream format version, LocationsVersion
+	Version int
+
+	// Count is the number of Location values that follow
+	Count int
+}
+
+// Location is the host a metric is placed on by the hash ring.
+type Location struct {
+	Metric string
+	Host   string
+}
+
+// WriteLocations writes the map of metric => host to w as a binary stream
+// for consumption by another Go program.  The stream is encoded with
+// encoding/gob as a LocationsHeader followed by one Location per metric
+// sorted by metric name.  Use ReadLocations() to decode it.
+func WriteLocations(w io.Writer, list map[string]string) error {
+	metrics := make([]string, 0, len(list))
+	for m := range list {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+
+	enc := gob.NewEncoder(w)
+	err := enc.Encode(LocationsHeader{LocationsVersion, len(metrics)})
+	if err != nil {
+		return err
+	}
+	for _, m := range metrics {
+		err = enc.Encode(Location{m, list[m]})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadLocations decodes a binary stream written by WriteLocations() and
+// returns the Locations in the order they were written.
+func ReadLocations(r io.Reader) ([]Location, error) {
+	dec := gob.NewDecoder(r)
+	header := LocationsHeader{}
+	err := dec.Decode(&header)
+	if err != nil {
+		return nil, err
+	}
+	if header.Version != LocationsVersion {
+		return nil, fmt.Errorf("Unsupported locations version %d, expected %d",
+			header.Version, LocationsVersion)
+	}
+
+	result := make([]Location, header.Count)
+	for i := range result {
+		err = dec.Decode(&result[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,43 @@
+package buckytools
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+func TestLocations(t *testing.T) {
+	list := map[string]string{
+		"foo.bar": "graphite010",
+		"foo.baz": "graphite011:a",
+		"abc.def": "graphite010",
+	}
+	expected := []Location{
+		{"abc.def", "graphite010"},
+		{"foo.bar", "graphite010"},
+		{"foo.baz", "graphite011:a"},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := WriteLocations(buf, list); err != nil {
+		t.Fatalf("WriteLocations returned error: %s", err)
+	}
+	locs, err := ReadLocations(buf)
+	if err != nil {
+		t.Fatalf("ReadLocations returned error: %s", err)
+	}
+	if len(locs) != len(expected) {
+		t.Fatalf("ReadLocations returned %d locations, rather than %d", len(locs), len(expected))
+	}
+	for i := range expected {
+		if locs[i] != expected[i] {
+			t.Errorf("ReadLocations returned %v at %d, rather than %v", locs[i], i, expected[i])
+		}
+	}
+
+	buf.Reset()
+	gob.NewEncoder(buf).Encode(LocationsHeader{LocationsVersion + 1, 0})
+	if _, err := ReadLocations(buf); err == nil {
+		t.Errorf("ReadLocations accepted an unsupported version")
+	}
+}
@@ -1,7 +1,10 @@
 package metrics
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
+	"io"
 	"log"
 	"os"
 	"path"
@@ -27,6 +30,27 @@ type MetricData struct {
 	ModTime  int64
 	Encoding int
 	Data     []byte `json:"-"` // We never JSON encode metric data
+
+	// Checksum is the hex encoded SHA-256 hash of the unencoded Whisper
+	// DB, if known, so that a transfer may be verified
+	Checksum string `json:",omitempty"`
+}
+
+// Checksum returns the hex encoded MetricData checksum of the unencoded
+// Whisper DB data.
+func Checksum(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// ReaderChecksum returns the hex encoded MetricData checksum of the
+// unencoded Whisper DB data read from r.
+func ReaderChecksum(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 type MetricsCacheType struct {
@@ -182,6 +206,39 @@ func checkWalk(path string, info os.FileInfo, err error) (bool, error) {
 	return true, nil
 }
 
+// WalkMetrics walks the Whisper DB store rooted at root and calls fn with
+// the metric name of each *.wsp file found.  Metric names are relative to
+// root rather than the --prefix flag.  The walk stops at the first non-nil
+// error returned by fn and that error is returned.  An error reading root
+// itself is returned, while unreadable files and directories below it are
+// logged and skipped.
+func WalkMetrics(root string, fn func(metric string) error) error {
+	root = filepath.Clean(root)
+	examine := func(p string, info os.FileInfo, err error) error {
+		if err != nil && p == root {
+			return err
+		}
+		ok, err := checkWalk(p, info, err)
+		if err != nil {
+			if p == root {
+				// Do not skip the root even if it is a dot-directory
+				return nil
+			}
+			return err
+		}
+		if ok {
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			return fn(RelativeToMetric(filepath.ToSlash(rel)))
+		}
+		return nil
+	}
+
+	return filepath.Walk(root, examine)
+}
+
 // NewMetricsCache creates and returns a MetricsCacheType object
 func NewMetricsCache() *MetricsCacheType {
 	m := new(MetricsCacheType)
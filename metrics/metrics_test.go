@@ -1,6 +1,10 @@
 package metrics
 
 import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -24,3 +28,47 @@ func TestPathToMetric(t *testing.T) {
 			"bobby.sue.foo.bar")
 	}
 }
+
+func TestWalkMetrics(t *testing.T) {
+	root := t.TempDir()
+	files := []string{
+		"bobby/sue/foo/bar.wsp",
+		"bobby/sue/baz.wsp",
+		"bobby/sue/notes.txt",
+		"bobby/.hidden/foo.wsp",
+	}
+	for _, f := range files {
+		p := filepath.Join(root, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found := make([]string, 0)
+	err := WalkMetrics(root+"/", func(m string) error {
+		found = append(found, m)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkMetrics returned an error: %s", err)
+	}
+	sort.Strings(found)
+	expected := []string{"bobby.sue.baz", "bobby.sue.foo.bar"}
+	if strings.Join(found, " ") != strings.Join(expected, " ") {
+		t.Errorf("WalkMetrics found %v, rather than %v", found, expected)
+	}
+}
+
+func TestWalkMetricsMissingRoot(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "missing")
+	err := WalkMetrics(root, func(m string) error {
+		t.Errorf("WalkMetrics found %s in a missing directory", m)
+		return nil
+	})
+	if err == nil {
+		t.Errorf("WalkMetrics did not return an error for a missing root")
+	}
+}